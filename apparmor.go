@@ -0,0 +1,49 @@
+package task
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// apparmorProfiles lists the AppArmor profiles loaded into the kernel.
+const apparmorProfiles = "/sys/kernel/security/apparmor/profiles"
+
+// validateApparmorProfile checks that the named profile is loaded, according
+// to the given profiles list, so that buildkitd can apply it to builds.
+func validateApparmorProfile(profilesPath string, profile string) error {
+	file, err := os.Open(profilesPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("apparmor is not enabled")
+		}
+
+		return errors.Wrap(err, "list apparmor profiles")
+	}
+
+	defer file.Close()
+
+	// each line is of the form "name (mode)"
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		name := line
+		if i := strings.LastIndex(line, " ("); i != -1 {
+			name = line[:i]
+		}
+
+		if name == profile {
+			return nil
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return errors.Wrap(err, "list apparmor profiles")
+	}
+
+	return errors.Errorf("apparmor profile '%s' is not loaded", profile)
+}
@@ -0,0 +1,187 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/pkg/errors"
+)
+
+// buildkit attaches attestations to an image index as manifests annotated with
+// the digest of the image they refer to, each layer of which is an in-toto
+// statement.
+const (
+	referenceTypeAnnotation   = "vnd.docker.reference.type"
+	referenceDigestAnnotation = "vnd.docker.reference.digest"
+	predicateTypeAnnotation   = "in-toto.io/predicate-type"
+
+	attestationManifestType = "attestation-manifest"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// attestationsDir returns the AttestationsDir, resolved against the outputs
+// dir unless absolute.
+func attestationsDir(cfg Config, outputsDir string) string {
+	if filepath.IsAbs(cfg.AttestationsDir) {
+		return cfg.AttestationsDir
+	}
+
+	return filepath.Join(outputsDir, cfg.AttestationsDir)
+}
+
+// extractAttestations writes each attestation in the OCI layout at layoutDir
+// to dest, as <dest>/<image digest tag>/<predicate type>.json, returning how
+// many were written.
+func extractAttestations(layoutDir string, dest string) (int, error) {
+	extracted := 0
+
+	// an image may have several attestations of the same type, e.g. an SBOM
+	// per scanned layer
+	seen := map[string]int{}
+
+	err := walkAttestations(layoutDir, func(subject v1.Hash, predicateType string, statement []byte) error {
+		subjectDir := filepath.Join(dest, digestTag(subject))
+
+		err := os.MkdirAll(subjectDir, 0755)
+		if err != nil {
+			return errors.Wrap(err, "create attestations dir")
+		}
+
+		name := attestationFileName(predicateType)
+		key := filepath.Join(subjectDir, name)
+		seen[key]++
+		if seen[key] > 1 {
+			name = fmt.Sprintf("%s-%d", name, seen[key])
+		}
+
+		err = ioutil.WriteFile(filepath.Join(subjectDir, name+".json"), statement, 0644)
+		if err != nil {
+			return errors.Wrap(err, "write attestation")
+		}
+
+		extracted++
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return extracted, nil
+}
+
+// walkAttestations calls fn with each in-toto statement attached to the
+// images in the OCI layout at layoutDir, along with the digest of the image
+// it refers to and its predicate type.
+func walkAttestations(layoutDir string, fn func(subject v1.Hash, predicateType string, statement []byte) error) error {
+	l, err := layout.FromPath(layoutDir)
+	if err != nil {
+		return errors.Wrap(err, "open oci layout")
+	}
+
+	index, err := l.ImageIndex()
+	if err != nil {
+		return errors.Wrap(err, "load oci layout index")
+	}
+
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return errors.Wrap(err, "get index manifest")
+	}
+
+	return walkIndexAttestations(l, manifest, fn)
+}
+
+func walkIndexAttestations(l layout.Path, index *v1.IndexManifest, fn func(v1.Hash, string, []byte) error) error {
+	for _, desc := range index.Manifests {
+		if desc.MediaType.IsIndex() {
+			raw, err := l.Bytes(desc.Digest)
+			if err != nil {
+				return errors.Wrapf(err, "read index %s", desc.Digest)
+			}
+
+			nested, err := v1.ParseIndexManifest(bytes.NewReader(raw))
+			if err != nil {
+				return errors.Wrapf(err, "parse index %s", desc.Digest)
+			}
+
+			err = walkIndexAttestations(l, nested, fn)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if desc.Annotations[referenceTypeAnnotation] != attestationManifestType {
+			continue
+		}
+
+		subject, err := v1.NewHash(desc.Annotations[referenceDigestAnnotation])
+		if err != nil {
+			return errors.Wrapf(err, "attestation manifest %s subject", desc.Digest)
+		}
+
+		err = walkManifestAttestations(l, desc.Digest, subject, fn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkManifestAttestations(l layout.Path, digest v1.Hash, subject v1.Hash, fn func(v1.Hash, string, []byte) error) error {
+	raw, err := l.Bytes(digest)
+	if err != nil {
+		return errors.Wrapf(err, "read attestation manifest %s", digest)
+	}
+
+	manifest, err := v1.ParseManifest(bytes.NewReader(raw))
+	if err != nil {
+		return errors.Wrapf(err, "parse attestation manifest %s", digest)
+	}
+
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != types.MediaType("application/vnd.in-toto+json") {
+			continue
+		}
+
+		blob, err := l.Bytes(layer.Digest)
+		if err != nil {
+			return errors.Wrapf(err, "read attestation %s", layer.Digest)
+		}
+
+		err = fn(subject, layer.Annotations[predicateTypeAnnotation], blob)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// attestationFileName returns a file name for attestations of the given
+// predicate type, e.g. slsa.dev-provenance-v0.2 for
+// https://slsa.dev/provenance/v0.2.
+func attestationFileName(predicateType string) string {
+	if i := strings.Index(predicateType, "://"); i != -1 {
+		predicateType = predicateType[i+3:]
+	}
+
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(predicateType, "-"), "-.")
+	if name == "" {
+		return "attestation"
+	}
+
+	return name
+}
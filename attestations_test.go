@@ -0,0 +1,108 @@
+package task
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type AttestationsSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *AttestationsSuite) TestExtract() {
+	dest := s.T().TempDir()
+
+	extracted, err := extractAttestations("testdata/attestations", dest)
+	s.NoError(err)
+	s.Equal(3, extracted)
+
+	subjectDir := filepath.Join(dest, "sha256-8609658bb250ccb45896dc6c711f5fd59aa3c33fd3393c776a43375671c043ae")
+
+	files, err := ioutil.ReadDir(subjectDir)
+	s.NoError(err)
+
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+
+	s.Equal([]string{
+		"slsa.dev-provenance-v0.2.json",
+		"spdx.dev-Document-2.json",
+		"spdx.dev-Document.json",
+	}, names)
+
+	var statement struct {
+		PredicateType string `json:"predicateType"`
+		Predicate     struct {
+			Name string `json:"name"`
+		} `json:"predicate"`
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(subjectDir, "spdx.dev-Document-2.json"))
+	s.NoError(err)
+	s.NoError(json.Unmarshal(contents, &statement))
+	s.Equal("https://spdx.dev/Document", statement.PredicateType)
+	s.Equal("sbom-context", statement.Predicate.Name)
+}
+
+func (s *AttestationsSuite) TestExtractNoLayout() {
+	_, err := extractAttestations(s.T().TempDir(), s.T().TempDir())
+	s.Error(err)
+}
+
+func (s *AttestationsSuite) TestExtractNone() {
+	// as exported by buildkit older than v0.11
+	image, err := random.Image(1024, 1)
+	s.NoError(err)
+
+	layoutDir := s.T().TempDir()
+	l, err := layout.Write(layoutDir, empty.Index)
+	s.NoError(err)
+	s.NoError(l.AppendImage(image))
+
+	extracted, err := extractAttestations(layoutDir, s.T().TempDir())
+	s.NoError(err)
+	s.Zero(extracted)
+}
+
+func (s *AttestationsSuite) TestFileName() {
+	s.Equal("slsa.dev-provenance-v0.2", attestationFileName("https://slsa.dev/provenance/v0.2"))
+	s.Equal("spdx.dev-Document", attestationFileName("https://spdx.dev/Document"))
+	s.Equal("attestation", attestationFileName(""))
+}
+
+func (s *AttestationsSuite) TestDir() {
+	s.Equal("/outputs/attestations", attestationsDir(Config{AttestationsDir: "attestations"}, "/outputs"))
+	s.Equal("/tmp/attestations", attestationsDir(Config{AttestationsDir: "/tmp/attestations"}, "/outputs"))
+}
+
+func (s *AttestationsSuite) TestSanitize() {
+	cfg := Config{AttestationsDir: "attestations"}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "output type 'docker'")
+
+	cfg = Config{AttestationsDir: "attestations", OutputType: "oci"}
+	s.NoError(sanitize(&cfg))
+}
+
+func (s *AttestationsSuite) TestOutputs() {
+	outputs := responseOutputs(Config{OutputType: "oci", AttestationsDir: "attestations"}, []string{"/outputs/image/image.tar"}, false)
+	s.Equal([]string{"image", "oci-layout", "attestations"}, outputs)
+}
+
+func TestAttestations(t *testing.T) {
+	suite.Run(t, &AttestationsSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,167 @@
+package task
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// dockerfileBaseImages returns the images the Dockerfile's stages are built
+// FROM, with build args expanded and fully qualified, in order and without
+// duplicates. scratch and references to earlier stages are skipped, as are
+// images given by one of the localArgs (see ImageArgs), since they aren't
+// pulled from a registry.
+//
+// As with buildkit, only build args declared before the first FROM can be
+// used in FROM, with values from buildArgs (KEY=VALUE) overriding their
+// defaults.
+func dockerfileBaseImages(dockerfile io.Reader, buildArgs []string, localArgs []string) ([]string, error) {
+	instructions, err := dockerfileInstructions(dockerfile)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := map[string]string{}
+	for _, arg := range buildArgs {
+		segs := strings.SplitN(arg, "=", 2)
+		if len(segs) == 2 {
+			overrides[segs[0]] = segs[1]
+		}
+	}
+
+	local := map[string]bool{}
+	for _, arg := range localArgs {
+		local[arg] = true
+	}
+
+	args := map[string]string{}
+	stages := map[string]bool{}
+	seen := map[string]bool{}
+	images := []string{}
+
+	sawFrom := false
+	for _, instruction := range instructions {
+		fields := strings.Fields(instruction)
+
+		if strings.EqualFold(fields[0], "ARG") && !sawFrom {
+			for _, field := range fields[1:] {
+				segs := strings.SplitN(field, "=", 2)
+
+				if value, found := overrides[segs[0]]; found {
+					args[segs[0]] = value
+				} else if len(segs) == 2 {
+					args[segs[0]] = strings.Trim(segs[1], `"'`)
+				}
+			}
+
+			continue
+		}
+
+		from, ok := fromArgs(instruction)
+		if !ok || len(from) == 0 {
+			continue
+		}
+
+		sawFrom = true
+
+		image, err := baseImage(from[0], args, local, stages)
+		if err != nil {
+			return nil, err
+		}
+
+		if image != "" && !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+
+		// recorded after the image, which can't refer to its own stage
+		if len(from) == 3 && strings.EqualFold(from[1], "AS") {
+			stages[strings.ToLower(from[2])] = true
+		}
+	}
+
+	return images, nil
+}
+
+// baseImage returns the fully qualified image for a FROM instruction's image
+// argument, or "" if it isn't pulled from a registry.
+func baseImage(arg string, args map[string]string, local map[string]bool, stages map[string]bool) (string, error) {
+	var undefined string
+	var isLocal bool
+	image := os.Expand(arg, func(key string) string {
+		if local[key] {
+			isLocal = true
+		}
+
+		value, found := args[key]
+		if !found && undefined == "" {
+			undefined = key
+		}
+
+		return value
+	})
+
+	if isLocal {
+		return "", nil
+	}
+
+	if undefined != "" {
+		return "", errors.Errorf("base image '%s' uses undefined build arg '%s'", arg, undefined)
+	}
+
+	if strings.EqualFold(image, "scratch") || stages[strings.ToLower(image)] {
+		return "", nil
+	}
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse base image '%s'", image)
+	}
+
+	return ref.Name(), nil
+}
+
+// cosignVerifyCommand returns the command for verifying the image's signature
+// with the given cosign key, which may be a path or a KMS URI.
+func cosignVerifyCommand(key string, image string) []string {
+	return []string{"cosign", "verify", "--key", key, image}
+}
+
+// verifyBaseImages verifies the signature of each of the Dockerfile's base
+// images with cosign, failing on the first which isn't signed with the key.
+func verifyBaseImages(cfg Config) error {
+	dockerfile, err := os.Open(cfg.DockerfilePath)
+	if err != nil {
+		return errors.Wrap(err, "open dockerfile")
+	}
+
+	defer dockerfile.Close()
+
+	localArgs := []string{}
+	for _, arg := range cfg.ImageArgs {
+		localArgs = append(localArgs, strings.SplitN(arg, "=", 2)[0])
+	}
+
+	images, err := dockerfileBaseImages(dockerfile, cfg.BuildArgs, localArgs)
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		cmd := cosignVerifyCommand(cfg.CosignKey, image)
+
+		logrus.Infof("verifying signature of base image '%s'", image)
+		logrus.Debugf("running %s", strings.Join(cmd, " "))
+
+		err := run(os.Stderr, cmd[0], cmd[1:]...)
+		if err != nil {
+			return errors.Wrapf(err, "base image '%s' failed signature verification", image)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package task
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type BaseImagesSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *BaseImagesSuite) TestFrom() {
+	images, err := dockerfileBaseImages(strings.NewReader(`# syntax=docker/dockerfile:1
+ARG GO_VERSION=1.18
+ARG RUNTIME="gcr.io/distroless/static"
+FROM --platform=$BUILDPLATFORM golang:${GO_VERSION} AS builder
+RUN go build ./...
+
+FROM Builder AS tested
+RUN go test ./...
+
+# FROM commented/out
+
+FROM \
+  alpine:3.16 \
+  AS tools
+
+FROM scratch AS empty
+
+FROM $RUNTIME
+COPY --from=builder /app /app
+
+FROM golang:1.18
+`), nil, nil)
+	s.NoError(err)
+	s.Equal([]string{
+		"index.docker.io/library/golang:1.18",
+		"index.docker.io/library/alpine:3.16",
+		"gcr.io/distroless/static:latest",
+	}, images)
+}
+
+func (s *BaseImagesSuite) TestBuildArgs() {
+	images, err := dockerfileBaseImages(strings.NewReader(`ARG BASE=alpine
+ARG REGISTRY
+FROM ${REGISTRY}/${BASE}
+ARG BASE=ignored
+`), []string{"REGISTRY=registry.example.com", "BASE=debian:bullseye"}, nil)
+	s.NoError(err)
+	s.Equal([]string{"registry.example.com/debian:bullseye"}, images)
+}
+
+func (s *BaseImagesSuite) TestUndefinedBuildArg() {
+	_, err := dockerfileBaseImages(strings.NewReader("FROM ${BASE}\nARG BASE=alpine\n"), nil, nil)
+	s.Error(err)
+	s.Contains(err.Error(), "'BASE'")
+}
+
+func (s *BaseImagesSuite) TestLocalImages() {
+	images, err := dockerfileBaseImages(strings.NewReader(`ARG base_image
+FROM ${base_image} AS base
+FROM busybox
+COPY --from=base / /
+`), nil, []string{"base_image"})
+	s.NoError(err)
+	s.Equal([]string{"index.docker.io/library/busybox:latest"}, images)
+}
+
+func (s *BaseImagesSuite) TestInvalidImage() {
+	_, err := dockerfileBaseImages(strings.NewReader("FROM Not/A/Valid:Image:Ref\n"), nil, nil)
+	s.Error(err)
+}
+
+func (s *BaseImagesSuite) TestVerifyCommand() {
+	s.Equal(
+		[]string{"cosign", "verify", "--key", "cosign.pub", "index.docker.io/library/golang:1.18"},
+		cosignVerifyCommand("cosign.pub", "index.docker.io/library/golang:1.18"),
+	)
+
+	s.Equal(
+		[]string{"cosign", "verify", "--key", "gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k", "gcr.io/distroless/static:latest"},
+		cosignVerifyCommand("gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k", "gcr.io/distroless/static:latest"),
+	)
+}
+
+func (s *BaseImagesSuite) TestSanitize() {
+	cfg := Config{VerifyBaseImages: true}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "cosign key")
+
+	cfg = Config{VerifyBaseImages: true, CosignKey: "cosign.pub", GatewayImage: "some/frontend"}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{VerifyBaseImages: true, CosignKey: "cosign.pub"}
+	s.NoError(sanitize(&cfg))
+}
+
+func TestBaseImages(t *testing.T) {
+	suite.Run(t, &BaseImagesSuite{
+		Assertions: require.New(t),
+	})
+}
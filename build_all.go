@@ -0,0 +1,159 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultParallelism is how many of the request's Configs are built at once,
+// unless configured otherwise.
+const defaultParallelism = 2
+
+// buildFunc builds a single request, as BuildContext.
+type buildFunc func(ctx context.Context, outputsDir string, req Request) (Response, error)
+
+// BuildAll builds each of the request's Configs against the one buildkitd,
+// concurrently, writing each one's outputs to the subdirectory of the outputs
+// dir with its name.
+func BuildAll(ctx context.Context, buildkitd *Buildkitd, outputsDir string, req Request) (Response, error) {
+	return buildAll(ctx, outputsDir, req, func(ctx context.Context, outputsDir string, req Request) (Response, error) {
+		return BuildContext(ctx, buildkitd, outputsDir, req)
+	})
+}
+
+func buildAll(ctx context.Context, outputsDir string, req Request, build buildFunc) (Response, error) {
+	seen := map[string]bool{}
+	for _, cfg := range req.Configs {
+		if cfg.Name == "" {
+			return Response{}, errors.New("each config must have a name")
+		}
+
+		if strings.ContainsRune(cfg.Name, filepath.Separator) || cfg.Name == "." || cfg.Name == ".." {
+			return Response{}, errors.Errorf("invalid config name '%s'", cfg.Name)
+		}
+
+		if seen[cfg.Name] {
+			return Response{}, errors.Errorf("duplicate config name '%s'", cfg.Name)
+		}
+
+		seen[cfg.Name] = true
+	}
+
+	parallelism := req.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultParallelism
+	}
+
+	if reason := sharedState(req.Configs); reason != "" && parallelism > 1 {
+		logrus.Infof("building sequentially, as %s", reason)
+		parallelism = 1
+	}
+
+	// the log level is process-wide, so set it once up front rather than have
+	// each build change it while others are running
+	for _, cfg := range req.Configs {
+		if cfg.Debug {
+			logrus.SetLevel(logrus.DebugLevel)
+			break
+		}
+	}
+
+	responses := make([]Response, len(req.Configs))
+	errs := make([]error, len(req.Configs))
+
+	sem := make(chan struct{}, parallelism)
+	wg := new(sync.WaitGroup)
+
+	for i, cfg := range req.Configs {
+		wg.Add(1)
+
+		go func(i int, cfg Config) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			logrus.Infof("building '%s'", cfg.Name)
+
+			responses[i], errs[i] = build(ctx, filepath.Join(outputsDir, cfg.Name), Request{
+				ResponsePath: req.ResponsePath,
+				Config:       cfg,
+			})
+		}(i, cfg)
+	}
+
+	wg.Wait()
+
+	res := Response{
+		Builds: map[string]Response{},
+	}
+
+	var failures []string
+	for i, cfg := range req.Configs {
+		if errs[i] != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", cfg.Name, errs[i]))
+			continue
+		}
+
+		res.Builds[cfg.Name] = responses[i]
+
+		for _, output := range responses[i].Outputs {
+			res.Outputs = append(res.Outputs, cfg.Name+"/"+output)
+		}
+
+		for _, warning := range responses[i].Warnings {
+			res.Warnings = append(res.Warnings, cfg.Name+": "+warning)
+		}
+
+		for stage, timing := range responses[i].StageTimings {
+			if res.StageTimings == nil {
+				res.StageTimings = map[string]string{}
+			}
+
+			res.StageTimings[cfg.Name+"/"+stage] = timing
+		}
+	}
+
+	if len(failures) > 0 {
+		return res, errors.Errorf("%d of %d build(s) failed:\n%s", len(failures), len(req.Configs), strings.Join(failures, "\n"))
+	}
+
+	return res, nil
+}
+
+// sharedState returns why the configs can't be built concurrently, if they
+// can't: injecting files writes to the context dir, which other builds may be
+// sending at the same time, and a stable context path is a single symlink.
+func sharedState(cfgs []Config) string {
+	contexts := map[string]int{}
+	for _, cfg := range cfgs {
+		contexts[filepath.Clean(cfg.ContextDir)]++
+	}
+
+	stablePaths := map[string]bool{}
+	for _, cfg := range cfgs {
+		// with a read-only context, files are injected into its own overlay
+		if len(cfg.InjectFiles) > 0 && !cfg.ReadOnlyContext && contexts[filepath.Clean(cfg.ContextDir)] > 1 {
+			return fmt.Sprintf("'%s' injects files into a context shared with other configs", cfg.Name)
+		}
+
+		if cfg.StableContextPath == "" {
+			continue
+		}
+
+		stablePath := filepath.Clean(cfg.StableContextPath)
+		if stablePaths[stablePath] {
+			return fmt.Sprintf("configs share the stable context path '%s'", cfg.StableContextPath)
+		}
+
+		stablePaths[stablePath] = true
+	}
+
+	return ""
+}
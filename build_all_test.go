@@ -0,0 +1,267 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type BuildAllSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *BuildAllSuite) TestParallel() {
+	started := new(sync.WaitGroup)
+	started.Add(2)
+
+	var mu sync.Mutex
+	builtTo := map[string]string{}
+
+	build := func(ctx context.Context, outputsDir string, req Request) (Response, error) {
+		mu.Lock()
+		builtTo[req.Config.Name] = outputsDir
+		mu.Unlock()
+
+		// wait for the other build to start, so this only passes if they
+		// run concurrently
+		started.Done()
+
+		done := make(chan struct{})
+		go func() {
+			started.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			return Response{}, errors.New("builds did not run concurrently")
+		}
+
+		return Response{Outputs: []string{"image", "cache"}}, nil
+	}
+
+	res, err := buildAll(context.Background(), "/outputs", Request{
+		Configs: []Config{
+			{Name: "api", ContextDir: "services/api"},
+			{Name: "web", ContextDir: "services/web"},
+		},
+	}, build)
+	s.NoError(err)
+
+	s.Equal([]string{"api/image", "api/cache", "web/image", "web/cache"}, res.Outputs)
+	s.Equal(map[string]string{
+		"api": filepath.Join("/outputs", "api"),
+		"web": filepath.Join("/outputs", "web"),
+	}, builtTo)
+}
+
+func (s *BuildAllSuite) TestWarnings() {
+	build := func(ctx context.Context, outputsDir string, req Request) (Response, error) {
+		collector := &warningCollector{}
+		if req.Config.Name == "api" {
+			_, err := collector.Write([]byte(cannedOutput))
+			s.NoError(err)
+		}
+
+		return Response{Outputs: []string{"image"}, Warnings: collector.Warnings()}, nil
+	}
+
+	res, err := buildAll(context.Background(), "/outputs", Request{
+		Configs: []Config{{Name: "api"}, {Name: "web"}},
+	}, build)
+	s.NoError(err)
+
+	s.Equal([]string{
+		`api: LegacyKeyValueFormat: "ENV key=value" should be used instead of legacy "ENV key value" format (line 3)`,
+		`api: FromAsCasing: 'as' and 'FROM' keywords' casing do not match (line 1)`,
+	}, res.Warnings)
+}
+
+func (s *BuildAllSuite) TestStageTimings() {
+	build := func(ctx context.Context, outputsDir string, req Request) (Response, error) {
+		return Response{
+			Outputs:      []string{"image"},
+			StageTimings: map[string]string{"builder": "1s", req.Config.Name: "2s"},
+		}, nil
+	}
+
+	res, err := buildAll(context.Background(), "/outputs", Request{
+		Configs: []Config{{Name: "api"}, {Name: "web"}},
+	}, build)
+	s.NoError(err)
+
+	s.Equal(map[string]string{
+		"api/builder": "1s",
+		"api/api":     "2s",
+		"web/builder": "1s",
+		"web/web":     "2s",
+	}, res.StageTimings)
+}
+
+func (s *BuildAllSuite) TestBoundedParallelism() {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+
+	build := func(ctx context.Context, outputsDir string, req Request) (Response, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		return Response{}, nil
+	}
+
+	_, err := buildAll(context.Background(), "/outputs", Request{
+		Parallelism: 2,
+		Configs: []Config{
+			{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"},
+		},
+	}, build)
+	s.NoError(err)
+	s.Equal(2, maxRunning)
+}
+
+func (s *BuildAllSuite) TestBuilds() {
+	build := func(ctx context.Context, outputsDir string, req Request) (Response, error) {
+		if req.Config.Name == "web" {
+			return Response{Outputs: []string{}, Skipped: true}, nil
+		}
+
+		return Response{
+			Outputs:       []string{"image"},
+			Command:       []string{"buildctl", "build"},
+			CacheDigest:   "sha256:cache",
+			ContextDigest: "sha256:context",
+		}, nil
+	}
+
+	res, err := buildAll(context.Background(), "/outputs", Request{
+		Configs: []Config{{Name: "api"}, {Name: "web"}},
+	}, build)
+	s.NoError(err)
+
+	s.Equal(map[string]Response{
+		"api": {
+			Outputs:       []string{"image"},
+			Command:       []string{"buildctl", "build"},
+			CacheDigest:   "sha256:cache",
+			ContextDigest: "sha256:context",
+		},
+		"web": {Outputs: []string{}, Skipped: true},
+	}, res.Builds)
+}
+
+func (s *BuildAllSuite) TestSequentialWithSharedState() {
+	for _, configs := range [][]Config{
+		{
+			{Name: "a", ContextDir: "src", InjectFiles: map[string]string{"VERSION": "version/number"}},
+			{Name: "b", ContextDir: "src/"},
+		},
+		{
+			{Name: "a", ContextDir: "src/a", StableContextPath: "/tmp/context"},
+			{Name: "b", ContextDir: "src/b", StableContextPath: "/tmp/context"},
+		},
+	} {
+		var mu sync.Mutex
+		running, maxRunning := 0, 0
+
+		build := func(ctx context.Context, outputsDir string, req Request) (Response, error) {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+
+			return Response{}, nil
+		}
+
+		_, err := buildAll(context.Background(), "/outputs", Request{Configs: configs}, build)
+		s.NoError(err)
+		s.Equal(1, maxRunning)
+	}
+}
+
+func (s *BuildAllSuite) TestSharedState() {
+	s.Empty(sharedState([]Config{
+		{Name: "a", ContextDir: "src/a", InjectFiles: map[string]string{"VERSION": "version/number"}},
+		{Name: "b", ContextDir: "src/b", StableContextPath: "/tmp/b"},
+		{Name: "c", ContextDir: "src/b", StableContextPath: "/tmp/c"},
+	}))
+
+	// injected into an overlay of the context
+	s.Empty(sharedState([]Config{
+		{Name: "a", ContextDir: "src", InjectFiles: map[string]string{"VERSION": "version/number"}, ReadOnlyContext: true},
+		{Name: "b", ContextDir: "src"},
+	}))
+
+	s.Contains(sharedState([]Config{
+		{Name: "a", ContextDir: "src", InjectFiles: map[string]string{"VERSION": "version/number"}},
+		{Name: "b", ContextDir: "src", ReadOnlyContext: true},
+	}), "'a' injects files")
+}
+
+func (s *BuildAllSuite) TestAggregatesErrors() {
+	build := func(ctx context.Context, outputsDir string, req Request) (Response, error) {
+		if req.Config.Name == "web" {
+			return Response{}, errors.New("build: exit status 1")
+		}
+
+		return Response{Outputs: []string{"image"}}, nil
+	}
+
+	res, err := buildAll(context.Background(), "/outputs", Request{
+		Configs: []Config{{Name: "api"}, {Name: "web"}},
+	}, build)
+	s.Error(err)
+	s.Contains(err.Error(), "1 of 2 build(s) failed")
+	s.Contains(err.Error(), "web: build: exit status 1")
+
+	// successful builds are still reported
+	s.Equal([]string{"api/image"}, res.Outputs)
+}
+
+func (s *BuildAllSuite) TestInvalidNames() {
+	build := func(ctx context.Context, outputsDir string, req Request) (Response, error) {
+		s.Fail("should not build")
+		return Response{}, nil
+	}
+
+	for _, configs := range [][]Config{
+		{{Name: ""}},
+		{{Name: "api"}, {Name: "api"}},
+		{{Name: "../api"}},
+		{{Name: ".."}},
+	} {
+		_, err := buildAll(context.Background(), "/outputs", Request{Configs: configs}, build)
+		s.Error(err)
+	}
+}
+
+func TestBuildAll(t *testing.T) {
+	suite.Run(t, &BuildAllSuite{
+		Assertions: require.New(t),
+	})
+}
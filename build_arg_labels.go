@@ -0,0 +1,54 @@
+package task
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// labelsFromBuildArgs returns the labels to set from the values of the given
+// key=value build args. Each of the refs names a build arg, labeling the image
+// with its value under the same name, or under another as <arg>=<label>, e.g.
+// VCS_REF=org.opencontainers.image.revision. A build arg given more than once
+// has its last value, as in the build itself.
+//
+// Secret build args may not be labeled with, since labels are published with
+// the image and aren't redacted from the logged command.
+func labelsFromBuildArgs(buildArgs []string, secretBuildArgs []string, refs []string) ([]string, error) {
+	values := map[string]string{}
+	for _, arg := range buildArgs {
+		segs := strings.SplitN(arg, "=", 2)
+		if len(segs) != 2 {
+			continue
+		}
+
+		values[segs[0]] = segs[1]
+	}
+
+	labels := []string{}
+	for _, ref := range refs {
+		segs := strings.SplitN(ref, "=", 2)
+
+		arg, label := segs[0], segs[0]
+		if len(segs) == 2 {
+			label = segs[1]
+		}
+
+		if arg == "" || label == "" {
+			return nil, errors.Errorf("invalid label from build arg '%s'; must be <arg> or <arg>=<label>", ref)
+		}
+
+		if contains(secretBuildArgs, arg) {
+			return nil, errors.Errorf("build arg '%s' is secret and can't be used as a label", arg)
+		}
+
+		value, found := values[arg]
+		if !found {
+			return nil, errors.Errorf("build arg '%s' to label the image with is not set", arg)
+		}
+
+		labels = append(labels, label+"="+value)
+	}
+
+	return labels, nil
+}
@@ -1,6 +1,7 @@
 package task
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -21,6 +22,9 @@ type Buildkitd struct {
 
 	rootDir string
 	proc    *os.Process
+	exited  chan error
+	flags   []string
+	env     []string
 }
 
 // BuildkitdOpts to provide to Buildkitd
@@ -30,7 +34,93 @@ type BuildkitdOpts struct {
 }
 
 func SpawnBuildkitd(req Request, opts *BuildkitdOpts) (*Buildkitd, error) {
-	err := run(os.Stdout, "setup-cgroups")
+	if req.Config.KeepDaemon && req.Config.BuildkitHostFile == "" {
+		return nil, errors.New("keeping buildkitd running requires a buildkit host file to publish its address to")
+	}
+
+	if req.Config.BuildkitHostFile != "" && req.Config.BuildkitAddr == "" && !req.Config.KeepDaemon {
+		addr, err := readBuildkitHostFile(req.Config.BuildkitHostFile)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Config.BuildkitAddr = addr
+	}
+
+	if req.Config.BuildkitAddr != "" {
+		// bring-your-own daemon; nothing to spawn or configure
+		if len(req.Config.RegistryMirrors) > 0 {
+			logrus.Warn("registry mirrors are ignored when using a remote buildkitd")
+		}
+
+		if req.Config.AppArmorProfile != "" {
+			logrus.Warn("the apparmor profile is ignored when using a remote buildkitd")
+		}
+
+		if req.Config.ContainerdNamespace != "" {
+			logrus.Warn("the containerd namespace is ignored when using a remote buildkitd")
+		}
+
+		if req.Config.BuildkitDebugAddr != "" {
+			logrus.Warn("the debug address is ignored when using a remote buildkitd")
+		}
+
+		if req.Config.Worker != "" {
+			logrus.Warn("the worker is ignored when using a remote buildkitd")
+		}
+
+		if req.Config.RuntimeBinary != "" {
+			logrus.Warn("the runtime binary is ignored when using a remote buildkitd")
+		}
+
+		if len(req.Config.RegistryCACerts) > 0 {
+			logrus.Warn("registry ca certs are ignored when using a remote buildkitd")
+		}
+
+		flags, err := tlsFlags(req.Config)
+		if err != nil {
+			return nil, errors.Wrap(err, "configure tls")
+		}
+
+		logrus.Debugf("using buildkitd at %s", req.Config.BuildkitAddr)
+
+		return &Buildkitd{
+			Addr: req.Config.BuildkitAddr,
+
+			flags: flags,
+		}, nil
+	}
+
+	if req.Config.AppArmorProfile != "" {
+		err := validateApparmorProfile(apparmorProfiles, req.Config.AppArmorProfile)
+		if err != nil {
+			return nil, errors.Wrap(err, "apparmor profile")
+		}
+	}
+
+	if req.Config.RuntimeBinary != "" {
+		err := validateRuntimeBinary(req.Config.Worker, req.Config.RuntimeBinary)
+		if err != nil {
+			return nil, errors.Wrap(err, "runtime binary")
+		}
+	}
+
+	debugFlags, err := debugAddrFlags(req.Config.BuildkitDebugAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	selectedWorkerFlags, err := workerFlags(req.Config.Worker)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateRegistryCACerts(req.Config.RegistryCACerts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = run(os.Stdout, "setup-cgroups")
 	if err != nil {
 		return nil, errors.Wrap(err, "setup cgroups")
 	}
@@ -45,6 +135,13 @@ func SpawnBuildkitd(req Request, opts *BuildkitdOpts) (*Buildkitd, error) {
 		return nil, errors.Wrap(err, "create root dir")
 	}
 
+	if req.Config.MinFreeSpace != "" {
+		err = checkFreeSpace(syscall.Statfs, req.Config.MinFreeSpace, rootDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	sockPath := filepath.Join(rootDir, "buildkitd.sock")
 	logPath := filepath.Join(rootDir, "buildkitd.log")
 
@@ -70,55 +167,75 @@ func SpawnBuildkitd(req Request, opts *BuildkitdOpts) (*Buildkitd, error) {
 		buildkitdFlags = append(buildkitdFlags, "--debug")
 	}
 
-	var cmd *exec.Cmd
-	if os.Getuid() == 0 {
-		cmd = exec.Command("buildkitd", buildkitdFlags...)
-	} else {
-		cmd = exec.Command("rootlesskit", append([]string{"buildkitd"}, buildkitdFlags...)...)
-	}
+	buildkitdFlags = append(buildkitdFlags,
+		entitlementFlags("--allow-insecure-entitlement", req.Config.Entitlements)...)
 
-	// kill buildkitd on exit
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Pdeathsig: syscall.SIGKILL,
-	}
+	buildkitdFlags = append(buildkitdFlags, selectedWorkerFlags...)
+	buildkitdFlags = append(buildkitdFlags, debugFlags...)
 
-	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND, 0600)
-	if err != nil {
-		return nil, errors.Wrap(err, "open log file")
-	}
+	var cmd *exec.Cmd
+	var exited chan error
 
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
+	if req.Config.RootlessUID != 0 || req.Config.RootlessGID != 0 {
+		// make sure the rootless user can use the root dir
+		uid, gid := rootlessIDs(req.Config)
 
-	err = cmd.Start()
-	if err != nil {
-		return nil, errors.Wrap(err, "start buildkitd")
+		err = os.Chown(rootDir, uid, gid)
+		if err != nil {
+			return nil, errors.Wrap(err, "chown root dir")
+		}
 	}
 
-	err = logFile.Close()
-	if err != nil {
-		return nil, errors.Wrap(err, "close log file")
-	}
+	start := func() error {
+		cmd = buildkitdCommand(os.Getuid(), req.Config, buildkitdFlags)
 
-	for {
-		err := buildctl(addr, ioutil.Discard, "debug", "workers")
-		if err == nil {
-			break
+		logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return errors.Wrap(err, "open log file")
 		}
 
-		err = cmd.Process.Signal(syscall.Signal(0))
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+
+		err = cmd.Start()
 		if err != nil {
-			logrus.Warn("builtkitd process probe failed:", err)
+			return errors.Wrap(err, "start buildkitd")
+		}
 
-			logrus.Warn("dumping buildkit logs due to probe failure")
-			fmt.Fprintln(os.Stderr)
-			dumpLogFile(logPath)
+		err = logFile.Close()
+		if err != nil {
+			return errors.Wrap(err, "close log file")
+		}
 
-			os.Exit(1)
+		exited = make(chan error, 1)
+		go func() {
+			exited <- cmd.Wait()
+		}()
+
+		for {
+			err := buildctl(addr, ioutil.Discard, "debug", "workers")
+			if err == nil {
+				return nil
+			}
+
+			select {
+			case err := <-exited:
+				return errors.Errorf("buildkitd exited during startup: %s", err)
+			default:
+			}
+
+			logrus.Debugf("waiting for buildkitd...")
+			time.Sleep(100 * time.Millisecond)
 		}
+	}
 
-		logrus.Debugf("waiting for buildkitd...")
-		time.Sleep(100 * time.Millisecond)
+	err = retryStart(req.Config.BuildkitStartRetries, buildkitdStartBackoff, start)
+	if err != nil {
+		logrus.Warn("dumping buildkit logs due to startup failure")
+		fmt.Fprintln(os.Stderr)
+		dumpLogFile(logPath)
+
+		return nil, err
 	}
 
 	logrus.Debug("buildkitd started")
@@ -128,35 +245,127 @@ func SpawnBuildkitd(req Request, opts *BuildkitdOpts) (*Buildkitd, error) {
 
 		rootDir: rootDir,
 		proc:    cmd.Process,
+		exited:  exited,
 	}, nil
 }
 
+// buildkitdCommand returns the command for running buildkitd, via rootlesskit
+// if it should be rootless (see runsRootless).
+func buildkitdCommand(uid int, cfg Config, flags []string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runsRootless(uid, cfg) {
+		cmd = exec.Command("rootlesskit", append([]string{"buildkitd"}, flags...)...)
+	} else {
+		cmd = exec.Command("buildkitd", flags...)
+	}
+
+	// kill buildkitd on exit
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Pdeathsig: syscall.SIGKILL,
+	}
+
+	if cfg.RootlessUID != 0 || cfg.RootlessGID != 0 {
+		uid, gid := rootlessIDs(cfg)
+
+		cmd.SysProcAttr.Credential = &syscall.Credential{
+			Uid: uint32(uid),
+			Gid: uint32(gid),
+		}
+	}
+
+	// rootless buildkitd and rootlesskit keep their state in the XDG dirs
+	xdgDirs := []struct {
+		env string
+		dir string
+	}{
+		{"XDG_DATA_HOME", cfg.XDGDataHome},
+		{"XDG_CONFIG_HOME", cfg.XDGConfigHome},
+		{"XDG_RUNTIME_DIR", cfg.XDGRuntimeDir},
+	}
+
+	for _, xdg := range xdgDirs {
+		if xdg.dir == "" {
+			continue
+		}
+
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+
+		cmd.Env = append(cmd.Env, xdg.env+"="+xdg.dir)
+	}
+
+	return cmd
+}
+
+// runsRootless returns whether buildkitd should run rootless: when not running
+// as root or when a rootless user is configured, unless forced either way.
+func runsRootless(uid int, cfg Config) bool {
+	switch {
+	case cfg.ForceRootless:
+		return true
+	case cfg.ForceRoot:
+		return false
+	default:
+		return uid != 0 || cfg.RootlessUID != 0 || cfg.RootlessGID != 0
+	}
+}
+
+// rootlessIDs returns the uid and gid to run rootlesskit as, defaulting to
+// the current ones.
+func rootlessIDs(cfg Config) (int, int) {
+	uid, gid := os.Getuid(), os.Getgid()
+	if cfg.RootlessUID != 0 {
+		uid = cfg.RootlessUID
+	}
+
+	if cfg.RootlessGID != 0 {
+		gid = cfg.RootlessGID
+	}
+
+	return uid, gid
+}
+
 func (buildkitd *Buildkitd) Cleanup() error {
+	if buildkitd.proc == nil {
+		// remote buildkitd; not ours to stop
+		return nil
+	}
+
 	err := buildkitd.proc.Signal(syscall.SIGTERM)
 	if err != nil {
 		return errors.Wrap(err, "terminate buildkitd")
 	}
 
-	_, err = buildkitd.proc.Wait()
-	if err != nil {
+	// buildkitd was already being waited on to detect startup crashes; its
+	// exit status is of no interest here
+	err = <-buildkitd.exited
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
 		return errors.Wrap(err, "wait buildkitd")
 	}
 
 	return nil
 }
 
-func generateConfig(req Request, configPath string) error {
-	var config BuildkitdConfig
+// buildctl runs buildctl against the daemon, including any connection flags
+// (e.g. TLS) it requires.
+func (buildkitd *Buildkitd) buildctl(ctx context.Context, out io.Writer, args ...string) error {
+	flags := make([]string, len(buildkitd.flags), len(buildkitd.flags)+len(args))
+	copy(flags, buildkitd.flags)
 
-	if len(req.Config.RegistryMirrors) > 0 {
-		var registryConfigs map[string]RegistryConfig
-		registryConfigs = make(map[string]RegistryConfig)
-		registryConfigs["docker.io"] = RegistryConfig{
-			Mirrors: req.Config.RegistryMirrors,
-		}
+	return buildctlContext(ctx, buildkitd.Addr, buildkitd.env, out, append(flags, args...)...)
+}
 
-		config.Registries = registryConfigs
-	}
+// withEnv returns a copy of the daemon which runs buildctl with the given env
+// on top of the process's own, e.g. a build's DOCKER_CONFIG.
+func (buildkitd *Buildkitd) withEnv(env []string) *Buildkitd {
+	withEnv := *buildkitd
+	withEnv.env = env
+	return &withEnv
+}
+
+func generateConfig(req Request, configPath string) error {
+	config := newBuildkitdConfig(req.Config)
 
 	err := os.MkdirAll(filepath.Dir(configPath), 0700)
 	if err != nil {
@@ -176,6 +385,48 @@ func generateConfig(req Request, configPath string) error {
 	return f.Close()
 }
 
+func newBuildkitdConfig(cfg Config) BuildkitdConfig {
+	var config BuildkitdConfig
+
+	if len(cfg.RegistryMirrors) > 0 || len(cfg.RegistryCACerts) > 0 {
+		var registryConfigs map[string]RegistryConfig
+		registryConfigs = make(map[string]RegistryConfig)
+
+		if len(cfg.RegistryMirrors) > 0 {
+			registryConfigs["docker.io"] = RegistryConfig{
+				Mirrors: mirrorHosts(cfg.RegistryMirrors),
+			}
+		}
+
+		for registry, certs := range registryCACerts(cfg.RegistryCACerts) {
+			registryConfig := registryConfigs[registry]
+			registryConfig.RootCAs = certs
+			registryConfigs[registry] = registryConfig
+		}
+
+		config.Registries = registryConfigs
+	}
+
+	if cfg.AppArmorProfile != "" || cfg.RuntimeBinary != "" || cfg.ContainerdNamespace != "" {
+		config.Worker = &WorkerConfig{}
+	}
+
+	if cfg.AppArmorProfile != "" || cfg.RuntimeBinary != "" {
+		config.Worker.OCI = &OCIWorkerConfig{
+			ApparmorProfile: cfg.AppArmorProfile,
+			Binary:          cfg.RuntimeBinary,
+		}
+	}
+
+	if cfg.ContainerdNamespace != "" {
+		config.Worker.Containerd = &ContainerdWorkerConfig{
+			Namespace: cfg.ContainerdNamespace,
+		}
+	}
+
+	return config
+}
+
 func dumpLogFile(logPath string) {
 	logFile, err := os.Open(logPath)
 	if err != nil {
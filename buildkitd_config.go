@@ -2,6 +2,21 @@ package task
 
 type BuildkitdConfig struct {
 	Registries map[string]RegistryConfig `toml:"registry"`
+	Worker     *WorkerConfig             `toml:"worker,omitempty"`
+}
+
+type WorkerConfig struct {
+	OCI        *OCIWorkerConfig        `toml:"oci,omitempty"`
+	Containerd *ContainerdWorkerConfig `toml:"containerd,omitempty"`
+}
+
+type OCIWorkerConfig struct {
+	ApparmorProfile string `toml:"apparmor-profile,omitempty"`
+	Binary          string `toml:"binary,omitempty"`
+}
+
+type ContainerdWorkerConfig struct {
+	Namespace string `toml:"namespace,omitempty"`
 }
 
 type RegistryConfig struct {
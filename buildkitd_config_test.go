@@ -0,0 +1,122 @@
+package task
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type BuildkitdConfigSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *BuildkitdConfigSuite) encode(cfg Config) string {
+	buf := new(bytes.Buffer)
+	s.NoError(toml.NewEncoder(buf).Encode(newBuildkitdConfig(cfg)))
+	return buf.String()
+}
+
+func (s *BuildkitdConfigSuite) expected(name string) string {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "buildkitd-config", name))
+	s.NoError(err)
+	return string(content)
+}
+
+func (s *BuildkitdConfigSuite) TestEmpty() {
+	s.Equal("", s.encode(Config{}))
+}
+
+func (s *BuildkitdConfigSuite) TestMirrors() {
+	s.Equal(s.expected("mirrors.toml"), s.encode(Config{RegistryMirrors: []MirrorSpec{{Host: "hub.docker.io"}}}))
+}
+
+func (s *BuildkitdConfigSuite) TestAppArmorProfile() {
+	s.Equal(s.expected("apparmor.toml"), s.encode(Config{AppArmorProfile: "buildkit-hardened"}))
+}
+
+func (s *BuildkitdConfigSuite) TestContainerdNamespace() {
+	s.Equal(s.expected("containerd-namespace.toml"), s.encode(Config{ContainerdNamespace: "ci-builds"}))
+}
+
+func (s *BuildkitdConfigSuite) TestWorkerConfig() {
+	s.Equal(s.expected("worker.toml"), s.encode(Config{AppArmorProfile: "buildkit-hardened", ContainerdNamespace: "ci-builds"}))
+}
+
+func (s *BuildkitdConfigSuite) TestRuntimeBinary() {
+	s.Equal(s.expected("runtime-binary.toml"), s.encode(Config{AppArmorProfile: "buildkit-hardened", RuntimeBinary: "crun"}))
+
+	// as written by SpawnBuildkitd
+	configPath := filepath.Join(s.T().TempDir(), "buildkitd.toml")
+	s.NoError(generateConfig(Request{Config: Config{RuntimeBinary: "/usr/local/bin/crun"}}, configPath))
+
+	var config BuildkitdConfig
+	_, err := toml.DecodeFile(configPath, &config)
+	s.NoError(err)
+	s.Equal("/usr/local/bin/crun", config.Worker.OCI.Binary)
+}
+
+func (s *BuildkitdConfigSuite) TestRegistryCACerts() {
+	s.Equal(s.expected("registry-ca.toml"), s.encode(Config{
+		RegistryMirrors: []MirrorSpec{{Host: "hub.docker.io"}},
+		RegistryCACerts: []string{
+			"docker.io=/certs/docker.pem",
+			"registry.internal:5000=/certs/internal.pem",
+			"registry.internal:5000=/certs/internal-2.pem",
+		},
+	}))
+}
+
+func (s *BuildkitdConfigSuite) TestRegistryCACertsRelative() {
+	certs := registryCACerts([]string{"registry.internal=certs/ca.pem"})
+
+	wd, err := os.Getwd()
+	s.NoError(err)
+	s.Equal(map[string][]string{
+		"registry.internal": {filepath.Join(wd, "certs", "ca.pem")},
+	}, certs)
+}
+
+func (s *BuildkitdConfigSuite) TestValidateRegistryCACerts() {
+	s.NoError(validateRegistryCACerts(nil))
+	s.NoError(validateRegistryCACerts([]string{"registry.internal:5000=testdata/registry-ca/ca.pem"}))
+
+	err := validateRegistryCACerts([]string{"testdata/registry-ca/ca.pem"})
+	s.Error(err)
+	s.Contains(err.Error(), "expected <registry>=<path>")
+
+	err = validateRegistryCACerts([]string{"registry.internal=testdata/registry-ca/missing.pem"})
+	s.Error(err)
+
+	err = validateRegistryCACerts([]string{"registry.internal=testdata/buildkitd-config/mirrors.toml"})
+	s.Error(err)
+	s.Contains(err.Error(), "no certificates")
+}
+
+func (s *BuildkitdConfigSuite) TestValidateApparmorProfile() {
+	profiles := filepath.Join(s.T().TempDir(), "profiles")
+	s.NoError(ioutil.WriteFile(profiles, []byte("docker-default (enforce)\nbuildkit-hardened (enforce)\n/usr/bin/man (complain)\n"), 0644))
+
+	s.NoError(validateApparmorProfile(profiles, "buildkit-hardened"))
+	s.NoError(validateApparmorProfile(profiles, "/usr/bin/man"))
+
+	err := validateApparmorProfile(profiles, "unknown")
+	s.Error(err)
+	s.Contains(err.Error(), "not loaded")
+
+	err = validateApparmorProfile(filepath.Join(s.T().TempDir(), "missing"), "buildkit-hardened")
+	s.Error(err)
+	s.Contains(err.Error(), "not enabled")
+}
+
+func TestBuildkitdConfig(t *testing.T) {
+	suite.Run(t, &BuildkitdConfigSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,28 @@
+package task
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// debugAddrFlags returns the buildkitd flags for serving its debug endpoints
+// (pprof, expvar, and traces) on the given host:port, if set.
+func debugAddrFlags(addr string) ([]string, error) {
+	if addr == "" {
+		return nil, nil
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid debug address '%s'", addr)
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return nil, errors.Errorf("invalid port in debug address '%s'", addr)
+	}
+
+	return []string{"--debugaddr", addr}, nil
+}
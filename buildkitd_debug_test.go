@@ -0,0 +1,42 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type DebugAddrSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *DebugAddrSuite) TestSet() {
+	flags, err := debugAddrFlags("0.0.0.0:6060")
+	s.NoError(err)
+	s.Equal([]string{"--debugaddr", "0.0.0.0:6060"}, flags)
+
+	flags, err = debugAddrFlags(":6060")
+	s.NoError(err)
+	s.Equal([]string{"--debugaddr", ":6060"}, flags)
+}
+
+func (s *DebugAddrSuite) TestUnset() {
+	flags, err := debugAddrFlags("")
+	s.NoError(err)
+	s.Empty(flags)
+}
+
+func (s *DebugAddrSuite) TestInvalid() {
+	for _, addr := range []string{"6060", "localhost", "localhost:http", "localhost:70000", "http://localhost:6060"} {
+		_, err := debugAddrFlags(addr)
+		s.Error(err, addr)
+	}
+}
+
+func TestDebugAddr(t *testing.T) {
+	suite.Run(t, &DebugAddrSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,32 @@
+package task
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// buildkitdStartBackoff is how long to wait before the first restart of a
+// buildkitd which crashed on startup, doubling with each restart.
+const buildkitdStartBackoff = time.Second
+
+// retryStart calls start until it succeeds, restarting up to the given number
+// of times with exponential backoff if it fails.
+func retryStart(retries int, backoff time.Duration, start func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := start()
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= retries {
+			return errors.Wrapf(err, "after %d attempt(s)", attempt+1)
+		}
+
+		logrus.Warnf("%s; restarting in %s", err, backoff)
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,78 @@
+package task
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type RetryStartSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+// flakyStart fails the given number of times before succeeding, like a
+// buildkitd which crashes on startup.
+type flakyStart struct {
+	failures int
+	attempts int
+}
+
+func (fake *flakyStart) start() error {
+	fake.attempts++
+	if fake.attempts <= fake.failures {
+		return errors.New("buildkitd exited during startup: exit status 1")
+	}
+
+	return nil
+}
+
+func (s *RetryStartSuite) TestStartsFirstTime() {
+	fake := &flakyStart{}
+
+	s.NoError(retryStart(3, time.Millisecond, fake.start))
+	s.Equal(1, fake.attempts)
+}
+
+func (s *RetryStartSuite) TestRestartThenSucceed() {
+	fake := &flakyStart{failures: 2}
+
+	s.NoError(retryStart(3, time.Millisecond, fake.start))
+	s.Equal(3, fake.attempts)
+}
+
+func (s *RetryStartSuite) TestRestartsExhausted() {
+	fake := &flakyStart{failures: 10}
+
+	err := retryStart(2, time.Millisecond, fake.start)
+	s.Error(err)
+	s.Contains(err.Error(), "after 3 attempt(s)")
+	s.Contains(err.Error(), "exited during startup")
+	s.Equal(3, fake.attempts)
+}
+
+func (s *RetryStartSuite) TestNoRetries() {
+	fake := &flakyStart{failures: 1}
+
+	s.Error(retryStart(0, time.Millisecond, fake.start))
+	s.Equal(1, fake.attempts)
+}
+
+func (s *RetryStartSuite) TestBackoff() {
+	fake := &flakyStart{failures: 3}
+
+	started := time.Now()
+	s.NoError(retryStart(3, 10*time.Millisecond, fake.start))
+
+	// 10ms + 20ms + 40ms
+	s.GreaterOrEqual(time.Since(started), 70*time.Millisecond)
+}
+
+func TestRetryStart(t *testing.T) {
+	suite.Run(t, &RetryStartSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,115 @@
+package task
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type RootlessSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *RootlessSuite) TestRoot() {
+	cmd := buildkitdCommand(0, Config{}, []string{"--root", "/scratch/buildkitd"})
+
+	s.Equal([]string{"buildkitd", "--root", "/scratch/buildkitd"}, cmd.Args)
+	s.Nil(cmd.SysProcAttr.Credential)
+}
+
+func (s *RootlessSuite) TestNonRootDefaults() {
+	cmd := buildkitdCommand(1000, Config{}, []string{"--root", "/scratch/buildkitd"})
+
+	s.Equal([]string{"rootlesskit", "buildkitd", "--root", "/scratch/buildkitd"}, cmd.Args)
+
+	// runs as the current user
+	s.Nil(cmd.SysProcAttr.Credential)
+}
+
+func (s *RootlessSuite) TestNonRootConfiguredIDs() {
+	cmd := buildkitdCommand(1000, Config{RootlessUID: 100000, RootlessGID: 100001}, nil)
+
+	s.Equal([]string{"rootlesskit", "buildkitd"}, cmd.Args)
+	s.NotNil(cmd.SysProcAttr.Credential)
+	s.Equal(uint32(100000), cmd.SysProcAttr.Credential.Uid)
+	s.Equal(uint32(100001), cmd.SysProcAttr.Credential.Gid)
+}
+
+func (s *RootlessSuite) TestRootWithConfiguredUID() {
+	cmd := buildkitdCommand(0, Config{RootlessUID: 100000}, nil)
+
+	s.Equal([]string{"rootlesskit", "buildkitd"}, cmd.Args)
+	s.Equal(uint32(100000), cmd.SysProcAttr.Credential.Uid)
+	s.Equal(uint32(os.Getgid()), cmd.SysProcAttr.Credential.Gid)
+}
+
+func (s *RootlessSuite) TestForceRootless() {
+	for _, uid := range []int{0, 1000} {
+		cmd := buildkitdCommand(uid, Config{ForceRootless: true}, []string{"--root", "/scratch/buildkitd"})
+
+		s.Equal([]string{"rootlesskit", "buildkitd", "--root", "/scratch/buildkitd"}, cmd.Args, uid)
+		s.Nil(cmd.SysProcAttr.Credential)
+	}
+}
+
+func (s *RootlessSuite) TestForceRoot() {
+	for _, uid := range []int{0, 1000} {
+		cmd := buildkitdCommand(uid, Config{ForceRoot: true}, []string{"--root", "/scratch/buildkitd"})
+
+		s.Equal([]string{"buildkitd", "--root", "/scratch/buildkitd"}, cmd.Args, uid)
+		s.Nil(cmd.SysProcAttr.Credential)
+	}
+}
+
+func (s *RootlessSuite) TestForceSanitize() {
+	cfg := Config{ForceRoot: true, ForceRootless: true}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{ForceRoot: true, RootlessUID: 100000}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{ForceRootless: true, RootlessUID: 100000}
+	s.NoError(sanitize(&cfg))
+}
+
+func (s *RootlessSuite) TestXDGDirs() {
+	cmd := buildkitdCommand(1000, Config{
+		XDGDataHome:   "/scratch/xdg/data",
+		XDGConfigHome: "/scratch/xdg/config",
+		XDGRuntimeDir: "/scratch/xdg/run",
+	}, nil)
+
+	s.Subset(cmd.Env, []string{
+		"XDG_DATA_HOME=/scratch/xdg/data",
+		"XDG_CONFIG_HOME=/scratch/xdg/config",
+		"XDG_RUNTIME_DIR=/scratch/xdg/run",
+	})
+
+	// the rest of the env is passed through
+	s.Subset(cmd.Env, os.Environ())
+}
+
+func (s *RootlessSuite) TestXDGDirsOverrideEnv() {
+	s.T().Setenv("XDG_DATA_HOME", "/home/user/.local/share")
+
+	cmd := buildkitdCommand(1000, Config{XDGDataHome: "/scratch/xdg/data"}, nil)
+
+	// the last value wins
+	s.Equal("XDG_DATA_HOME=/scratch/xdg/data", cmd.Env[len(cmd.Env)-1])
+}
+
+func (s *RootlessSuite) TestXDGDirsDefault() {
+	cmd := buildkitdCommand(1000, Config{}, nil)
+
+	// inherits the task's env
+	s.Nil(cmd.Env)
+}
+
+func TestRootless(t *testing.T) {
+	suite.Run(t, &RootlessSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,106 @@
+package task
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Serve publishes the address of the spawned buildkitd to the given file, for
+// other builds to use via BuildkitHostFile, and keeps it running until the
+// context is done (e.g. the task is signaled to stop), removing the file
+// again. It fails if buildkitd exits first.
+func (buildkitd *Buildkitd) Serve(ctx context.Context, addrFile string) error {
+	if buildkitd.proc == nil {
+		return errors.New("only a spawned buildkitd can be kept running, not a remote one")
+	}
+
+	if addrFile == "" {
+		// there's no default, as builds only read the file when given it too
+		return errors.New("no buildkit host file to publish the address to")
+	}
+
+	err := writeBuildkitHostFile(addrFile, buildkitd.Addr)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := os.Remove(addrFile)
+		if err != nil && !os.IsNotExist(err) {
+			logrus.Warn("failed to remove buildkitd address file:", err)
+		}
+	}()
+
+	logrus.Infof("buildkitd is listening at %s, as published to %s; waiting to be stopped", buildkitd.Addr, addrFile)
+
+	select {
+	case <-ctx.Done():
+		logrus.Info("stopping buildkitd")
+		return nil
+	case err := <-buildkitd.exited:
+		// nothing left for Cleanup to stop
+		buildkitd.proc = nil
+
+		if err == nil {
+			return errors.New("buildkitd exited unexpectedly")
+		}
+
+		return errors.Wrap(err, "buildkitd exited unexpectedly")
+	}
+}
+
+// writeBuildkitHostFile writes the address to the file, replacing it
+// atomically so that a build never reads a partial address.
+func writeBuildkitHostFile(path string, addr string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return errors.Wrap(err, "create buildkitd address dir")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "create buildkitd address file")
+	}
+
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(addr + "\n")
+	if err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "write buildkitd address file")
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return errors.Wrap(err, "write buildkitd address file")
+	}
+
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return errors.Wrap(err, "chmod buildkitd address file")
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// readBuildkitHostFile returns the address in the file, as written by
+// `build daemon`.
+func readBuildkitHostFile(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "read buildkitd address file")
+	}
+
+	addr := strings.TrimSpace(string(contents))
+	if addr == "" {
+		return "", errors.Errorf("buildkitd address file %s is empty", path)
+	}
+
+	return addr, nil
+}
@@ -0,0 +1,169 @@
+package task
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type BuildkitdServeSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+// fakeBuildkitd starts a stand-in for a spawned buildkitd.
+func (s *BuildkitdServeSuite) fakeBuildkitd() *Buildkitd {
+	cmd := exec.Command("sleep", "60")
+	s.NoError(cmd.Start())
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	return &Buildkitd{
+		Addr:   "unix:///tmp/buildkitd/buildkitd.sock",
+		proc:   cmd.Process,
+		exited: exited,
+	}
+}
+
+func (s *BuildkitdServeSuite) waitForFile(path string) string {
+	var contents []byte
+	s.Eventually(func() bool {
+		var err error
+		contents, err = ioutil.ReadFile(path)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return string(contents)
+}
+
+func (s *BuildkitdServeSuite) TestPublishesAddr() {
+	buildkitd := s.fakeBuildkitd()
+	addrFile := filepath.Join(s.T().TempDir(), "shared", "buildkitd.addr")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- buildkitd.Serve(ctx, addrFile)
+	}()
+
+	s.Equal("unix:///tmp/buildkitd/buildkitd.sock\n", s.waitForFile(addrFile))
+
+	addr, err := readBuildkitHostFile(addrFile)
+	s.NoError(err)
+	s.Equal("unix:///tmp/buildkitd/buildkitd.sock", addr)
+
+	cancel()
+	s.NoError(<-served)
+
+	_, err = os.Stat(addrFile)
+	s.True(os.IsNotExist(err))
+
+	s.NoError(buildkitd.Cleanup())
+}
+
+func (s *BuildkitdServeSuite) TestStopsOnSignal() {
+	buildkitd := s.fakeBuildkitd()
+	addrFile := filepath.Join(s.T().TempDir(), "buildkitd.addr")
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- buildkitd.Serve(ctx, addrFile)
+	}()
+
+	s.waitForFile(addrFile)
+
+	s.NoError(syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+	select {
+	case err := <-served:
+		s.NoError(err)
+	case <-time.After(5 * time.Second):
+		s.Fail("not stopped by signal")
+	}
+
+	_, err := os.Stat(addrFile)
+	s.True(os.IsNotExist(err))
+
+	s.NoError(buildkitd.Cleanup())
+}
+
+func (s *BuildkitdServeSuite) TestBuildkitdExits() {
+	buildkitd := s.fakeBuildkitd()
+	addrFile := filepath.Join(s.T().TempDir(), "buildkitd.addr")
+
+	served := make(chan error, 1)
+	go func() {
+		served <- buildkitd.Serve(context.Background(), addrFile)
+	}()
+
+	s.waitForFile(addrFile)
+
+	s.NoError(buildkitd.proc.Kill())
+
+	err := <-served
+	s.Error(err)
+	s.Contains(err.Error(), "exited unexpectedly")
+
+	_, err = os.Stat(addrFile)
+	s.True(os.IsNotExist(err))
+
+	// already gone
+	s.NoError(buildkitd.Cleanup())
+}
+
+func (s *BuildkitdServeSuite) TestRemote() {
+	buildkitd := &Buildkitd{Addr: "tcp://buildkitd:1234"}
+
+	err := buildkitd.Serve(context.Background(), filepath.Join(s.T().TempDir(), "buildkitd.addr"))
+	s.Error(err)
+}
+
+func (s *BuildkitdServeSuite) TestNoHostFile() {
+	buildkitd := s.fakeBuildkitd()
+	defer buildkitd.proc.Kill()
+
+	err := buildkitd.Serve(context.Background(), "")
+	s.Error(err)
+
+	_, err = SpawnBuildkitd(Request{Config: Config{KeepDaemon: true}}, nil)
+	s.Error(err)
+}
+
+func (s *BuildkitdServeSuite) TestReadEmpty() {
+	addrFile := filepath.Join(s.T().TempDir(), "buildkitd.addr")
+	s.NoError(ioutil.WriteFile(addrFile, []byte("\n"), 0644))
+
+	_, err := readBuildkitHostFile(addrFile)
+	s.Error(err)
+}
+
+func (s *BuildkitdServeSuite) TestSpawnFromHostFile() {
+	addrFile := filepath.Join(s.T().TempDir(), "buildkitd.addr")
+	s.NoError(ioutil.WriteFile(addrFile, []byte("unix:///tmp/buildkitd/buildkitd.sock\n"), 0644))
+
+	buildkitd, err := SpawnBuildkitd(Request{Config: Config{BuildkitHostFile: addrFile}}, nil)
+	s.NoError(err)
+	s.Equal("unix:///tmp/buildkitd/buildkitd.sock", buildkitd.Addr)
+}
+
+func TestBuildkitdServe(t *testing.T) {
+	suite.Run(t, &BuildkitdServeSuite{
+		Assertions: require.New(t),
+	})
+}
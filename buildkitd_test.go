@@ -57,7 +57,7 @@ func (s *BuildkitdSuite) TestNoConfig() {
 func (s *BuildkitdSuite) TestGenerateConfig() {
 	var err error
 
-	s.req.Config.RegistryMirrors = []string{"hub.docker.io"}
+	s.req.Config.RegistryMirrors = []task.MirrorSpec{{Host: "hub.docker.io"}}
 
 	s.buildkitd, err = task.SpawnBuildkitd(s.req, &task.BuildkitdOpts{
 		ConfigPath: s.configPath("mirrors.toml"),
@@ -73,6 +73,24 @@ func (s *BuildkitdSuite) TestGenerateConfig() {
 	s.Equal(expectedContent, configContent)
 }
 
+func (s *BuildkitdSuite) TestRemoteAddr() {
+	s.req.Config.BuildkitAddr = "tcp://buildkitd.example.com:1234"
+	s.req.Config.RegistryMirrors = []task.MirrorSpec{{Host: "hub.docker.io"}}
+
+	remote, err := task.SpawnBuildkitd(s.req, &task.BuildkitdOpts{
+		ConfigPath: s.configPath("mirrors.toml"),
+	})
+	s.NoError(err)
+	s.Equal("tcp://buildkitd.example.com:1234", remote.Addr)
+
+	// no daemon was spawned, so no config was generated for it
+	_, err = os.Stat(s.configPath("mirrors.toml"))
+	s.True(os.IsNotExist(err))
+
+	err = remote.Cleanup()
+	s.NoError(err)
+}
+
 func (s *BuildkitdSuite) configPath(path ...string) string {
 	return filepath.Join(append([]string{s.outputsDir, "config"}, path...)...)
 }
@@ -0,0 +1,64 @@
+package task
+
+import (
+	"net/url"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// tlsFlags returns the buildctl flags for connecting to a remote buildkitd
+// over TLS. They only apply to TCP addresses; for anything else (i.e. unix
+// sockets) no flags are returned.
+func tlsFlags(cfg Config) ([]string, error) {
+	files := []struct {
+		flag string
+		path string
+	}{
+		{"--tlscacert", cfg.BuildkitCACert},
+		{"--tlscert", cfg.BuildkitCert},
+		{"--tlskey", cfg.BuildkitKey},
+	}
+
+	configured := cfg.BuildkitServerName != ""
+	for _, f := range files {
+		if f.path != "" {
+			configured = true
+		}
+	}
+
+	if !configured {
+		return nil, nil
+	}
+
+	addr, err := url.Parse(cfg.BuildkitAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse buildkit addr")
+	}
+
+	if addr.Scheme != "tcp" {
+		logrus.Warnf("ignoring buildkit TLS config for non-TCP address %s", cfg.BuildkitAddr)
+		return nil, nil
+	}
+
+	var flags []string
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+
+		_, err := os.Stat(f.path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s", f.flag)
+		}
+
+		flags = append(flags, f.flag+"="+f.path)
+	}
+
+	if cfg.BuildkitServerName != "" {
+		flags = append(flags, "--tlsservername="+cfg.BuildkitServerName)
+	}
+
+	return flags, nil
+}
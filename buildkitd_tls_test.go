@@ -0,0 +1,98 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TLSSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	certsDir string
+}
+
+func (s *TLSSuite) SetupTest() {
+	var err error
+	s.certsDir, err = ioutil.TempDir("", "oci-build-task-tls")
+	s.NoError(err)
+
+	for _, name := range []string{"ca.pem", "cert.pem", "key.pem"} {
+		err := ioutil.WriteFile(s.certPath(name), []byte("not really a pem"), 0600)
+		s.NoError(err)
+	}
+}
+
+func (s *TLSSuite) TearDownTest() {
+	err := os.RemoveAll(s.certsDir)
+	s.NoError(err)
+}
+
+func (s *TLSSuite) TestTCPAddr() {
+	flags, err := tlsFlags(Config{
+		BuildkitAddr:       "tcp://buildkitd.example.com:1234",
+		BuildkitCACert:     s.certPath("ca.pem"),
+		BuildkitCert:       s.certPath("cert.pem"),
+		BuildkitKey:        s.certPath("key.pem"),
+		BuildkitServerName: "buildkitd.example.com",
+	})
+	s.NoError(err)
+	s.Equal([]string{
+		"--tlscacert=" + s.certPath("ca.pem"),
+		"--tlscert=" + s.certPath("cert.pem"),
+		"--tlskey=" + s.certPath("key.pem"),
+		"--tlsservername=buildkitd.example.com",
+	}, flags)
+}
+
+func (s *TLSSuite) TestTCPAddrCAOnly() {
+	flags, err := tlsFlags(Config{
+		BuildkitAddr:   "tcp://buildkitd.example.com:1234",
+		BuildkitCACert: s.certPath("ca.pem"),
+	})
+	s.NoError(err)
+	s.Equal([]string{"--tlscacert=" + s.certPath("ca.pem")}, flags)
+}
+
+func (s *TLSSuite) TestUnixAddr() {
+	flags, err := tlsFlags(Config{
+		BuildkitAddr:   "unix:///run/buildkit/buildkitd.sock",
+		BuildkitCACert: s.certPath("ca.pem"),
+		BuildkitCert:   s.certPath("cert.pem"),
+		BuildkitKey:    s.certPath("key.pem"),
+	})
+	s.NoError(err)
+	s.Empty(flags)
+}
+
+func (s *TLSSuite) TestNoTLSConfig() {
+	flags, err := tlsFlags(Config{
+		BuildkitAddr: "tcp://buildkitd.example.com:1234",
+	})
+	s.NoError(err)
+	s.Empty(flags)
+}
+
+func (s *TLSSuite) TestMissingFile() {
+	_, err := tlsFlags(Config{
+		BuildkitAddr:   "tcp://buildkitd.example.com:1234",
+		BuildkitCACert: s.certPath("bogus.pem"),
+	})
+	s.Error(err)
+	s.Contains(err.Error(), "--tlscacert")
+}
+
+func (s *TLSSuite) certPath(name string) string {
+	return filepath.Join(s.certsDir, name)
+}
+
+func TestTLS(t *testing.T) {
+	suite.Run(t, &TLSSuite{
+		Assertions: require.New(t),
+	})
+}
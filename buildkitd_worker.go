@@ -0,0 +1,38 @@
+package task
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// workerFlags returns the buildkitd flags for enabling only the given worker,
+// 'oci' or 'containerd'. When unset, buildkitd's defaults apply, i.e. the oci
+// worker, or the containerd worker if there is no runc.
+func workerFlags(worker string) ([]string, error) {
+	switch worker {
+	case "":
+		return nil, nil
+	case "oci":
+		return []string{"--oci-worker=true", "--containerd-worker=false"}, nil
+	case "containerd":
+		return []string{"--oci-worker=false", "--containerd-worker=true"}, nil
+	default:
+		return nil, errors.Errorf("unknown worker '%s'; must be 'oci' or 'containerd'", worker)
+	}
+}
+
+// validateRuntimeBinary checks that the OCI runtime binary for the oci worker
+// to run containers with, e.g. crun, exists, either as a path or in the PATH.
+func validateRuntimeBinary(worker string, binary string) error {
+	if worker == "containerd" {
+		return errors.New("only supported with the oci worker")
+	}
+
+	_, err := exec.LookPath(binary)
+	if err != nil {
+		return errors.Errorf("'%s' not found", binary)
+	}
+
+	return nil
+}
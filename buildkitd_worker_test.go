@@ -0,0 +1,57 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type WorkerSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *WorkerSuite) TestOCI() {
+	flags, err := workerFlags("oci")
+	s.NoError(err)
+	s.Equal([]string{"--oci-worker=true", "--containerd-worker=false"}, flags)
+}
+
+func (s *WorkerSuite) TestContainerd() {
+	flags, err := workerFlags("containerd")
+	s.NoError(err)
+	s.Equal([]string{"--oci-worker=false", "--containerd-worker=true"}, flags)
+}
+
+func (s *WorkerSuite) TestDefault() {
+	flags, err := workerFlags("")
+	s.NoError(err)
+	s.Empty(flags)
+}
+
+func (s *WorkerSuite) TestUnknown() {
+	_, err := workerFlags("runc")
+	s.Error(err)
+	s.Contains(err.Error(), "unknown worker 'runc'")
+}
+
+func (s *WorkerSuite) TestValidateRuntimeBinary() {
+	// any binary in the PATH will do
+	s.NoError(validateRuntimeBinary("", "sh"))
+	s.NoError(validateRuntimeBinary("oci", "/bin/sh"))
+
+	err := validateRuntimeBinary("oci", "no-such-runtime")
+	s.Error(err)
+	s.Contains(err.Error(), "'no-such-runtime' not found")
+
+	err = validateRuntimeBinary("containerd", "sh")
+	s.Error(err)
+	s.Contains(err.Error(), "only supported with the oci worker")
+}
+
+func TestWorker(t *testing.T) {
+	suite.Run(t, &WorkerSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,110 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// exportCacheArg returns the buildctl --export-cache spec for exporting the
+// cache to the given directory.
+func exportCacheArg(cfg Config, cacheDir string) string {
+	spec := "type=local,mode=max,dest=" + cacheDir
+
+	if cfg.CacheCompression != "" {
+		spec += ",compression=" + cfg.CacheCompression
+	}
+
+	if cfg.CacheCompressionLevel != 0 {
+		spec += ",compression-level=" + strconv.Itoa(cfg.CacheCompressionLevel)
+	}
+
+	return spec
+}
+
+// maxCompressionLevels are the highest compression levels buildkit accepts for
+// each CacheCompression.
+var maxCompressionLevels = map[string]int{
+	"gzip": 9,
+	"zstd": 22,
+}
+
+// validateCacheCompressionLevel checks the level is in range for the
+// compression, which must be given explicitly for its range to be known.
+func validateCacheCompressionLevel(compression string, level int) error {
+	if level == 0 {
+		return nil
+	}
+
+	if compression == "" {
+		return errors.New("cache compression level requires a cache compression")
+	}
+
+	max := maxCompressionLevels[compression]
+	if level < 1 || level > max {
+		return errors.Errorf("cache compression level %d is out of range for %s (1-%d)", level, compression, max)
+	}
+
+	return nil
+}
+
+// cacheDigest returns the digest of the cache manifest exported to the given
+// directory, as recorded in its index.json, for verifying that the cache was
+// actually written.
+func cacheDigest(cacheDir string) (v1.Hash, error) {
+	index, err := os.Open(filepath.Join(cacheDir, "index.json"))
+	if err != nil {
+		return v1.Hash{}, errors.Wrap(err, "open cache index")
+	}
+
+	defer index.Close()
+
+	manifest, err := v1.ParseIndexManifest(index)
+	if err != nil {
+		return v1.Hash{}, errors.Wrap(err, "parse cache index")
+	}
+
+	if len(manifest.Manifests) == 0 {
+		return v1.Hash{}, errors.New("no cache manifest in cache index")
+	}
+
+	return manifest.Manifests[0].Digest, nil
+}
+
+// cacheSignatureName is the name of the cache manifest's signature, written to
+// the cache directory alongside its index.json.
+const cacheSignatureName = "cache.sig"
+
+// cacheManifestPath returns the path of the cache manifest blob with the given
+// digest in the cache directory.
+func cacheManifestPath(cacheDir string, digest v1.Hash) string {
+	return filepath.Join(cacheDir, "blobs", digest.Algorithm, digest.Hex)
+}
+
+// cosignSignBlobCommand returns the command for signing the blob with the
+// given cosign key, which may be a path or a KMS URI, writing the signature
+// to the given path.
+func cosignSignBlobCommand(key string, blob string, signature string) []string {
+	return []string{"cosign", "sign-blob", "--yes", "--key", key, "--output-signature", signature, blob}
+}
+
+// signCache signs the manifest of the cache exported to the given directory
+// with cosign, so that it can be verified before being imported.
+func signCache(cacheDir string, digest v1.Hash, key string) error {
+	cmd := cosignSignBlobCommand(key, cacheManifestPath(cacheDir, digest), filepath.Join(cacheDir, cacheSignatureName))
+
+	logrus.Infof("signing cache manifest %s", digest)
+	logrus.Debugf("running %s", strings.Join(cmd, " "))
+
+	err := run(os.Stderr, cmd[0], cmd[1:]...)
+	if err != nil {
+		return errors.Wrap(err, "sign cache manifest")
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package task
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type CacheSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *CacheSuite) TestExportCacheArg() {
+	s.Equal(
+		"type=local,mode=max,dest=/outputs/cache",
+		exportCacheArg(Config{}, "/outputs/cache"),
+	)
+}
+
+func (s *CacheSuite) TestExportCacheArgCompression() {
+	s.Equal(
+		"type=local,mode=max,dest=/outputs/cache,compression=zstd",
+		exportCacheArg(Config{CacheCompression: "zstd"}, "/outputs/cache"),
+	)
+}
+
+func (s *CacheSuite) TestSanitizeCacheCompression() {
+	for _, compression := range []string{"", "gzip", "zstd"} {
+		cfg := Config{CacheCompression: compression}
+		s.NoError(sanitize(&cfg), compression)
+	}
+
+	cfg := Config{CacheCompression: "bzip2"}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "bzip2")
+}
+
+func (s *CacheSuite) TestExportCacheArgCompressionLevel() {
+	s.Equal(
+		"type=local,mode=max,dest=/outputs/cache,compression=zstd,compression-level=19",
+		exportCacheArg(Config{CacheCompression: "zstd", CacheCompressionLevel: 19}, "/outputs/cache"),
+	)
+}
+
+func (s *CacheSuite) TestSanitizeCacheCompressionLevel() {
+	for _, cfg := range []Config{
+		{CacheCompression: "gzip", CacheCompressionLevel: 1},
+		{CacheCompression: "gzip", CacheCompressionLevel: 9},
+		{CacheCompression: "zstd", CacheCompressionLevel: 22},
+		{CacheCompression: "zstd"},
+	} {
+		s.NoError(sanitize(&cfg), "%s %d", cfg.CacheCompression, cfg.CacheCompressionLevel)
+	}
+
+	for _, cfg := range []Config{
+		{CacheCompression: "gzip", CacheCompressionLevel: 10},
+		{CacheCompression: "zstd", CacheCompressionLevel: 23},
+		{CacheCompression: "zstd", CacheCompressionLevel: -1},
+	} {
+		err := sanitize(&cfg)
+		s.Error(err, "%s %d", cfg.CacheCompression, cfg.CacheCompressionLevel)
+		s.Contains(err.Error(), "out of range")
+	}
+
+	cfg := Config{CacheCompressionLevel: 3}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "requires a cache compression")
+}
+
+func (s *CacheSuite) TestCacheDigest() {
+	digest, err := cacheDigest("testdata/cache-export")
+	s.NoError(err)
+	s.Equal("sha256:3f1b0a3bd78ab4f5a2e1f0bdf1e7c7caf1bde6a35a0ea8ab5809e9f0c2e46f33", digest.String())
+}
+
+func (s *CacheSuite) TestCacheDigestUnavailable() {
+	dir := s.T().TempDir()
+
+	_, err := cacheDigest(dir)
+	s.Error(err)
+
+	s.NoError(ioutil.WriteFile(filepath.Join(dir, "index.json"), []byte(`{"schemaVersion":2,"manifests":[]}`), 0644))
+
+	_, err = cacheDigest(dir)
+	s.Error(err)
+	s.Contains(err.Error(), "no cache manifest")
+}
+
+func (s *CacheSuite) TestCosignSignBlobCommand() {
+	digest, err := cacheDigest("testdata/cache-export")
+	s.NoError(err)
+
+	s.Equal(
+		filepath.Join("testdata", "cache-export", "blobs", "sha256", "3f1b0a3bd78ab4f5a2e1f0bdf1e7c7caf1bde6a35a0ea8ab5809e9f0c2e46f33"),
+		cacheManifestPath("testdata/cache-export", digest),
+	)
+
+	s.Equal(
+		[]string{
+			"cosign", "sign-blob", "--yes", "--key", "cosign.key",
+			"--output-signature", "/outputs/cache/cache.sig",
+			"/outputs/cache/blobs/sha256/3f1b0a3bd78ab4f5a2e1f0bdf1e7c7caf1bde6a35a0ea8ab5809e9f0c2e46f33",
+		},
+		cosignSignBlobCommand("cosign.key", cacheManifestPath("/outputs/cache", digest), "/outputs/cache/cache.sig"),
+	)
+
+	s.Equal(
+		[]string{
+			"cosign", "sign-blob", "--yes", "--key", "awskms:///alias/cache",
+			"--output-signature", "/outputs/cache/cache.sig", "/outputs/cache/blobs/sha256/abc",
+		},
+		cosignSignBlobCommand("awskms:///alias/cache", "/outputs/cache/blobs/sha256/abc", "/outputs/cache/cache.sig"),
+	)
+}
+
+func (s *CacheSuite) TestSanitizeSignCache() {
+	cfg := Config{SignCache: true}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "cache signing key")
+
+	cfg = Config{SignCache: true, CacheSigningKey: "cosign.key", WarmOnly: true}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{SignCache: true, CacheSigningKey: "cosign.key"}
+	s.NoError(sanitize(&cfg))
+}
+
+func TestCache(t *testing.T) {
+	suite.Run(t, &CacheSuite{
+		Assertions: require.New(t),
+	})
+}
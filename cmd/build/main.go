@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/sirupsen/logrus"
 	task "github.com/concourse/oci-build-task"
@@ -18,6 +20,7 @@ const labelPrefix = "LABEL_"
 
 const buildkitSecretPrefix = "BUILDKIT_SECRET_"
 const buildkitSecretTextPrefix = "BUILDKIT_SECRETTEXT_"
+const buildkitSecretEnvPrefix = "BUILDKIT_SECRETENV_"
 
 func main() {
 	req := task.Request{
@@ -67,6 +70,41 @@ func main() {
 			err := task.StoreSecret(&req, seg[0], seg[1])
 			failIf("store secret provided as text", err)
 		}
+
+		if strings.HasPrefix(env, buildkitSecretEnvPrefix) {
+			seg := strings.SplitN(
+				strings.TrimPrefix(env, buildkitSecretEnvPrefix), "=", 2)
+
+			if req.Config.SecretsEnv == nil {
+				req.Config.SecretsEnv = make(map[string]string)
+			}
+
+			req.Config.SecretsEnv[seg[0]] = seg[1]
+		}
+	}
+
+	// INJECT_FILES is a comma-separated list of dest=src pairs
+	if injectFiles := os.Getenv("INJECT_FILES"); injectFiles != "" {
+		req.Config.InjectFiles = make(map[string]string)
+
+		for _, pair := range strings.Split(injectFiles, ",") {
+			seg := strings.SplitN(pair, "=", 2)
+			if len(seg) != 2 {
+				logrus.Fatalf("invalid INJECT_FILES entry '%s'; expected dest=src", pair)
+			}
+
+			req.Config.InjectFiles[seg[0]] = seg[1]
+		}
+	}
+
+	// `build warm` only warms the cache, without producing an image
+	if len(os.Args) > 1 && os.Args[1] == "warm" {
+		req.Config.WarmOnly = true
+	}
+
+	// `build daemon` keeps buildkitd running for other builds to use
+	if len(os.Args) > 1 && os.Args[1] == "daemon" {
+		req.Config.KeepDaemon = true
 	}
 
 	logrus.Debugf("read config from env: %#v\n", req.Config)
@@ -79,7 +117,21 @@ func main() {
 	task.Stdout = os.Stdout
 	task.Stderr = os.Stderr
 
-	err = task.Run()
+	err = task.Start()
+	failIf("run task", err)
+
+	// pass on signals so that the task can stop gracefully, e.g. when `build
+	// daemon` is stopped
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	go func() {
+		for sig := range signals {
+			task.Process.Signal(sig)
+		}
+	}()
+
+	err = task.Wait()
 	failIf("run task", err)
 }
 
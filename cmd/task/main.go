@@ -1,45 +1,80 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/sirupsen/logrus"
-	"github.com/u-root/u-root/pkg/termios"
 	task "github.com/concourse/oci-build-task"
 )
 
 func main() {
-	var req task.Request
-	err := json.NewDecoder(os.Stdin).Decode(&req)
+	req, err := task.ReadRequest(os.Stdin)
 	failIf("read request", err)
 
+	err = task.LoadParamsFile(&req.Config)
+	failIf("load params file", err)
+
 	wd, err := os.Getwd()
 	failIf("get root path", err)
 
-	// limit max columns; Concourse sets a super high value and buildctl happily
-	// fills the whole screen with whitespace
-	ws, err := termios.GetWinSize(os.Stdout.Fd())
-	if err == nil {
-		ws.Col = 100
-
-		err = termios.SetWinSize(os.Stdout.Fd(), ws)
-		if err != nil {
-			logrus.Warn("failed to set window size:", err)
-		}
+	err = task.ResizeTerminal(os.Stdout.Fd(), req.Config.TerminalWidth)
+	if err != nil {
+		logrus.Warn("failed to set window size:", err)
 	}
 
+	// stop the build when aborted, rather than being killed mid-write
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
 	var opts task.BuildkitdOpts
 	if _, err := os.Stat("/scratch"); err == nil {
 		opts.RootDir = "/scratch/buildkitd"
 	}
 
+	// held until buildkitd is cleaned up, as it guards buildkitd's root
+	if req.Config.LockFile != "" {
+		lock, err := task.AcquireLock(ctx, req.Config.LockFile, req.Config.LockTimeout)
+		failIf("acquire lock", err)
+
+		defer lock.Release()
+	}
+
 	buildkitd, err := task.SpawnBuildkitd(req, &opts)
 	failIf("start buildkitd", err)
 
-	res, err := task.Build(buildkitd, wd, req)
+	if req.Config.KeepDaemon {
+		err = buildkitd.Serve(ctx, req.Config.BuildkitHostFile)
+		if err != nil {
+			buildkitd.Cleanup()
+		}
+		failIf("keep buildkitd running", err)
+
+		err = buildkitd.Cleanup()
+		failIf("cleanup buildkitd", err)
+
+		return
+	}
+
+	var res task.Response
+	if len(req.Configs) > 0 {
+		res, err = task.BuildAll(ctx, buildkitd, wd, req)
+	} else {
+		res, err = task.BuildContext(ctx, buildkitd, wd, req)
+	}
 	if err != nil {
 		buildkitd.Cleanup()
+
+		if ctx.Err() != nil {
+			logrus.Warn("interrupted; removing partial outputs")
+
+			cleanupErr := task.RemovePartialOutputs(wd, req)
+			if cleanupErr != nil {
+				logrus.Warn("failed to remove partial outputs:", cleanupErr)
+			}
+		}
 	}
 	failIf("build", err)
 
@@ -49,7 +84,7 @@ func main() {
 	responseFile, err := os.Create(req.ResponsePath)
 	failIf("open response path", err)
 
-	err = json.NewEncoder(responseFile).Encode(res)
+	err = task.WriteResponse(responseFile, res, req.Config.ResponseFormat)
 	failIf("write response", err)
 
 	err = responseFile.Close()
@@ -0,0 +1,139 @@
+package task
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/pkg/errors"
+)
+
+// overrideImageConfig sets the entrypoint and/or cmd in the config of the
+// image tarball at imagePath, re-packing it in place with the same tags. A nil
+// entrypoint or cmd is left as-is, except that, as with the Dockerfile's
+// ENTRYPOINT, overriding the entrypoint alone clears the cmd.
+func overrideImageConfig(imagePath string, entrypoint []string, cmd []string) error {
+	return rewriteImageTarball(imagePath, func(image v1.Image) (v1.Image, error) {
+		configFile, err := image.ConfigFile()
+		if err != nil {
+			return nil, errors.Wrap(err, "get image config")
+		}
+
+		config := *configFile.Config.DeepCopy()
+		config = overrideConfig(config, entrypoint, cmd)
+
+		image, err = mutate.Config(image, config)
+		if err != nil {
+			return nil, errors.Wrap(err, "override image config")
+		}
+
+		return image, nil
+	})
+}
+
+// rewriteImageTarball replaces the image in the tarball at imagePath with the
+// result of rewrite, re-packing it in place with the same tags.
+func rewriteImageTarball(imagePath string, rewrite func(v1.Image) (v1.Image, error)) error {
+	manifest, err := tarball.LoadManifest(func() (io.ReadCloser, error) {
+		return os.Open(imagePath)
+	})
+	if err != nil {
+		return errors.Wrap(err, "load image manifest")
+	}
+
+	if len(manifest) != 1 {
+		return errors.Errorf("expected 1 image in %s, found %d", imagePath, len(manifest))
+	}
+
+	image, err := tarball.ImageFromPath(imagePath, nil)
+	if err != nil {
+		return errors.Wrap(err, "open image")
+	}
+
+	image, err = rewrite(image)
+	if err != nil {
+		return err
+	}
+
+	refs, err := imageRefs(manifest[0].RepoTags, image)
+	if err != nil {
+		return err
+	}
+
+	refToImage := map[name.Reference]v1.Image{}
+	for _, ref := range refs {
+		refToImage[ref] = image
+	}
+
+	// the layers are read from the original tarball as it's written, so it
+	// can't be overwritten until the new one is complete
+	rewritten, err := ioutil.TempFile(filepath.Dir(imagePath), "image-*.tar")
+	if err != nil {
+		return errors.Wrap(err, "create image")
+	}
+
+	rewritten.Close()
+	defer os.Remove(rewritten.Name())
+
+	err = tarball.MultiRefWriteToFile(rewritten.Name(), refToImage)
+	if err != nil {
+		return errors.Wrap(err, "write image")
+	}
+
+	err = os.Rename(rewritten.Name(), imagePath)
+	if err != nil {
+		return errors.Wrap(err, "replace image")
+	}
+
+	return nil
+}
+
+// overrideConfig returns the config with the entrypoint and/or cmd replaced.
+func overrideConfig(config v1.Config, entrypoint []string, cmd []string) v1.Config {
+	if entrypoint != nil {
+		config.Entrypoint = entrypoint
+		config.Cmd = nil
+	}
+
+	if cmd != nil {
+		config.Cmd = cmd
+	}
+
+	return config
+}
+
+// imageRefs returns the references to write the image tarball with: its
+// existing tags, or just its digest if it has none, so that it stays
+// untagged.
+func imageRefs(repoTags []string, image v1.Image) ([]name.Reference, error) {
+	refs := []name.Reference{}
+	for _, repoTag := range repoTags {
+		tag, err := name.NewTag(repoTag)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse image tag '%s'", repoTag)
+		}
+
+		refs = append(refs, tag)
+	}
+
+	if len(refs) > 0 {
+		return refs, nil
+	}
+
+	digest, err := image.Digest()
+	if err != nil {
+		return nil, errors.Wrap(err, "get image digest")
+	}
+
+	ref, err := name.NewDigest("image@" + digest.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "image digest reference")
+	}
+
+	return []name.Reference{ref}, nil
+}
@@ -0,0 +1,136 @@
+package task
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConfigOverrideSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *ConfigOverrideSuite) writeImage(ref name.Reference) (string, v1.Image) {
+	image, err := random.Image(1024, 2)
+	s.NoError(err)
+
+	image, err = mutate.Config(image, v1.Config{
+		Entrypoint: []string{"/bin/app"},
+		Cmd:        []string{"serve"},
+		Env:        []string{"PATH=/bin"},
+	})
+	s.NoError(err)
+
+	imagePath := filepath.Join(s.T().TempDir(), "image.tar")
+	s.NoError(tarball.WriteToFile(imagePath, ref, image))
+
+	return imagePath, image
+}
+
+func (s *ConfigOverrideSuite) TestRewrite() {
+	imagePath, original := s.writeImage(name.MustParseReference("some-image:some-tag"))
+
+	err := overrideImageConfig(imagePath, []string{"/bin/other"}, []string{"run", "--fast"})
+	s.NoError(err)
+
+	image, err := tarball.ImageFromPath(imagePath, nil)
+	s.NoError(err)
+
+	configFile, err := image.ConfigFile()
+	s.NoError(err)
+	s.Equal([]string{"/bin/other"}, configFile.Config.Entrypoint)
+	s.Equal([]string{"run", "--fast"}, configFile.Config.Cmd)
+	s.Equal([]string{"PATH=/bin"}, configFile.Config.Env)
+
+	originalLayers, err := original.Layers()
+	s.NoError(err)
+
+	layers, err := image.Layers()
+	s.NoError(err)
+	s.Len(layers, len(originalLayers))
+
+	for i, layer := range layers {
+		diffID, err := layer.DiffID()
+		s.NoError(err)
+
+		originalDiffID, err := originalLayers[i].DiffID()
+		s.NoError(err)
+		s.Equal(originalDiffID, diffID)
+	}
+
+	tag, err := name.NewTag("some-image:some-tag")
+	s.NoError(err)
+
+	_, err = tarball.ImageFromPath(imagePath, &tag)
+	s.NoError(err)
+}
+
+func (s *ConfigOverrideSuite) TestUntagged() {
+	image, err := random.Image(1024, 1)
+	s.NoError(err)
+
+	digest, err := image.Digest()
+	s.NoError(err)
+
+	ref, err := name.NewDigest("image@" + digest.String())
+	s.NoError(err)
+
+	imagePath, _ := s.writeImage(ref)
+
+	err = overrideImageConfig(imagePath, nil, []string{"other"})
+	s.NoError(err)
+
+	manifest, err := tarball.LoadManifest(func() (io.ReadCloser, error) {
+		return os.Open(imagePath)
+	})
+	s.NoError(err)
+	s.Len(manifest, 1)
+	s.Empty(manifest[0].RepoTags)
+}
+
+func (s *ConfigOverrideSuite) TestOverrideConfig() {
+	config := v1.Config{
+		Entrypoint: []string{"/bin/app"},
+		Cmd:        []string{"serve"},
+	}
+
+	s.Equal(v1.Config{
+		Entrypoint: []string{"/bin/app"},
+		Cmd:        []string{"other"},
+	}, overrideConfig(config, nil, []string{"other"}))
+
+	s.Equal(v1.Config{
+		Entrypoint: []string{"/bin/other"},
+	}, overrideConfig(config, []string{"/bin/other"}, nil))
+
+	s.Equal(v1.Config{
+		Entrypoint: []string{},
+		Cmd:        []string{"sh"},
+	}, overrideConfig(config, []string{}, []string{"sh"}))
+}
+
+func (s *ConfigOverrideSuite) TestSanitize() {
+	cfg := Config{CmdOverride: []string{"serve"}, OutputType: "oci"}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "output type 'docker'")
+
+	cfg = Config{EntrypointOverride: []string{"/bin/app"}}
+	s.NoError(sanitize(&cfg))
+}
+
+func TestConfigOverride(t *testing.T) {
+	suite.Run(t, &ConfigOverrideSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,168 @@
+package task
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/pkg/fileutils"
+	"github.com/pkg/errors"
+)
+
+// contextDigest computes a digest of the files in the context which are sent
+// to buildkit, i.e. excluding those matched by the .dockerignore.
+func contextDigest(cfg Config) (string, error) {
+	patterns, err := dockerignorePatterns(cfg.ContextDir, cfg.DockerfilePath)
+	if err != nil {
+		return "", err
+	}
+
+	var ignored *fileutils.PatternMatcher
+	if len(patterns) > 0 {
+		ignored, err = fileutils.NewPatternMatcher(patterns)
+		if err != nil {
+			return "", errors.Wrap(err, "parse dockerignore")
+		}
+	}
+
+	hash := sha256.New()
+
+	err = hashContext(hash, cfg.ContextDir, ignored)
+	if err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// dockerignorePatterns reads the patterns which buildkit excludes from the
+// context: from the Dockerfile's own .dockerignore (e.g.
+// Dockerfile.dockerignore) if it has one, and otherwise the context's.
+func dockerignorePatterns(contextDir string, dockerfilePath string) ([]string, error) {
+	for _, path := range []string{
+		dockerfilePath + ".dockerignore",
+		filepath.Join(contextDir, ".dockerignore"),
+	} {
+		file, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, errors.Wrap(err, "read dockerignore")
+		}
+
+		defer file.Close()
+
+		return readDockerignore(file)
+	}
+
+	return nil, nil
+}
+
+// readDockerignore parses a .dockerignore the same way as buildkit: one
+// pattern per line, skipping blank lines and comments.
+func readDockerignore(r io.Reader) ([]string, error) {
+	var patterns []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		exclusion := strings.HasPrefix(pattern, "!")
+		if exclusion {
+			pattern = strings.TrimSpace(pattern[1:])
+		}
+
+		// patterns are relative to the context, even with a leading slash
+		pattern = filepath.Clean(pattern)
+		if len(pattern) > 1 && pattern[0] == '/' {
+			pattern = pattern[1:]
+		}
+
+		if exclusion {
+			pattern = "!" + pattern
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, errors.Wrap(err, "read dockerignore")
+	}
+
+	return patterns, nil
+}
+
+// hashContext writes the path, mode, and content of everything in the context
+// dir to the hash, in a stable order, skipping anything matched by ignored if
+// it is non-nil.
+func hashContext(hash io.Writer, contextDir string, ignored *fileutils.PatternMatcher) error {
+	// the context may itself be a symlink, e.g. with $STABLE_CONTEXT_PATH
+	contextDir, err := filepath.EvalSymlinks(contextDir)
+	if err != nil {
+		return errors.Wrap(err, "resolve context dir")
+	}
+
+	err = filepath.Walk(contextDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(contextDir, path)
+		if err != nil {
+			return err
+		}
+
+		if ignored != nil && rel != "." {
+			skip, err := ignored.Matches(rel)
+			if err != nil {
+				return err
+			}
+
+			if skip {
+				// an exclusion may bring back something beneath it
+				if info.IsDir() && !ignored.Exclusions() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+		}
+
+		fmt.Fprintf(hash, "%s\x00%o\x00", filepath.ToSlash(rel), info.Mode())
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(hash, "%s\x00", target)
+		case info.Mode().IsRegular():
+			digest, err := fileHash(path)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(hash, "%s\x00", digest)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "hash context")
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ContextDigestSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	cfg Config
+}
+
+func (s *ContextDigestSuite) SetupTest() {
+	contextDir := s.T().TempDir()
+	s.NoError(ioutil.WriteFile(filepath.Join(contextDir, "Dockerfile"), []byte("FROM busybox\nCOPY . /app\n"), 0644))
+	s.NoError(os.Mkdir(filepath.Join(contextDir, "src"), 0755))
+	s.NoError(ioutil.WriteFile(filepath.Join(contextDir, "src", "main.go"), []byte("package main\n"), 0644))
+
+	s.cfg = Config{ContextDir: contextDir}
+	s.NoError(sanitize(&s.cfg))
+}
+
+func (s *ContextDigestSuite) digest() string {
+	digest, err := contextDigest(s.cfg)
+	s.NoError(err)
+	return digest
+}
+
+func (s *ContextDigestSuite) write(path string, content string) {
+	path = filepath.Join(s.cfg.ContextDir, path)
+	s.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+	s.NoError(ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func (s *ContextDigestSuite) TestStable() {
+	digest := s.digest()
+	s.True(strings.HasPrefix(digest, "sha256:"), digest)
+	s.Equal(digest, s.digest())
+}
+
+func (s *ContextDigestSuite) TestChangedFile() {
+	original := s.digest()
+
+	s.write("src/main.go", "package main\n\nfunc main() {}\n")
+	changed := s.digest()
+	s.NotEqual(original, changed)
+
+	s.write("src/other.go", "package main\n")
+	s.NotEqual(changed, s.digest())
+}
+
+func (s *ContextDigestSuite) TestDockerignore() {
+	s.write(".dockerignore", "# build output\nbin\n*.log\n!keep.log\n")
+	original := s.digest()
+
+	s.write("bin/app", "binary")
+	s.write("debug.log", "log")
+	s.Equal(original, s.digest())
+
+	s.write("keep.log", "log")
+	s.NotEqual(original, s.digest())
+}
+
+func (s *ContextDigestSuite) TestDockerfileDockerignore() {
+	s.write("Dockerfile.dockerignore", "src\n")
+	s.write(".dockerignore", "Dockerfile\n")
+	original := s.digest()
+
+	s.write("src/main.go", "package main\n\nfunc main() {}\n")
+	s.Equal(original, s.digest())
+
+	// the Dockerfile's own takes precedence over the context's
+	s.write("Dockerfile", "FROM alpine\n")
+	s.NotEqual(original, s.digest())
+}
+
+func (s *ContextDigestSuite) TestReadDockerignore() {
+	patterns, err := readDockerignore(strings.NewReader("\n# comment\n/bin/\n  node_modules  \n! /keep\nsrc/../tmp\n"))
+	s.NoError(err)
+	s.Equal([]string{"bin", "node_modules", "!keep", "tmp"}, patterns)
+}
+
+func TestContextDigest(t *testing.T) {
+	suite.Run(t, &ContextDigestSuite{
+		Assertions: require.New(t),
+	})
+}
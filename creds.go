@@ -0,0 +1,155 @@
+package task
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+)
+
+// RegistryCreds are the credentials for a single registry, as read from the
+// CredsRefreshFile.
+type RegistryCreds struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+type dockerAuth struct {
+	Auth string `json:"auth"`
+}
+
+// refreshCreds re-reads the CredsRefreshFile and writes its credentials,
+// along with those of any registry mirrors, to a docker config.json in the
+// given dir. It returns the env pointing DOCKER_CONFIG at it, for buildctl to
+// pick them up for registry access during the build, or nil if there are no
+// credentials.
+//
+// The env is returned rather than set so that builds running concurrently
+// (see BuildAll), each with its own config dir, don't use each other's
+// credentials.
+//
+// This is done right before each buildctl invocation rather than once up
+// front, so that short-lived tokens (e.g. for ECR or GCR) minted by a prior
+// step are as fresh as possible.
+func refreshCreds(cfg Config, configDir string) ([]string, error) {
+	creds := mirrorCreds(cfg.RegistryMirrors)
+	if cfg.CredsRefreshFile == "" && len(creds) == 0 {
+		return nil, nil
+	}
+
+	if cfg.CredsRefreshFile != "" {
+		payload, err := ioutil.ReadFile(cfg.CredsRefreshFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read creds file")
+		}
+
+		var fileCreds map[string]RegistryCreds
+		err = json.Unmarshal(payload, &fileCreds)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse creds file")
+		}
+
+		// the file is kept fresh, so it wins over a mirror's own creds
+		for registry, c := range fileCreds {
+			creds[registry] = c
+		}
+	}
+
+	config := dockerConfig{
+		Auths: map[string]dockerAuth{},
+	}
+
+	for registry, c := range creds {
+		config.Auths[registry] = dockerAuth{
+			Auth: base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password)),
+		}
+	}
+
+	configPayload, err := json.Marshal(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal docker config")
+	}
+
+	err = os.MkdirAll(configDir, 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "create docker config dir")
+	}
+
+	err = ioutil.WriteFile(filepath.Join(configDir, "config.json"), configPayload, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "write docker config")
+	}
+
+	return []string{"DOCKER_CONFIG=" + configDir}, nil
+}
+
+// dockerHubAuthKeys are the keys Docker Hub's credentials may be stored under
+// in a docker config.
+var dockerHubAuthKeys = []string{name.DefaultRegistry, "docker.io", authn.DefaultAuthKey}
+
+// configKeychain resolves credentials from the docker config.json written by
+// refreshCreds to its dir, as authn.DefaultKeychain would via DOCKER_CONFIG,
+// falling back to anonymous access for registries it has none for.
+type configKeychain struct {
+	dir string
+}
+
+func (keychain configKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	payload, err := ioutil.ReadFile(filepath.Join(keychain.dir, "config.json"))
+	if err != nil {
+		return nil, errors.Wrap(err, "read docker config")
+	}
+
+	var config dockerConfig
+	err = json.Unmarshal(payload, &config)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse docker config")
+	}
+
+	keys := []string{target.RegistryStr()}
+	if target.RegistryStr() == name.DefaultRegistry {
+		keys = dockerHubAuthKeys
+	}
+
+	for _, key := range keys {
+		auth, found := config.Auths[key]
+		if !found {
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode auth for '%s'", key)
+		}
+
+		creds := strings.SplitN(string(decoded), ":", 2)
+		if len(creds) != 2 {
+			return nil, errors.Errorf("malformed auth for '%s'", key)
+		}
+
+		return authn.FromConfig(authn.AuthConfig{Username: creds[0], Password: creds[1]}), nil
+	}
+
+	return authn.Anonymous, nil
+}
+
+// registryKeychain returns the keychain for accessing registries with the
+// credentials written by refreshCreds to the config dir, if any, falling back
+// to the default keychain.
+func registryKeychain(env []string, configDir string) authn.Keychain {
+	if env == nil {
+		return authn.DefaultKeychain
+	}
+
+	return authn.NewMultiKeychain(configKeychain{dir: configDir}, authn.DefaultKeychain)
+}
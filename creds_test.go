@@ -0,0 +1,145 @@
+package task
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type CredsSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	dir string
+}
+
+func (s *CredsSuite) SetupTest() {
+	var err error
+	s.dir, err = ioutil.TempDir("", "oci-build-task-creds")
+	s.NoError(err)
+}
+
+func (s *CredsSuite) TearDownTest() {
+	err := os.RemoveAll(s.dir)
+	s.NoError(err)
+}
+
+func (s *CredsSuite) TestNoCredsFile() {
+	env, err := refreshCreds(Config{}, s.path("docker-config"))
+	s.NoError(err)
+	s.Nil(env)
+
+	_, err = os.Stat(s.path("docker-config"))
+	s.True(os.IsNotExist(err))
+}
+
+func (s *CredsSuite) TestLateRead() {
+	cfg := Config{CredsRefreshFile: s.path("creds.json")}
+	configDir := s.path("docker-config")
+
+	s.writeCreds(`{"registry.example.com":{"username":"some-user","password":"first-token"}}`)
+
+	env, err := refreshCreds(cfg, configDir)
+	s.NoError(err)
+	s.Equal([]string{"DOCKER_CONFIG=" + configDir}, env)
+	s.Equal("some-user:first-token", s.auth(configDir, "registry.example.com"))
+
+	// a prior step rotates the token after the task has started
+	s.writeCreds(`{"registry.example.com":{"username":"some-user","password":"second-token"}}`)
+
+	_, err = refreshCreds(cfg, configDir)
+	s.NoError(err)
+	s.Equal("some-user:second-token", s.auth(configDir, "registry.example.com"))
+}
+
+func (s *CredsSuite) TestInvalidCredsFile() {
+	s.writeCreds(`not json`)
+
+	_, err := refreshCreds(Config{CredsRefreshFile: s.path("creds.json")}, s.path("docker-config"))
+	s.Error(err)
+}
+
+func (s *CredsSuite) TestDoesNotSetEnv() {
+	s.T().Setenv("DOCKER_CONFIG", "/some/docker-config")
+
+	s.writeCreds(`{"registry.example.com":{"username":"some-user","password":"some-token"}}`)
+
+	_, err := refreshCreds(Config{CredsRefreshFile: s.path("creds.json")}, s.path("docker-config"))
+	s.NoError(err)
+	s.Equal("/some/docker-config", os.Getenv("DOCKER_CONFIG"))
+}
+
+func (s *CredsSuite) TestConfigKeychain() {
+	s.writeCreds(`{
+		"registry.example.com": {"username": "some-user", "password": "some-token"},
+		"docker.io": {"username": "hub-user", "password": "hub-token"}
+	}`)
+
+	configDir := s.path("docker-config")
+	env, err := refreshCreds(Config{CredsRefreshFile: s.path("creds.json")}, configDir)
+	s.NoError(err)
+
+	keychain := configKeychain{dir: configDir}
+	for image, expected := range map[string]authn.AuthConfig{
+		"registry.example.com/some/image": {Username: "some-user", Password: "some-token"},
+		"some/image":                      {Username: "hub-user", Password: "hub-token"},
+	} {
+		ref, err := name.ParseReference(image)
+		s.NoError(err)
+
+		auth, err := keychain.Resolve(ref.Context())
+		s.NoError(err)
+
+		config, err := auth.Authorization()
+		s.NoError(err)
+		s.Equal(expected.Username, config.Username, image)
+		s.Equal(expected.Password, config.Password, image)
+	}
+
+	ref, err := name.ParseReference("other.example.com/some/image")
+	s.NoError(err)
+
+	auth, err := keychain.Resolve(ref.Context())
+	s.NoError(err)
+	s.Equal(authn.Anonymous, auth)
+
+	s.Equal(authn.DefaultKeychain, registryKeychain(nil, configDir))
+	s.NotEqual(authn.DefaultKeychain, registryKeychain(env, configDir))
+}
+
+func (s *CredsSuite) writeCreds(content string) {
+	err := ioutil.WriteFile(s.path("creds.json"), []byte(content), 0600)
+	s.NoError(err)
+}
+
+func (s *CredsSuite) auth(configDir, registry string) string {
+	payload, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	s.NoError(err)
+
+	var config dockerConfig
+	err = json.Unmarshal(payload, &config)
+	s.NoError(err)
+
+	auth, err := base64.StdEncoding.DecodeString(config.Auths[registry].Auth)
+	s.NoError(err)
+
+	return string(auth)
+}
+
+func (s *CredsSuite) path(path ...string) string {
+	return filepath.Join(append([]string{s.dir}, path...)...)
+}
+
+func TestCreds(t *testing.T) {
+	suite.Run(t, &CredsSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,62 @@
+package task
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultDockerSocket is where the docker CLI looks for the daemon when
+// DOCKER_HOST is not set.
+const defaultDockerSocket = "/var/run/docker.sock"
+
+// dockerSocket returns the path to the docker daemon's socket, based on
+// DOCKER_HOST, and whether it is present. Non-unix DOCKER_HOST addresses
+// can't be checked, so are assumed to be reachable.
+func dockerSocket(dockerHost string) (string, bool) {
+	if dockerHost != "" && !strings.HasPrefix(dockerHost, "unix://") {
+		return dockerHost, true
+	}
+
+	socket := strings.TrimPrefix(dockerHost, "unix://")
+	if socket == "" {
+		socket = defaultDockerSocket
+	}
+
+	info, err := os.Stat(socket)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return socket, false
+	}
+
+	return socket, true
+}
+
+// dockerLoadCommand returns the command for loading the image tarball at the
+// given path into the docker daemon.
+func dockerLoadCommand(imagePath string) []string {
+	return []string{"docker", "load", "-i", imagePath}
+}
+
+// loadIntoDaemon loads the image tarball into the docker daemon, or warns and
+// does nothing if there is no daemon socket.
+func loadIntoDaemon(imagePath string) error {
+	socket, ok := dockerSocket(os.Getenv("DOCKER_HOST"))
+	if !ok {
+		logrus.Warnf("no docker daemon socket at %s; not loading image", socket)
+		return nil
+	}
+
+	cmd := dockerLoadCommand(imagePath)
+
+	logrus.Info("loading image into docker daemon")
+	logrus.Debugf("running %s", strings.Join(cmd, " "))
+
+	err := run(os.Stdout, cmd[0], cmd[1:]...)
+	if err != nil {
+		return errors.Wrap(err, "docker load")
+	}
+
+	return nil
+}
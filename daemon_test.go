@@ -0,0 +1,65 @@
+package task
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type DaemonSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *DaemonSuite) TestDockerLoadCommand() {
+	s.Equal(
+		[]string{"docker", "load", "-i", "/outputs/image/image.tar"},
+		dockerLoadCommand("/outputs/image/image.tar"),
+	)
+}
+
+func (s *DaemonSuite) TestDockerSocket() {
+	socket := filepath.Join(s.T().TempDir(), "docker.sock")
+
+	path, ok := dockerSocket("unix://" + socket)
+	s.Equal(socket, path)
+	s.False(ok)
+
+	listener, err := net.Listen("unix", socket)
+	s.NoError(err)
+
+	defer listener.Close()
+
+	path, ok = dockerSocket("unix://" + socket)
+	s.Equal(socket, path)
+	s.True(ok)
+}
+
+func (s *DaemonSuite) TestDockerSocketTCP() {
+	path, ok := dockerSocket("tcp://docker:2375")
+	s.Equal("tcp://docker:2375", path)
+	s.True(ok)
+}
+
+func (s *DaemonSuite) TestLoadIntoDaemonWithoutSocket() {
+	s.T().Setenv("DOCKER_HOST", "unix://"+filepath.Join(s.T().TempDir(), "missing.sock"))
+
+	s.NoError(loadIntoDaemon("/outputs/image/image.tar"))
+}
+
+func (s *DaemonSuite) TestSanitize() {
+	cfg := Config{LoadIntoDaemon: true}
+	s.NoError(sanitize(&cfg))
+
+	cfg = Config{LoadIntoDaemon: true, OutputType: "oci"}
+	s.Error(sanitize(&cfg))
+}
+
+func TestDaemon(t *testing.T) {
+	suite.Run(t, &DaemonSuite{
+		Assertions: require.New(t),
+	})
+}
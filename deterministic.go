@@ -0,0 +1,136 @@
+package task
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// deterministicModTime is the modification time given to every entry of a
+// normalized image tarball.
+var deterministicModTime = time.Unix(0, 0).UTC()
+
+// sourceDateEpochArg is the build arg buildkit uses for the timestamps in the
+// image config, and with rewrite-timestamp, of the files in its layers.
+const sourceDateEpochArg = "SOURCE_DATE_EPOCH"
+
+// tarEntry is an entry in a tarball, and where its content starts.
+type tarEntry struct {
+	header *tar.Header
+	offset int64
+}
+
+// countingReader counts the bytes read through it, so that the offset of each
+// entry's content is known.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.r.Read(p)
+	reader.n += int64(n)
+	return n, err
+}
+
+// normalizeImageTarball rewrites the image tarball at imagePath so that the
+// same blobs always produce the same bytes, whatever order they were written
+// in and by whom: entries are sorted by name, owned by root, and have a fixed
+// modification time. Only the tarball's own entries are normalized here; the
+// layers within it keep their ownership, as it matters, and buildkit clamps
+// their timestamps (see sourceDateEpochArg).
+func normalizeImageTarball(imagePath string) error {
+	image, err := os.Open(imagePath)
+	if err != nil {
+		return errors.Wrap(err, "open image")
+	}
+
+	defer image.Close()
+
+	counter := &countingReader{r: image}
+	reader := tar.NewReader(counter)
+
+	var entries []tarEntry
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "read image")
+		}
+
+		// the content comes right after the header, and isn't read ahead
+		entries = append(entries, tarEntry{header: header, offset: counter.n})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].header.Name < entries[j].header.Name
+	})
+
+	// written alongside so that it can be renamed into place
+	normalized, err := ioutil.TempFile(filepath.Dir(imagePath), "image-*.tar")
+	if err != nil {
+		return errors.Wrap(err, "create image")
+	}
+
+	defer os.Remove(normalized.Name())
+	defer normalized.Close()
+
+	writer := tar.NewWriter(normalized)
+	for _, entry := range entries {
+		err := writer.WriteHeader(normalizeTarHeader(entry.header))
+		if err != nil {
+			return errors.Wrapf(err, "write %s", entry.header.Name)
+		}
+
+		_, err = io.Copy(writer, io.NewSectionReader(image, entry.offset, entry.header.Size))
+		if err != nil {
+			return errors.Wrapf(err, "write %s", entry.header.Name)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return errors.Wrap(err, "write image")
+	}
+
+	err = normalized.Close()
+	if err != nil {
+		return errors.Wrap(err, "write image")
+	}
+
+	err = os.Chmod(normalized.Name(), 0644)
+	if err != nil {
+		return errors.Wrap(err, "chmod image")
+	}
+
+	err = os.Rename(normalized.Name(), imagePath)
+	if err != nil {
+		return errors.Wrap(err, "replace image")
+	}
+
+	return nil
+}
+
+// normalizeTarHeader returns the header with everything that varies between
+// otherwise identical tarballs reset.
+func normalizeTarHeader(header *tar.Header) *tar.Header {
+	return &tar.Header{
+		Typeflag: header.Typeflag,
+		Name:     header.Name,
+		Linkname: header.Linkname,
+		Size:     header.Size,
+		Mode:     header.Mode,
+		ModTime:  deterministicModTime,
+		Devmajor: header.Devmajor,
+		Devminor: header.Devminor,
+	}
+}
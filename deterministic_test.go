@@ -0,0 +1,188 @@
+package task
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type DeterministicSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+type fixtureEntry struct {
+	name    string
+	content string
+}
+
+var fixtureEntries = []fixtureEntry{
+	{"blobs/sha256/aaaa", "config"},
+	{"blobs/sha256/bbbb", "layer"},
+	{"index.json", `{"schemaVersion":2}`},
+	{"manifest.json", `[{"Config":"blobs/sha256/aaaa"}]`},
+	{"oci-layout", `{"imageLayoutVersion":"1.0.0"}`},
+}
+
+// writeFixture writes the fixture entries as a tarball in the given order, as
+// written by the given user at the given time.
+func (s *DeterministicSuite) writeFixture(order []int, uid int, modTime time.Time) string {
+	path := filepath.Join(s.T().TempDir(), "image.tar")
+
+	file, err := os.Create(path)
+	s.NoError(err)
+
+	writer := tar.NewWriter(file)
+
+	s.NoError(writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     "blobs/",
+		Mode:     0755,
+		Uid:      uid,
+		Gid:      uid,
+		ModTime:  modTime,
+	}))
+
+	for _, i := range order {
+		entry := fixtureEntries[i]
+		s.NoError(writer.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     entry.name,
+			Size:     int64(len(entry.content)),
+			Mode:     0644,
+			Uid:      uid,
+			Gid:      uid,
+			Uname:    "builder",
+			ModTime:  modTime,
+			Format:   tar.FormatPAX,
+		}))
+
+		_, err := writer.Write([]byte(entry.content))
+		s.NoError(err)
+	}
+
+	s.NoError(writer.Close())
+	s.NoError(file.Close())
+
+	return path
+}
+
+func (s *DeterministicSuite) TestByteStable() {
+	first := s.writeFixture([]int{3, 0, 1, 4, 2}, 1000, time.Date(2022, 10, 14, 9, 30, 0, 0, time.UTC))
+	second := s.writeFixture([]int{2, 4, 1, 0, 3}, 0, time.Date(2022, 10, 15, 11, 0, 0, 0, time.UTC))
+
+	s.NoError(normalizeImageTarball(first))
+	s.NoError(normalizeImageTarball(second))
+
+	firstBytes, err := ioutil.ReadFile(first)
+	s.NoError(err)
+
+	secondBytes, err := ioutil.ReadFile(second)
+	s.NoError(err)
+
+	s.Equal(firstBytes, secondBytes)
+
+	// normalizing again changes nothing
+	s.NoError(normalizeImageTarball(first))
+
+	againBytes, err := ioutil.ReadFile(first)
+	s.NoError(err)
+	s.Equal(firstBytes, againBytes)
+}
+
+func (s *DeterministicSuite) TestNormalized() {
+	path := s.writeFixture([]int{4, 3, 2, 1, 0}, 1000, time.Now())
+
+	s.NoError(normalizeImageTarball(path))
+
+	file, err := os.Open(path)
+	s.NoError(err)
+	defer file.Close()
+
+	reader := tar.NewReader(file)
+
+	names := []string{}
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			break
+		}
+
+		names = append(names, header.Name)
+		s.Zero(header.Uid)
+		s.Zero(header.Gid)
+		s.Empty(header.Uname)
+		s.True(header.ModTime.Equal(time.Unix(0, 0)), header.ModTime.String())
+
+		content, err := ioutil.ReadAll(reader)
+		s.NoError(err)
+
+		for _, entry := range fixtureEntries {
+			if entry.name == header.Name {
+				s.Equal(entry.content, string(content))
+			}
+		}
+	}
+
+	s.Equal([]string{
+		"blobs/",
+		"blobs/sha256/aaaa",
+		"blobs/sha256/bbbb",
+		"index.json",
+		"manifest.json",
+		"oci-layout",
+	}, names)
+}
+
+func (s *DeterministicSuite) TestImageStillLoads() {
+	image, err := random.Image(1024, 3)
+	s.NoError(err)
+
+	imagePath := filepath.Join(s.T().TempDir(), "image.tar")
+	s.NoError(tarball.WriteToFile(imagePath, name.MustParseReference("some-image:some-tag"), image))
+
+	s.NoError(normalizeImageTarball(imagePath))
+
+	normalized, err := tarball.ImageFromPath(imagePath, nil)
+	s.NoError(err)
+
+	digest, err := image.Digest()
+	s.NoError(err)
+
+	normalizedDigest, err := normalized.Digest()
+	s.NoError(err)
+	s.Equal(digest, normalizedDigest)
+}
+
+func (s *DeterministicSuite) TestSanitize() {
+	cfg := Config{DeterministicExport: true, OutputType: "image", ImageName: "some-image"}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{DeterministicExport: true, OutputType: "oci"}
+	s.NoError(sanitize(&cfg))
+	s.Equal([]string{"SOURCE_DATE_EPOCH=0"}, cfg.BuildArgs)
+
+	// an epoch given explicitly is kept, and ours isn't dropped by the allow list
+	cfg = Config{DeterministicExport: true, OutputType: "oci", BuildArgs: []string{"SOURCE_DATE_EPOCH=1700000000"}}
+	s.NoError(sanitize(&cfg))
+	s.Equal([]string{"SOURCE_DATE_EPOCH=1700000000"}, cfg.BuildArgs)
+
+	cfg = Config{DeterministicExport: true, OutputType: "oci", BuildArgs: []string{"VERSION=1.2.3"}, AllowedBuildArgs: []string{"VERSION"}}
+	s.NoError(sanitize(&cfg))
+	s.Equal([]string{"VERSION=1.2.3", "SOURCE_DATE_EPOCH=0"}, cfg.BuildArgs)
+}
+
+func TestDeterministic(t *testing.T) {
+	suite.Run(t, &DeterministicSuite{
+		Assertions: require.New(t),
+	})
+}
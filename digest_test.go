@@ -0,0 +1,43 @@
+package task
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type DigestSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+const someDigest = "sha256:6e1a2a3fd4d4bbbbd2cf1c1dbf41a5a8e3ad2918ee3b3e8bc5e31294b00f1f10"
+
+func (s *DigestSuite) TestDigestTag() {
+	digest, err := v1.NewHash(someDigest)
+	s.NoError(err)
+
+	s.Equal("sha256-6e1a2a3fd4d4bbbbd2cf1c1dbf41a5a8e3ad2918ee3b3e8bc5e31294b00f1f10", digestTag(digest))
+}
+
+func (s *DigestSuite) TestWriteDigestTag() {
+	digest, err := v1.NewHash(someDigest)
+	s.NoError(err)
+
+	path := filepath.Join(s.T().TempDir(), "digest-tag")
+	s.NoError(writeDigestTag(path, digest))
+
+	content, err := ioutil.ReadFile(path)
+	s.NoError(err)
+	s.Equal(digestTag(digest), string(content))
+}
+
+func TestDigest(t *testing.T) {
+	suite.Run(t, &DigestSuite{
+		Assertions: require.New(t),
+	})
+}
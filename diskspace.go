@@ -0,0 +1,59 @@
+package task
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// statfsFunc reports filesystem statistics for a path, as syscall.Statfs.
+type statfsFunc func(path string, buf *syscall.Statfs_t) error
+
+// checkFreeSpace fails if any of the paths is on a filesystem with less than
+// the minimum free space available, so that the build fails early rather than
+// partway through with a confusing error.
+func checkFreeSpace(statfs statfsFunc, minFreeSpace string, paths ...string) error {
+	minFree, err := parseSize(minFreeSpace)
+	if err != nil {
+		return errors.Wrap(err, "min free space")
+	}
+
+	for _, path := range paths {
+		var stat syscall.Statfs_t
+		err := statfs(path, &stat)
+		if err != nil {
+			return errors.Wrapf(err, "check free space on %s", path)
+		}
+
+		free := int64(stat.Bavail) * int64(stat.Bsize)
+		if free < minFree {
+			return errors.Errorf(
+				"not enough free space on %s: %s available, %s required; free up disk space on the worker or lower $MIN_FREE_SPACE",
+				path,
+				formatSize(free),
+				formatSize(minFree),
+			)
+		}
+	}
+
+	return nil
+}
+
+// formatSize formats a number of bytes with the largest whole binary unit.
+func formatSize(bytes int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+
+	size := float64(bytes)
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%dB", bytes)
+	}
+
+	return fmt.Sprintf("%.1f%s", size, units[unit])
+}
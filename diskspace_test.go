@@ -0,0 +1,79 @@
+package task
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type DiskSpaceSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+// fakeStatfs reports the given free bytes for each path, in 4KiB blocks.
+func fakeStatfs(free map[string]int64) statfsFunc {
+	return func(path string, buf *syscall.Statfs_t) error {
+		bytes, found := free[path]
+		if !found {
+			return errors.New("no such file or directory")
+		}
+
+		buf.Bsize = 4096
+		buf.Bavail = uint64(bytes / 4096)
+
+		return nil
+	}
+}
+
+func (s *DiskSpaceSuite) TestEnoughSpace() {
+	statfs := fakeStatfs(map[string]int64{
+		"/scratch/buildkitd": 20 << 30,
+		"/outputs":           10 << 30,
+	})
+
+	s.NoError(checkFreeSpace(statfs, "10GB", "/scratch/buildkitd", "/outputs"))
+}
+
+func (s *DiskSpaceSuite) TestNotEnoughSpace() {
+	statfs := fakeStatfs(map[string]int64{
+		"/scratch/buildkitd": 20 << 30,
+		"/outputs":           512 << 20,
+	})
+
+	err := checkFreeSpace(statfs, "1GB", "/scratch/buildkitd", "/outputs")
+	s.Error(err)
+	s.Contains(err.Error(), "not enough free space on /outputs: 512.0MiB available, 1.0GiB required")
+}
+
+func (s *DiskSpaceSuite) TestStatfsFails() {
+	err := checkFreeSpace(fakeStatfs(nil), "1GB", "/missing")
+	s.Error(err)
+	s.Contains(err.Error(), "/missing")
+}
+
+func (s *DiskSpaceSuite) TestInvalidSize() {
+	s.Error(checkFreeSpace(fakeStatfs(nil), "lots", "/outputs"))
+
+	cfg := Config{MinFreeSpace: "lots"}
+	s.Error(sanitize(&cfg))
+}
+
+func (s *DiskSpaceSuite) TestFormatSize() {
+	s.Equal("512B", formatSize(512))
+	s.Equal("1.5KiB", formatSize(1536))
+	s.Equal("10.0GiB", formatSize(10<<30))
+}
+
+func (s *DiskSpaceSuite) TestRealStatfs() {
+	s.NoError(checkFreeSpace(syscall.Statfs, "0", s.T().TempDir()))
+}
+
+func TestDiskSpace(t *testing.T) {
+	suite.Run(t, &DiskSpaceSuite{
+		Assertions: require.New(t),
+	})
+}
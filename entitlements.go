@@ -0,0 +1,31 @@
+package task
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// knownEntitlements are the entitlements buildkit currently understands.
+// Others are still passed along, in case buildkit has learned new ones since.
+var knownEntitlements = map[string]bool{
+	"network.host":      true,
+	"security.insecure": true,
+}
+
+// entitlementFlags repeats the given flag for each entitlement, i.e. `--allow`
+// for buildctl and `--allow-insecure-entitlement` for buildkitd.
+func entitlementFlags(flag string, entitlements []string) []string {
+	var flags []string
+	for _, ent := range entitlements {
+		flags = append(flags, flag, ent)
+	}
+
+	return flags
+}
+
+func validateEntitlements(entitlements []string) {
+	for _, ent := range entitlements {
+		if !knownEntitlements[ent] {
+			logrus.Warnf("unknown entitlement '%s'; passing it along anyway", ent)
+		}
+	}
+}
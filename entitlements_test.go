@@ -0,0 +1,46 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntitlementsSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *EntitlementsSuite) TestBuildctlFlags() {
+	flags := entitlementFlags("--allow", []string{"network.host", "security.insecure"})
+	s.Equal([]string{
+		"--allow", "network.host",
+		"--allow", "security.insecure",
+	}, flags)
+}
+
+func (s *EntitlementsSuite) TestBuildkitdFlags() {
+	flags := entitlementFlags("--allow-insecure-entitlement", []string{"network.host", "security.insecure"})
+	s.Equal([]string{
+		"--allow-insecure-entitlement", "network.host",
+		"--allow-insecure-entitlement", "security.insecure",
+	}, flags)
+}
+
+func (s *EntitlementsSuite) TestUnknownEntitlement() {
+	validateEntitlements([]string{"device.gpu"})
+
+	flags := entitlementFlags("--allow", []string{"device.gpu"})
+	s.Equal([]string{"--allow", "device.gpu"}, flags)
+}
+
+func (s *EntitlementsSuite) TestNoEntitlements() {
+	s.Empty(entitlementFlags("--allow", nil))
+}
+
+func TestEntitlements(t *testing.T) {
+	suite.Run(t, &EntitlementsSuite{
+		Assertions: require.New(t),
+	})
+}
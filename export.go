@@ -0,0 +1,126 @@
+package task
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// buildctl's plain progress output marks the start of exporting the image or
+// the cache, once everything has been built:
+//
+//	#12 exporting to docker image format
+//	#12 exporting layers 10.2s done
+//	#12 sending tarball 52.3s done
+//	#13 exporting cache
+var exportLine = regexp.MustCompile(`^#\d+ exporting (to |cache)`)
+
+// exportMonitor is an io.Writer which watches buildctl output for the export
+// phase, so that it can be bounded separately from the build itself.
+type exportMonitor struct {
+	timeout time.Duration
+
+	// called once the export has taken longer than the timeout
+	expire func()
+
+	mu       sync.Mutex
+	partial  []byte
+	started  time.Time
+	timedOut bool
+}
+
+func newExportMonitor(timeout time.Duration, expire func()) *exportMonitor {
+	return &exportMonitor{
+		timeout: timeout,
+		expire:  expire,
+	}
+}
+
+func (monitor *exportMonitor) Write(p []byte) (int, error) {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	monitor.partial = scanLines(monitor.partial, p, monitor.scan)
+
+	return len(p), nil
+}
+
+func (monitor *exportMonitor) scan(line string) {
+	if monitor.started.IsZero() && exportLine.MatchString(line) {
+		monitor.started = time.Now()
+	}
+}
+
+// check marks the export as timed out, calling expire, if it started longer
+// than the timeout ago as of now.
+func (monitor *exportMonitor) check(now time.Time) {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	if monitor.timedOut || monitor.started.IsZero() {
+		return
+	}
+
+	if now.Sub(monitor.started) < monitor.timeout {
+		return
+	}
+
+	monitor.timedOut = true
+	monitor.expire()
+}
+
+// TimedOut returns whether the export took longer than the timeout.
+func (monitor *exportMonitor) TimedOut() bool {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	return monitor.timedOut
+}
+
+// watch checks for the export timing out periodically until the returned
+// func is called.
+func (monitor *exportMonitor) watch() func() {
+	return pollUntilStopped(monitor.check)
+}
+
+// buildWithTimeouts runs buildctl, stopping it with a targeted error if
+// transferring a local source stalls for the context transfer timeout, or if
+// exporting takes longer than the export timeout, whichever are set.
+func buildWithTimeouts(ctx context.Context, buildkitd *Buildkitd, cfg Config, out io.Writer, args ...string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var transfer *transferMonitor
+	if cfg.ContextTransferTimeout > 0 {
+		transfer = newTransferMonitor(cfg.ContextTransferTimeout, cancel)
+		out = io.MultiWriter(out, transfer)
+
+		defer transfer.watch()()
+	}
+
+	var export *exportMonitor
+	if cfg.ExportTimeout > 0 {
+		export = newExportMonitor(cfg.ExportTimeout, cancel)
+		out = io.MultiWriter(out, export)
+
+		defer export.watch()()
+	}
+
+	err := buildkitd.buildctl(ctx, out, args...)
+
+	if transfer != nil {
+		if source := transfer.Stalled(); source != "" {
+			return errors.Errorf("transferring %s stalled: no progress for %s", source, cfg.ContextTransferTimeout)
+		}
+	}
+
+	if export != nil && export.TimedOut() {
+		return errors.Errorf("exporting timed out: not finished within %s of the build completing", cfg.ExportTimeout)
+	}
+
+	return err
+}
@@ -0,0 +1,84 @@
+package task
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ExportSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	monitor  *exportMonitor
+	expiries int
+}
+
+func (s *ExportSuite) SetupTest() {
+	s.expiries = 0
+	s.monitor = newExportMonitor(time.Minute, func() { s.expiries++ })
+}
+
+func (s *ExportSuite) write(output string) {
+	_, err := fmt.Fprint(s.monitor, output)
+	s.NoError(err)
+}
+
+func (s *ExportSuite) TestBuildNotBounded() {
+	s.write(`#5 [2/2] RUN sleep 600
+#5 DONE 600.1s
+`)
+
+	s.monitor.check(time.Now().Add(time.Hour))
+	s.False(s.monitor.TimedOut())
+	s.Equal(0, s.expiries)
+}
+
+func (s *ExportSuite) TestTimedOut() {
+	s.write(`#5 [2/2] RUN sleep 600
+#5 DONE 600.1s
+
+#6 exporting to docker image format
+#6 exporting layers
+`)
+
+	s.monitor.check(time.Now().Add(30 * time.Second))
+	s.False(s.monitor.TimedOut())
+	s.Equal(0, s.expiries)
+
+	s.monitor.check(time.Now().Add(2 * time.Minute))
+	s.True(s.monitor.TimedOut())
+	s.Equal(1, s.expiries)
+
+	// only expires once
+	s.monitor.check(time.Now().Add(3 * time.Minute))
+	s.Equal(1, s.expiries)
+}
+
+func (s *ExportSuite) TestCacheExport() {
+	s.write(`#7 exporting cache
+#7 preparing build cache for export
+`)
+
+	s.monitor.check(time.Now().Add(2 * time.Minute))
+	s.True(s.monitor.TimedOut())
+}
+
+func (s *ExportSuite) TestPartialLines() {
+	s.write("#6 exporting to ")
+	s.monitor.check(time.Now().Add(2 * time.Minute))
+	s.False(s.monitor.TimedOut())
+
+	s.write("oci image format\n")
+	s.monitor.check(time.Now().Add(2 * time.Minute))
+	s.True(s.monitor.TimedOut())
+}
+
+func TestExport(t *testing.T) {
+	suite.Run(t, &ExportSuite{
+		Assertions: require.New(t),
+	})
+}
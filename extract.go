@@ -0,0 +1,98 @@
+package task
+
+import (
+	"archive/tar"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/concourse/go-archive/tarfs"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// extractImageFiles copies the given paths out of the filesystem of the image
+// tarball at imagePath into dest.
+func extractImageFiles(dest string, imagePath string, paths []string) error {
+	image, err := tarball.ImageFromPath(imagePath, nil)
+	if err != nil {
+		return errors.Wrap(err, "open image")
+	}
+
+	fs := mutate.Extract(image)
+	defer fs.Close()
+
+	return extractFiles(dest, fs, paths)
+}
+
+// extractFiles copies the given paths (files or directories) out of a
+// filesystem tar stream into dest, preserving their paths relative to the
+// root of the filesystem.
+func extractFiles(dest string, fs io.Reader, paths []string) error {
+	wanted := map[string]bool{}
+	for _, path := range paths {
+		wanted[normalizePath(path)] = false
+	}
+
+	tr := tar.NewReader(fs)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		name := normalizePath(hdr.Name)
+
+		matched := false
+		for path := range wanted {
+			if name == path || strings.HasPrefix(name, path+"/") {
+				wanted[path] = true
+				matched = true
+			}
+		}
+
+		if !matched {
+			continue
+		}
+
+		if hdr.Typeflag == tar.TypeBlock || hdr.Typeflag == tar.TypeChar {
+			logrus.Debugf("skipping device %s", hdr.Name)
+			continue
+		}
+
+		hdr.Name = name
+
+		logrus.Debugf("extracting %s", name)
+
+		err = tarfs.ExtractEntry(hdr, dest, tr, false)
+		if err != nil {
+			return errors.Wrapf(err, "extract %s", name)
+		}
+	}
+
+	var missing []string
+	for _, path := range paths {
+		if !wanted[normalizePath(path)] {
+			missing = append(missing, path)
+		}
+	}
+
+	if len(missing) > 0 {
+		return errors.Errorf("not found in image: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// normalizePath turns both absolute paths and tar entry names (e.g. ./foo)
+// into a clean path relative to the root.
+func normalizePath(path string) string {
+	return strings.TrimPrefix(filepath.Clean("/"+path), "/")
+}
@@ -0,0 +1,86 @@
+package task
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ExtractSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	dest string
+	fs   *bytes.Buffer
+}
+
+func (s *ExtractSuite) SetupTest() {
+	var err error
+	s.dest, err = ioutil.TempDir("", "oci-build-task-extract")
+	s.NoError(err)
+
+	s.fs = new(bytes.Buffer)
+	tw := tar.NewWriter(s.fs)
+
+	for _, hdr := range []*tar.Header{
+		{Name: "./", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./usr/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./usr/bin/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./usr/bin/app", Typeflag: tar.TypeReg, Mode: 0755, Size: 3},
+		{Name: "./usr/bin/other", Typeflag: tar.TypeReg, Mode: 0755, Size: 5},
+		{Name: "./etc/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./etc/app/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./etc/app/config.yml", Typeflag: tar.TypeReg, Mode: 0644, Size: 6},
+	} {
+		err := tw.WriteHeader(hdr)
+		s.NoError(err)
+
+		if hdr.Size > 0 {
+			_, err = tw.Write(bytes.Repeat([]byte("x"), int(hdr.Size)))
+			s.NoError(err)
+		}
+	}
+
+	err = tw.Close()
+	s.NoError(err)
+}
+
+func (s *ExtractSuite) TearDownTest() {
+	err := os.RemoveAll(s.dest)
+	s.NoError(err)
+}
+
+func (s *ExtractSuite) TestExtractFilesAndDirs() {
+	err := extractFiles(s.dest, s.fs, []string{"/usr/bin/app", "etc/app"})
+	s.NoError(err)
+
+	content, err := ioutil.ReadFile(filepath.Join(s.dest, "usr", "bin", "app"))
+	s.NoError(err)
+	s.Equal("xxx", string(content))
+
+	content, err = ioutil.ReadFile(filepath.Join(s.dest, "etc", "app", "config.yml"))
+	s.NoError(err)
+	s.Equal("xxxxxx", string(content))
+
+	_, err = os.Stat(filepath.Join(s.dest, "usr", "bin", "other"))
+	s.True(os.IsNotExist(err))
+}
+
+func (s *ExtractSuite) TestMissingFile() {
+	err := extractFiles(s.dest, s.fs, []string{"/usr/bin/app", "/usr/bin/bogus"})
+	s.Error(err)
+	s.Contains(err.Error(), "/usr/bin/bogus")
+	s.NotContains(err.Error(), "/usr/bin/app")
+}
+
+func TestExtract(t *testing.T) {
+	suite.Run(t, &ExtractSuite{
+		Assertions: require.New(t),
+	})
+}
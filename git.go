@@ -0,0 +1,106 @@
+package task
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// dirtyLabel is the image label set by AutoLabelDirty.
+const dirtyLabel = "org.concourse.oci-build-task.dirty"
+
+// isGitRepo returns whether dir is the root of a git repository.
+func isGitRepo(dir string) (bool, error) {
+	// .git is a file rather than a directory for worktrees and submodules
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "check for git repository")
+	}
+
+	return true, nil
+}
+
+// gitOutput runs git in the repository at dir, returning its output.
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	// inputs are often owned by another user, which git refuses to work with
+	// unless told it's safe
+	cmd := exec.Command("git", append([]string{"-c", "safe.directory=*", "-C", dir}, args...)...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "git %s: %s", args[0], bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return out, nil
+}
+
+// gitHead returns the sha of the commit checked out in the git repository at
+// dir. It returns false for isRepo, and no error, if dir is not the root of a
+// git repository.
+func gitHead(dir string) (sha string, isRepo bool, err error) {
+	isRepo, err = isGitRepo(dir)
+	if err != nil || !isRepo {
+		return "", isRepo, err
+	}
+
+	out, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", true, err
+	}
+
+	return string(bytes.TrimSpace(out)), true, nil
+}
+
+// gitBranch returns the name of the branch checked out in the git repository
+// at dir, or "" if it's in a detached HEAD state. It returns false for isRepo,
+// and no error, if dir is not the root of a git repository.
+func gitBranch(dir string) (branch string, isRepo bool, err error) {
+	isRepo, err = isGitRepo(dir)
+	if err != nil || !isRepo {
+		return "", isRepo, err
+	}
+
+	out, err := gitOutput(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", true, err
+	}
+
+	branch = string(bytes.TrimSpace(out))
+	if branch == "HEAD" {
+		return "", true, nil
+	}
+
+	return branch, true, nil
+}
+
+// gitDirty returns whether the git repository at dir has uncommitted changes,
+// including untracked files. It returns false for isRepo, and no error, if dir
+// is not the root of a git repository.
+func gitDirty(dir string) (dirty bool, isRepo bool, err error) {
+	isRepo, err = isGitRepo(dir)
+	if err != nil || !isRepo {
+		return false, isRepo, err
+	}
+
+	out, err := gitOutput(dir, "status", "--porcelain")
+	if err != nil {
+		return false, true, err
+	}
+
+	return len(bytes.TrimSpace(out)) > 0, true, nil
+}
+
+// dirtyLabelArg returns the label marking whether the image was built from
+// uncommitted changes, e.g. org.concourse.oci-build-task.dirty=true.
+func dirtyLabelArg(dirty bool) string {
+	return dirtyLabel + "=" + strconv.FormatBool(dirty)
+}
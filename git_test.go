@@ -0,0 +1,121 @@
+package task
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type GitSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	repo string
+}
+
+func (s *GitSuite) SetupTest() {
+	if _, err := exec.LookPath("git"); err != nil {
+		s.T().Skip("git not installed")
+	}
+
+	s.repo = s.T().TempDir()
+
+	s.git("init", "-q")
+	s.NoError(ioutil.WriteFile(filepath.Join(s.repo, "Dockerfile"), []byte("FROM busybox\n"), 0644))
+	s.git("add", "Dockerfile")
+	s.git("-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init")
+}
+
+func (s *GitSuite) git(args ...string) {
+	cmd := exec.Command("git", append([]string{"-C", s.repo}, args...)...)
+	out, err := cmd.CombinedOutput()
+	s.NoError(err, string(out))
+}
+
+func (s *GitSuite) TestClean() {
+	dirty, isRepo, err := gitDirty(s.repo)
+	s.NoError(err)
+	s.True(isRepo)
+	s.False(dirty)
+}
+
+func (s *GitSuite) TestModified() {
+	s.NoError(ioutil.WriteFile(filepath.Join(s.repo, "Dockerfile"), []byte("FROM alpine\n"), 0644))
+
+	dirty, isRepo, err := gitDirty(s.repo)
+	s.NoError(err)
+	s.True(isRepo)
+	s.True(dirty)
+}
+
+func (s *GitSuite) TestUntracked() {
+	s.NoError(ioutil.WriteFile(filepath.Join(s.repo, "new-file"), []byte("hello\n"), 0644))
+
+	dirty, _, err := gitDirty(s.repo)
+	s.NoError(err)
+	s.True(dirty)
+}
+
+func (s *GitSuite) TestNotARepo() {
+	dirty, isRepo, err := gitDirty(s.T().TempDir())
+	s.NoError(err)
+	s.False(isRepo)
+	s.False(dirty)
+}
+
+func (s *GitSuite) TestHead() {
+	out, err := exec.Command("git", "-C", s.repo, "rev-parse", "HEAD").Output()
+	s.NoError(err)
+
+	sha, isRepo, err := gitHead(s.repo)
+	s.NoError(err)
+	s.True(isRepo)
+	s.Equal(strings.TrimSpace(string(out)), sha)
+	s.Len(sha, 40)
+}
+
+func (s *GitSuite) TestHeadNotARepo() {
+	sha, isRepo, err := gitHead(s.T().TempDir())
+	s.NoError(err)
+	s.False(isRepo)
+	s.Empty(sha)
+}
+
+func (s *GitSuite) TestBranch() {
+	s.git("checkout", "-q", "-b", "some-branch")
+
+	branch, isRepo, err := gitBranch(s.repo)
+	s.NoError(err)
+	s.True(isRepo)
+	s.Equal("some-branch", branch)
+}
+
+func (s *GitSuite) TestBranchDetached() {
+	s.git("checkout", "-q", "--detach")
+
+	branch, isRepo, err := gitBranch(s.repo)
+	s.NoError(err)
+	s.True(isRepo)
+	s.Empty(branch)
+}
+
+func (s *GitSuite) TestHasBuildArg() {
+	s.True(hasBuildArg([]string{"VERSION=1.2.3", "VCS_REF=abc123"}, "VCS_REF"))
+	s.False(hasBuildArg([]string{"VERSION=1.2.3", "VCS_REF_SHORT=abc"}, "VCS_REF"))
+}
+
+func (s *GitSuite) TestLabelArg() {
+	s.Equal("org.concourse.oci-build-task.dirty=true", dirtyLabelArg(true))
+	s.Equal("org.concourse.oci-build-task.dirty=false", dirtyLabelArg(false))
+}
+
+func TestGit(t *testing.T) {
+	suite.Run(t, &GitSuite{
+		Assertions: require.New(t),
+	})
+}
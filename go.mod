@@ -1,31 +1,40 @@
 module github.com/concourse/oci-build-task
 
-go 1.12
+go 1.21
 
 require (
-	github.com/Azure/azure-sdk-for-go v42.3.0+incompatible // indirect
-	github.com/Azure/go-autorest/autorest v0.10.2 // indirect
-	github.com/Azure/go-autorest/autorest/validation v0.2.0 // indirect
 	github.com/BurntSushi/toml v0.4.1
-	github.com/VividCortex/ewma v1.1.1 // indirect
 	github.com/concourse/go-archive v1.0.1
-	github.com/containerd/containerd v1.3.0 // indirect
-	github.com/coreos/bbolt v1.3.2 // indirect
+	github.com/docker/docker v20.10.16+incompatible
 	github.com/fatih/color v1.13.0
 	github.com/google/go-containerregistry v0.9.0
-	github.com/googleapis/gnostic v0.2.2 // indirect
 	github.com/julienschmidt/httprouter v1.3.0
-	github.com/maxbrunsfeld/counterfeiter/v6 v6.2.2 // indirect
 	github.com/pkg/errors v0.9.1
-	github.com/prometheus/tsdb v0.7.1 // indirect
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/testify v1.7.0
 	github.com/u-root/u-root v7.0.0+incompatible
-	github.com/ugorji/go v1.1.4 // indirect
 	github.com/vbauerster/mpb v3.4.0+incompatible
-	github.com/vdemeester/k8s-pkg-credentialprovider v1.18.1-0.20201019120933-f1d16962a4db // indirect
 	github.com/vrischmann/envconfig v1.3.0
-	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
-	gotest.tools/v3 v3.0.3 // indirect
-	k8s.io/code-generator v0.17.2 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
+)
+
+require (
+	github.com/VividCortex/ewma v1.1.1 // indirect
+	github.com/containerd/stargz-snapshotter/estargz v0.11.4 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/docker/cli v20.10.16+incompatible // indirect
+	github.com/docker/distribution v2.8.1+incompatible // indirect
+	github.com/docker/docker-credential-helpers v0.6.4 // indirect
+	github.com/klauspost/compress v1.15.4 // indirect
+	github.com/mattn/go-colorable v0.1.11 // indirect
+	github.com/mattn/go-isatty v0.0.14 // indirect
+	github.com/mitchellh/go-homedir v1.1.0 // indirect
+	github.com/opencontainers/go-digest v1.0.0 // indirect
+	github.com/opencontainers/image-spec v1.0.3-0.20220114050600-8b9d41f48198 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/vbatts/tar-split v0.11.2 // indirect
+	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519 // indirect
+	golang.org/x/sync v0.0.0-20220513210516-0976fa681c29 // indirect
+	golang.org/x/sys v0.0.0-20220513210249-45d2b4557a2a // indirect
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1 // indirect
 )
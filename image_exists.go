@@ -0,0 +1,45 @@
+package task
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/pkg/errors"
+)
+
+// imageExistsTimeout bounds how long checking for an existing image may take,
+// so that an unresponsive registry doesn't hold up the build.
+const imageExistsTimeout = 30 * time.Second
+
+// imageExists returns whether the image exists in its registry, via a HEAD
+// request for its manifest, authenticating with the keychain's credentials
+// (see registryKeychain).
+func imageExists(ctx context.Context, imageName string, keychain authn.Keychain) (bool, error) {
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return false, errors.Wrap(err, "parse image name")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, imageExistsTimeout)
+	defer cancel()
+
+	_, err = remote.Head(ref,
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(keychain),
+	)
+	if err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+
+		return false, errors.Wrap(err, "check registry")
+	}
+
+	return true, nil
+}
@@ -0,0 +1,100 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ImageExistsSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	registry *httptest.Server
+	host     string
+}
+
+func (s *ImageExistsSuite) SetupTest() {
+	s.registry = httptest.NewServer(registry.New())
+
+	registryURL, err := url.Parse(s.registry.URL)
+	s.NoError(err)
+
+	s.host = registryURL.Host
+}
+
+func (s *ImageExistsSuite) TearDownTest() {
+	s.registry.Close()
+}
+
+func (s *ImageExistsSuite) TestExists() {
+	image, err := random.Image(1024, 1)
+	s.NoError(err)
+
+	imageName := fmt.Sprintf("%s/some/image:1.2.3", s.host)
+	ref, err := name.ParseReference(imageName)
+	s.NoError(err)
+	s.NoError(remote.Write(ref, image))
+
+	exists, err := imageExists(context.Background(), imageName, authn.DefaultKeychain)
+	s.NoError(err)
+	s.True(exists)
+}
+
+func (s *ImageExistsSuite) TestNotExists() {
+	exists, err := imageExists(context.Background(), fmt.Sprintf("%s/some/image:1.2.3", s.host), authn.DefaultKeychain)
+	s.NoError(err)
+	s.False(exists)
+}
+
+func (s *ImageExistsSuite) TestError() {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	brokenURL, err := url.Parse(broken.URL)
+	s.NoError(err)
+
+	_, err = imageExists(context.Background(), brokenURL.Host+"/some/image:1.2.3", authn.DefaultKeychain)
+	s.Error(err)
+}
+
+func (s *ImageExistsSuite) TestUnreachable() {
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	unreachableURL, err := url.Parse(unreachable.URL)
+	s.NoError(err)
+
+	_, err = imageExists(context.Background(), unreachableURL.Host+"/some/image:1.2.3", authn.DefaultKeychain)
+	s.Error(err)
+}
+
+func (s *ImageExistsSuite) TestSanitize() {
+	cfg := Config{SkipIfExists: true}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "image name")
+
+	cfg = Config{SkipIfExists: true, ImageName: "Some/Image:1.2.3"}
+	s.NoError(sanitize(&cfg))
+	s.Equal("some/image:1.2.3", cfg.ImageName)
+}
+
+func TestImageExists(t *testing.T) {
+	suite.Run(t, &ImageExistsSuite{
+		Assertions: require.New(t),
+	})
+}
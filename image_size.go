@@ -0,0 +1,119 @@
+package task
+
+import (
+	"bytes"
+	"path/filepath"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/pkg/errors"
+)
+
+// imageSize returns the size of the image exported to the given path, as the
+// sum of its layers' (compressed) sizes in its manifest. For an OCI image with
+// several platforms, the largest platform's size is returned.
+//
+// OCI images must have already been decompressed by loadOciImages.
+func imageSize(imagePath string, outputType string) (int64, error) {
+	if outputType != "oci" {
+		image, err := tarball.ImageFromPath(imagePath, nil)
+		if err != nil {
+			return 0, errors.Wrap(err, "open image")
+		}
+
+		manifest, err := image.Manifest()
+		if err != nil {
+			return 0, errors.Wrap(err, "get image manifest")
+		}
+
+		return layersSize(manifest), nil
+	}
+
+	l, err := layout.FromPath(filepath.Join(filepath.Dir(imagePath), "image"))
+	if err != nil {
+		return 0, errors.Wrap(err, "open oci layout")
+	}
+
+	index, err := l.ImageIndex()
+	if err != nil {
+		return 0, errors.Wrap(err, "load oci layout index")
+	}
+
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return 0, errors.Wrap(err, "get index manifest")
+	}
+
+	return largestImageSize(l, manifest)
+}
+
+func largestImageSize(l layout.Path, index *v1.IndexManifest) (int64, error) {
+	var largest int64
+	for _, desc := range index.Manifests {
+		// attestations aren't part of the image that's run
+		if desc.Annotations[referenceTypeAnnotation] == attestationManifestType {
+			continue
+		}
+
+		raw, err := l.Bytes(desc.Digest)
+		if err != nil {
+			return 0, errors.Wrapf(err, "read manifest %s", desc.Digest)
+		}
+
+		var size int64
+		if desc.MediaType.IsIndex() {
+			nested, err := v1.ParseIndexManifest(bytes.NewReader(raw))
+			if err != nil {
+				return 0, errors.Wrapf(err, "parse index %s", desc.Digest)
+			}
+
+			size, err = largestImageSize(l, nested)
+			if err != nil {
+				return 0, err
+			}
+		} else {
+			manifest, err := v1.ParseManifest(bytes.NewReader(raw))
+			if err != nil {
+				return 0, errors.Wrapf(err, "parse manifest %s", desc.Digest)
+			}
+
+			size = layersSize(manifest)
+		}
+
+		if size > largest {
+			largest = size
+		}
+	}
+
+	return largest, nil
+}
+
+func layersSize(manifest *v1.Manifest) int64 {
+	var size int64
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+
+	return size
+}
+
+// checkImageSize fails if the image exported to the given path is larger than
+// the max size.
+func checkImageSize(imagePath string, outputType string, maxSize string) error {
+	max, err := parseSize(maxSize)
+	if err != nil {
+		return errors.Wrap(err, "max image size")
+	}
+
+	size, err := imageSize(imagePath, outputType)
+	if err != nil {
+		return errors.Wrapf(err, "measure image %s", imagePath)
+	}
+
+	if size > max {
+		return errors.Errorf("image %s is %s, which exceeds the max image size of %s", imagePath, formatSize(size), formatSize(max))
+	}
+
+	return nil
+}
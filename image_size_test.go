@@ -0,0 +1,106 @@
+package task
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ImageSizeSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *ImageSizeSuite) manifestSize(image v1.Image) int64 {
+	manifest, err := image.Manifest()
+	s.NoError(err)
+
+	var size int64
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+
+	return size
+}
+
+func (s *ImageSizeSuite) TestDockerImage() {
+	image, err := random.Image(1024, 3)
+	s.NoError(err)
+
+	imagePath := filepath.Join(s.T().TempDir(), "image.tar")
+	s.NoError(tarball.WriteToFile(imagePath, name.MustParseReference("image"), image))
+
+	size, err := imageSize(imagePath, "docker")
+	s.NoError(err)
+	s.Equal(s.manifestSize(image), size)
+	s.NotZero(size)
+}
+
+func (s *ImageSizeSuite) TestOCIImage() {
+	small, err := random.Image(512, 1)
+	s.NoError(err)
+
+	large, err := random.Image(1024, 4)
+	s.NoError(err)
+
+	index := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: small},
+		mutate.IndexAddendum{Add: large},
+	)
+
+	targetDir := s.T().TempDir()
+	_, err = layout.Write(filepath.Join(targetDir, "image"), empty.Index)
+	s.NoError(err)
+
+	l, err := layout.FromPath(filepath.Join(targetDir, "image"))
+	s.NoError(err)
+	s.NoError(l.AppendIndex(index))
+
+	size, err := imageSize(filepath.Join(targetDir, "image.tar"), "oci")
+	s.NoError(err)
+	s.Equal(s.manifestSize(large), size)
+}
+
+func (s *ImageSizeSuite) TestCheck() {
+	image, err := random.Image(1024, 2)
+	s.NoError(err)
+
+	imagePath := filepath.Join(s.T().TempDir(), "image.tar")
+	s.NoError(tarball.WriteToFile(imagePath, name.MustParseReference("image"), image))
+
+	s.NoError(checkImageSize(imagePath, "docker", "1MB"))
+
+	err = checkImageSize(imagePath, "docker", "1KB")
+	s.Error(err)
+	s.Contains(err.Error(), "exceeds the max image size of 1.0KiB")
+	s.Contains(err.Error(), formatSize(s.manifestSize(image)))
+
+	s.Error(checkImageSize(imagePath, "docker", "lots"))
+	s.Error(checkImageSize(filepath.Join(s.T().TempDir(), "missing.tar"), "docker", "1MB"))
+}
+
+func (s *ImageSizeSuite) TestSanitize() {
+	cfg := Config{MaxImageSize: "500MB"}
+	s.NoError(sanitize(&cfg))
+
+	cfg = Config{MaxImageSize: "lots"}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{MaxImageSize: "500MB", StreamOutput: "/tmp/image.pipe"}
+	s.Error(sanitize(&cfg))
+}
+
+func TestImageSize(t *testing.T) {
+	suite.Run(t, &ImageSizeSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,111 @@
+package task
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// includeDirective includes another file's contents in the Dockerfile, in
+// its place, with ExpandIncludes:
+//
+//	# include common/base.dockerfile
+var includeDirective = regexp.MustCompile(`^#\s*include\s+(\S+)\s*$`)
+
+// expandIncludes returns the contents of the Dockerfile at path with its
+// include directives expanded, recursively. Included paths are relative to
+// the including file's directory.
+func expandIncludes(path string) ([]byte, error) {
+	out := new(bytes.Buffer)
+
+	err := expandInto(out, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+func expandInto(out *bytes.Buffer, path string, including []string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return errors.Wrap(err, "resolve include")
+	}
+
+	if contains(including, abs) {
+		return errors.Errorf("include cycle: %s", strings.Join(append(including, abs), " -> "))
+	}
+
+	including = append(including, abs)
+
+	file, err := os.Open(abs)
+	if err != nil {
+		return errors.Wrap(err, "open include")
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		match := includeDirective.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			out.WriteString(line + "\n")
+			continue
+		}
+
+		included := match[1]
+		if !filepath.IsAbs(included) {
+			included = filepath.Join(filepath.Dir(abs), included)
+		}
+
+		err := expandInto(out, included, including)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// writeExpandedDockerfile writes the Dockerfile with its includes expanded to
+// a temporary directory, along with its .dockerignore if it has its own, and
+// returns the new path. The directory should be removed once built.
+func writeExpandedDockerfile(dockerfilePath string) (string, error) {
+	expanded, err := expandIncludes(dockerfilePath)
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := ioutil.TempDir("", "dockerfile-")
+	if err != nil {
+		return "", errors.Wrap(err, "create temp dir")
+	}
+
+	expandedPath := filepath.Join(dir, filepath.Base(dockerfilePath))
+
+	err = ioutil.WriteFile(expandedPath, expanded, 0644)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", errors.Wrap(err, "write expanded dockerfile")
+	}
+
+	// buildkit looks for e.g. Dockerfile.dockerignore next to the Dockerfile
+	ignore, err := ioutil.ReadFile(dockerfilePath + ".dockerignore")
+	if err == nil {
+		err = ioutil.WriteFile(expandedPath+".dockerignore", ignore, 0644)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", errors.Wrap(err, "write dockerignore")
+		}
+	}
+
+	return expandedPath, nil
+}
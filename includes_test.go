@@ -0,0 +1,113 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type IncludesSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	dir string
+}
+
+func (s *IncludesSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+}
+
+func (s *IncludesSuite) write(path string, contents string) string {
+	path = filepath.Join(s.dir, path)
+	s.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+	s.NoError(ioutil.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func (s *IncludesSuite) TestExpand() {
+	s.write("common/base.dockerfile", "RUN apk add git\n# include certs.dockerfile\n")
+	s.write("common/certs.dockerfile", "COPY certs /etc/ssl/certs\n")
+	dockerfile := s.write("app/Dockerfile", "FROM alpine\n  #  include ../common/base.dockerfile\n# a regular comment\nCOPY . /app\n")
+
+	expanded, err := expandIncludes(dockerfile)
+	s.NoError(err)
+	s.Equal("FROM alpine\nRUN apk add git\nCOPY certs /etc/ssl/certs\n# a regular comment\nCOPY . /app\n", string(expanded))
+}
+
+func (s *IncludesSuite) TestNoIncludes() {
+	dockerfile := s.write("Dockerfile", "FROM alpine\nRUN true\n")
+
+	expanded, err := expandIncludes(dockerfile)
+	s.NoError(err)
+	s.Equal("FROM alpine\nRUN true\n", string(expanded))
+}
+
+func (s *IncludesSuite) TestSameFileTwice() {
+	s.write("run.dockerfile", "RUN true\n")
+	dockerfile := s.write("Dockerfile", "FROM a\n# include run.dockerfile\nFROM b\n# include run.dockerfile\n")
+
+	expanded, err := expandIncludes(dockerfile)
+	s.NoError(err)
+	s.Equal("FROM a\nRUN true\nFROM b\nRUN true\n", string(expanded))
+}
+
+func (s *IncludesSuite) TestCycle() {
+	s.write("a.dockerfile", "RUN a\n# include b.dockerfile\n")
+	s.write("b.dockerfile", "RUN b\n# include a.dockerfile\n")
+	dockerfile := s.write("Dockerfile", "FROM alpine\n# include a.dockerfile\n")
+
+	_, err := expandIncludes(dockerfile)
+	s.Error(err)
+	s.Contains(err.Error(), "include cycle")
+	s.Contains(err.Error(), "a.dockerfile -> "+filepath.Join(s.dir, "b.dockerfile")+" -> "+filepath.Join(s.dir, "a.dockerfile"))
+}
+
+func (s *IncludesSuite) TestSelfInclude() {
+	dockerfile := s.write("Dockerfile", "FROM alpine\n# include Dockerfile\n")
+
+	_, err := expandIncludes(dockerfile)
+	s.Error(err)
+	s.Contains(err.Error(), "include cycle")
+}
+
+func (s *IncludesSuite) TestMissing() {
+	dockerfile := s.write("Dockerfile", "FROM alpine\n# include missing.dockerfile\n")
+
+	_, err := expandIncludes(dockerfile)
+	s.Error(err)
+}
+
+func (s *IncludesSuite) TestWriteExpanded() {
+	s.write("run.dockerfile", "RUN true\n")
+	s.write("Dockerfile.dockerignore", "secrets/\n")
+	dockerfile := s.write("Dockerfile", "FROM alpine\n# include run.dockerfile\n")
+
+	expandedPath, err := writeExpandedDockerfile(dockerfile)
+	s.NoError(err)
+	defer os.RemoveAll(filepath.Dir(expandedPath))
+
+	s.Equal("Dockerfile", filepath.Base(expandedPath))
+
+	contents, err := ioutil.ReadFile(expandedPath)
+	s.NoError(err)
+	s.Equal("FROM alpine\nRUN true\n", string(contents))
+
+	ignore, err := ioutil.ReadFile(expandedPath + ".dockerignore")
+	s.NoError(err)
+	s.Equal("secrets/\n", string(ignore))
+
+	// the original is left untouched
+	contents, err = ioutil.ReadFile(dockerfile)
+	s.NoError(err)
+	s.Equal("FROM alpine\n# include run.dockerfile\n", string(contents))
+}
+
+func TestIncludes(t *testing.T) {
+	suite.Run(t, &IncludesSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,189 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// injectedFile records what was at a destination before a file was injected
+// there, so that it can be put back.
+type injectedFile struct {
+	path string
+
+	// the original content and mode, if the destination existed
+	existed bool
+	content []byte
+	mode    os.FileMode
+
+	// parent directories which were created for the file
+	createdDirs []string
+}
+
+// injectFiles copies each source file to its destination path within the
+// context dir, returning a func which restores the context to how it was.
+func injectFiles(contextDir string, files map[string]string) (func() error, error) {
+	dests := make([]string, 0, len(files))
+	for dest := range files {
+		dests = append(dests, dest)
+	}
+
+	sort.Strings(dests)
+
+	var injected []injectedFile
+	restore := func() error {
+		var firstErr error
+		for i := len(injected) - 1; i >= 0; i-- {
+			err := injected[i].restore()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		return firstErr
+	}
+
+	for _, dest := range dests {
+		file, err := injectFile(contextDir, dest, files[dest])
+		if err != nil {
+			restore()
+			return nil, errors.Wrapf(err, "inject '%s'", dest)
+		}
+
+		injected = append(injected, file)
+	}
+
+	return restore, nil
+}
+
+func injectFile(contextDir string, dest string, src string) (injectedFile, error) {
+	path, err := contextPath(contextDir, dest)
+	if err != nil {
+		return injectedFile{}, err
+	}
+
+	content, err := ioutil.ReadFile(src)
+	if err != nil {
+		return injectedFile{}, errors.Wrap(err, "read source")
+	}
+
+	file := injectedFile{path: path}
+
+	info, err := os.Lstat(path)
+	if err == nil {
+		if !info.Mode().IsRegular() {
+			return injectedFile{}, errors.New("destination exists and is not a regular file")
+		}
+
+		file.existed = true
+		file.mode = info.Mode().Perm()
+		file.content, err = ioutil.ReadFile(path)
+		if err != nil {
+			return injectedFile{}, errors.Wrap(err, "back up destination")
+		}
+	} else if os.IsNotExist(err) {
+		for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+			if _, err := os.Lstat(dir); err == nil {
+				break
+			}
+
+			file.createdDirs = append(file.createdDirs, dir)
+		}
+
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return injectedFile{}, errors.Wrap(err, "create parent dir")
+		}
+	} else {
+		return injectedFile{}, err
+	}
+
+	logrus.Debugf("injecting %s into context as %s", src, dest)
+
+	err = ioutil.WriteFile(path, content, 0644)
+	if err != nil {
+		file.restore()
+		return injectedFile{}, errors.Wrap(err, "write destination")
+	}
+
+	return file, nil
+}
+
+func (file injectedFile) restore() error {
+	if file.existed {
+		err := ioutil.WriteFile(file.path, file.content, file.mode)
+		if err != nil {
+			return err
+		}
+
+		return os.Chmod(file.path, file.mode)
+	}
+
+	err := os.Remove(file.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// created dirs are listed deepest first
+	for _, dir := range file.createdDirs {
+		err := os.Remove(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// contextPath resolves the relative path within the context dir, failing if it
+// would point outside of it, including via a symlink already in the context.
+func contextPath(contextDir string, rel string) (string, error) {
+	if filepath.IsAbs(rel) {
+		return "", errors.New("path must be relative to the context")
+	}
+
+	path := filepath.Join(contextDir, rel)
+	if !within(contextDir, path) {
+		return "", errors.New("path escapes the context")
+	}
+
+	root, err := filepath.EvalSymlinks(contextDir)
+	if err != nil {
+		return "", errors.Wrap(err, "resolve context dir")
+	}
+
+	// resolve the deepest parent which exists, since the rest will be created
+	dir := filepath.Dir(path)
+	for {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			if !within(root, resolved) {
+				return "", errors.New("path escapes the context via a symlink")
+			}
+
+			break
+		}
+
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		dir = filepath.Dir(dir)
+	}
+
+	return path, nil
+}
+
+func within(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,107 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type InjectSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	contextDir string
+	srcDir     string
+}
+
+func (s *InjectSuite) SetupTest() {
+	s.contextDir = s.T().TempDir()
+	s.srcDir = s.T().TempDir()
+
+	s.NoError(ioutil.WriteFile(filepath.Join(s.contextDir, "Dockerfile"), []byte("FROM busybox\n"), 0644))
+	s.NoError(ioutil.WriteFile(filepath.Join(s.contextDir, "config.yml"), []byte("original\n"), 0600))
+
+	s.NoError(ioutil.WriteFile(filepath.Join(s.srcDir, "config.yml"), []byte("generated\n"), 0644))
+	s.NoError(ioutil.WriteFile(filepath.Join(s.srcDir, "ca.crt"), []byte("cert\n"), 0644))
+}
+
+func (s *InjectSuite) read(path string) string {
+	content, err := ioutil.ReadFile(filepath.Join(s.contextDir, path))
+	s.NoError(err)
+	return string(content)
+}
+
+func (s *InjectSuite) TestInjectAndRestore() {
+	restore, err := injectFiles(s.contextDir, map[string]string{
+		"config.yml":       filepath.Join(s.srcDir, "config.yml"),
+		"certs/ca/ca.crt":  filepath.Join(s.srcDir, "ca.crt"),
+		"certs/ca/dup.crt": filepath.Join(s.srcDir, "ca.crt"),
+	})
+	s.NoError(err)
+
+	s.Equal("generated\n", s.read("config.yml"))
+	s.Equal("cert\n", s.read("certs/ca/ca.crt"))
+	s.Equal("cert\n", s.read("certs/ca/dup.crt"))
+
+	s.NoError(restore())
+
+	s.Equal("original\n", s.read("config.yml"))
+
+	info, err := os.Stat(filepath.Join(s.contextDir, "config.yml"))
+	s.NoError(err)
+	s.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	_, err = os.Stat(filepath.Join(s.contextDir, "certs"))
+	s.True(os.IsNotExist(err))
+}
+
+func (s *InjectSuite) TestTraversal() {
+	for _, dest := range []string{
+		"../outside",
+		"sub/../../outside",
+		"/etc/passwd",
+	} {
+		_, err := injectFiles(s.contextDir, map[string]string{
+			dest: filepath.Join(s.srcDir, "ca.crt"),
+		})
+		s.Error(err, dest)
+	}
+
+	_, err := os.Stat(filepath.Join(filepath.Dir(s.contextDir), "outside"))
+	s.True(os.IsNotExist(err))
+}
+
+func (s *InjectSuite) TestSymlinkTraversal() {
+	s.NoError(os.Symlink(s.srcDir, filepath.Join(s.contextDir, "link")))
+
+	_, err := injectFiles(s.contextDir, map[string]string{
+		"link/new/escaped.crt": filepath.Join(s.srcDir, "ca.crt"),
+	})
+	s.Error(err)
+	s.Contains(err.Error(), "symlink")
+
+	_, err = os.Stat(filepath.Join(s.srcDir, "new"))
+	s.True(os.IsNotExist(err))
+}
+
+func (s *InjectSuite) TestFailureRestores() {
+	_, err := injectFiles(s.contextDir, map[string]string{
+		"a.crt":      filepath.Join(s.srcDir, "ca.crt"),
+		"config.yml": filepath.Join(s.srcDir, "missing"),
+	})
+	s.Error(err)
+
+	_, err = os.Stat(filepath.Join(s.contextDir, "a.crt"))
+	s.True(os.IsNotExist(err))
+	s.Equal("original\n", s.read("config.yml"))
+}
+
+func TestInject(t *testing.T) {
+	suite.Run(t, &InjectSuite{
+		Assertions: require.New(t),
+	})
+}
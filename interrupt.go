@@ -0,0 +1,92 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// RemovePartialOutputs removes anything written to the outputs by a build
+// which did not complete, e.g. because it was interrupted, so that no
+// truncated image tarballs are left behind.
+func RemovePartialOutputs(outputsDir string, req Request) error {
+	for _, cfg := range req.Configs {
+		err := RemovePartialOutputs(filepath.Join(outputsDir, cfg.Name), Request{Config: cfg})
+		if err != nil {
+			return err
+		}
+	}
+
+	var paths []string
+	for _, output := range append([]string{"image"}, req.Config.AdditionalTargets...) {
+		for _, name := range []string{"image.tar", "image", "digest", "digest-tag", "provenance.json", "rootfs", "metadata.json", "layer-report.json"} {
+			paths = append(paths, filepath.Join(outputsDir, output, name))
+		}
+	}
+
+	if req.Config.SplitByPlatform {
+		for _, platform := range splitPlatforms(req.Config.ImagePlatform) {
+			imagePath := platformImagePath(filepath.Join(outputsDir, "image"), platform)
+			paths = append(paths, imagePath, digestPath(imagePath), digestTagPath(imagePath), layerReportPath(imagePath))
+		}
+	}
+
+	for _, spec := range req.Config.Outputs {
+		dest, ok := partialOutputDest(outputsDir, spec.Dest)
+		if !ok {
+			logrus.Warnf("not removing output '%s', which is not within the outputs", spec.Dest)
+			continue
+		}
+
+		paths = append(paths, dest)
+	}
+
+	for _, path := range paths {
+		err := os.RemoveAll(path)
+		if err != nil {
+			return errors.Wrap(err, "remove partial output")
+		}
+	}
+
+	return nil
+}
+
+// partialOutputDest returns where within the outputs dir an additional output
+// was written, or false if it may not have been written there by the build,
+// so must be left alone: an absolute destination, one outside the outputs
+// (including via a symlink), or the outputs dir or one of the task's own
+// outputs itself.
+func partialOutputDest(outputsDir string, dest string) (string, bool) {
+	if filepath.IsAbs(dest) {
+		return "", false
+	}
+
+	rel := filepath.Clean(dest)
+	if rel == "." || !isWithin(rel, ".") || contains(reservedOutputs, rel) {
+		return "", false
+	}
+
+	path := filepath.Join(outputsDir, rel)
+
+	resolvedOutputs, err := filepath.EvalSymlinks(outputsDir)
+	if err != nil {
+		return "", false
+	}
+
+	// the output's own dir, e.g. 'oci' for oci/image.tar, may be a symlink
+	// elsewhere
+	resolvedParent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		// e.g. it doesn't exist, so nothing can have been written beneath it
+		return "", false
+	}
+
+	resolved := filepath.Join(resolvedParent, filepath.Base(path))
+	if resolved == resolvedOutputs || !isWithin(resolved, resolvedOutputs) {
+		return "", false
+	}
+
+	return path, true
+}
@@ -0,0 +1,130 @@
+package task
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type InterruptSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	outputsDir string
+}
+
+func (s *InterruptSuite) SetupTest() {
+	var err error
+	s.outputsDir, err = ioutil.TempDir("", "oci-build-task-interrupt")
+	s.NoError(err)
+
+	for _, output := range []string{"image", "additional-target", "oci", "unrelated"} {
+		err := os.Mkdir(filepath.Join(s.outputsDir, output), 0755)
+		s.NoError(err)
+	}
+}
+
+func (s *InterruptSuite) TearDownTest() {
+	err := os.RemoveAll(s.outputsDir)
+	s.NoError(err)
+}
+
+func (s *InterruptSuite) TestRemovePartialOutputsOnSignal() {
+	req := Request{
+		Config: Config{
+			AdditionalTargets: []string{"additional-target"},
+			Outputs:           []OutputSpec{{Type: "oci", Dest: "oci/image.tar"}},
+		},
+	}
+
+	partial := []string{
+		s.outputPath("image", "image.tar"),
+		s.outputPath("image", "layer-report.json"),
+		s.outputPath("additional-target", "image.tar"),
+		s.outputPath("oci", "image.tar"),
+	}
+
+	for _, path := range append(partial, s.outputPath("unrelated", "file")) {
+		err := ioutil.WriteFile(path, []byte("truncated"), 0644)
+		s.NoError(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	// a long-running build step
+	done := make(chan error, 1)
+	go func() {
+		done <- runContext(ctx, ioutil.Discard, "sleep", "10")
+	}()
+
+	err := syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	s.NoError(err)
+
+	select {
+	case err := <-done:
+		s.Error(err)
+	case <-time.After(5 * time.Second):
+		s.Fail("build step was not stopped")
+	}
+
+	s.Error(ctx.Err())
+
+	err = RemovePartialOutputs(s.outputsDir, req)
+	s.NoError(err)
+
+	for _, path := range partial {
+		_, err := os.Stat(path)
+		s.True(os.IsNotExist(err), path)
+	}
+
+	// the outputs themselves, and anything unrelated, are left alone
+	_, err = os.Stat(s.outputPath("image"))
+	s.NoError(err)
+
+	_, err = os.Stat(s.outputPath("unrelated", "file"))
+	s.NoError(err)
+}
+
+func (s *InterruptSuite) TestRemovePartialOutputsLeavesOthersAlone() {
+	elsewhere := s.T().TempDir()
+	s.NoError(ioutil.WriteFile(filepath.Join(elsewhere, "precious"), []byte("data"), 0644))
+	s.NoError(os.Symlink(elsewhere, s.outputPath("linked")))
+
+	s.NoError(ioutil.WriteFile(s.outputPath("unrelated", "file"), []byte("input"), 0644))
+
+	req := Request{
+		Config: Config{
+			Outputs: []OutputSpec{
+				{Type: "local", Dest: "."},
+				{Type: "local", Dest: ".."},
+				{Type: "local", Dest: "cache"},
+				{Type: "local", Dest: elsewhere},
+				{Type: "local", Dest: "linked/precious"},
+			},
+		},
+	}
+
+	s.NoError(RemovePartialOutputs(s.outputsDir, req))
+
+	s.FileExists(s.outputPath("unrelated", "file"))
+	s.FileExists(filepath.Join(elsewhere, "precious"))
+}
+
+func (s *InterruptSuite) outputPath(path ...string) string {
+	return filepath.Join(append([]string{s.outputsDir}, path...)...)
+}
+
+func TestInterrupt(t *testing.T) {
+	suite.Run(t, &InterruptSuite{
+		Assertions: require.New(t),
+	})
+}
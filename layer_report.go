@@ -0,0 +1,101 @@
+package task
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/pkg/errors"
+)
+
+// layerReport lists the layers of an image, for spotting bloated ones.
+type layerReport struct {
+	// The sum of the layers' sizes.
+	TotalSize int64 `json:"total_size"`
+
+	Layers []layerReportEntry `json:"layers"`
+}
+
+// layerReportEntry is a layer's (compressed) size and the instruction which
+// created it, from the image's history.
+type layerReportEntry struct {
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	CreatedBy string `json:"created_by"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+// layerReportPath returns the path of the layer report for the image tarball,
+// named like its digest file, e.g. image/layer-report.json or
+// image/layer-report-linux-amd64.json.
+func layerReportPath(imagePath string) string {
+	return imageFilePath(imagePath, "layer-report") + ".json"
+}
+
+// newLayerReport reports the image's layers, matching each with the history
+// entry which created it. If the history doesn't match up with the layers,
+// e.g. as it was squashed, the instructions are left out.
+func newLayerReport(image v1.Image) (layerReport, error) {
+	manifest, err := image.Manifest()
+	if err != nil {
+		return layerReport{}, errors.Wrap(err, "get image manifest")
+	}
+
+	configFile, err := image.ConfigFile()
+	if err != nil {
+		return layerReport{}, errors.Wrap(err, "get image config")
+	}
+
+	var history []v1.History
+	for _, entry := range configFile.History {
+		if !entry.EmptyLayer {
+			history = append(history, entry)
+		}
+	}
+
+	if len(history) != len(manifest.Layers) {
+		history = nil
+	}
+
+	report := layerReport{
+		Layers: []layerReportEntry{},
+	}
+
+	for i, layer := range manifest.Layers {
+		entry := layerReportEntry{
+			Digest: layer.Digest.String(),
+			Size:   layer.Size,
+		}
+
+		if history != nil {
+			entry.CreatedBy = history[i].CreatedBy
+			entry.Comment = history[i].Comment
+		}
+
+		report.TotalSize += layer.Size
+		report.Layers = append(report.Layers, entry)
+	}
+
+	return report, nil
+}
+
+// writeLayerReport writes the report for the image tarball alongside it.
+func writeLayerReport(imagePath string) error {
+	image, err := tarball.ImageFromPath(imagePath, nil)
+	if err != nil {
+		return errors.Wrap(err, "open image")
+	}
+
+	report, err := newLayerReport(image)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal layer report")
+	}
+
+	return ioutil.WriteFile(layerReportPath(imagePath), payload, 0644)
+}
@@ -0,0 +1,110 @@
+package task
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type LayerReportSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+// image returns an image with a random layer of each size, and the given
+// history.
+func (s *LayerReportSuite) image(sizes []int64, history []v1.History) v1.Image {
+	var image v1.Image = empty.Image
+	for _, size := range sizes {
+		layer, err := random.Layer(size, types.DockerLayer)
+		s.NoError(err)
+
+		image, err = mutate.Append(image, mutate.Addendum{Layer: layer})
+		s.NoError(err)
+	}
+
+	configFile, err := image.ConfigFile()
+	s.NoError(err)
+	configFile = configFile.DeepCopy()
+	configFile.History = history
+	image, err = mutate.ConfigFile(image, configFile)
+	s.NoError(err)
+
+	return image
+}
+
+func (s *LayerReportSuite) TestWriteLayerReport() {
+	image := s.image([]int64{1024, 4096, 2048}, []v1.History{
+		{CreatedBy: "ADD rootfs.tar /"},
+		{CreatedBy: "ENV FOO=bar", EmptyLayer: true},
+		{CreatedBy: "RUN make"},
+		{CreatedBy: "COPY bin /bin", Comment: "buildkit.dockerfile.v0"},
+	})
+
+	imagePath := filepath.Join(s.T().TempDir(), "image.tar")
+	s.NoError(tarball.WriteToFile(imagePath, name.MustParseReference("some-image:some-tag"), image))
+
+	s.NoError(writeLayerReport(imagePath))
+
+	payload, err := ioutil.ReadFile(filepath.Join(filepath.Dir(imagePath), "layer-report.json"))
+	s.NoError(err)
+
+	var report layerReport
+	s.NoError(json.Unmarshal(payload, &report))
+
+	manifest, err := image.Manifest()
+	s.NoError(err)
+
+	s.Len(report.Layers, 3)
+
+	var total int64
+	for i, layer := range manifest.Layers {
+		s.Equal(layer.Digest.String(), report.Layers[i].Digest)
+		s.Equal(layer.Size, report.Layers[i].Size)
+		total += layer.Size
+	}
+
+	s.Equal(total, report.TotalSize)
+
+	s.Equal("ADD rootfs.tar /", report.Layers[0].CreatedBy)
+	s.Equal("RUN make", report.Layers[1].CreatedBy)
+	s.Equal("COPY bin /bin", report.Layers[2].CreatedBy)
+	s.Equal("buildkit.dockerfile.v0", report.Layers[2].Comment)
+}
+
+func (s *LayerReportSuite) TestHistoryMismatch() {
+	image := s.image([]int64{1024, 2048}, []v1.History{
+		{CreatedBy: "ADD rootfs.tar /"},
+	})
+
+	report, err := newLayerReport(image)
+	s.NoError(err)
+
+	s.Len(report.Layers, 2)
+	for _, layer := range report.Layers {
+		s.NotZero(layer.Size)
+		s.Empty(layer.CreatedBy)
+	}
+}
+
+func (s *LayerReportSuite) TestLayerReportPath() {
+	s.Equal(filepath.Join("image", "layer-report.json"), layerReportPath(filepath.Join("image", "image.tar")))
+	s.Equal(filepath.Join("image", "layer-report-linux-amd64.json"), layerReportPath(filepath.Join("image", "image-linux-amd64.tar")))
+}
+
+func TestLayerReport(t *testing.T) {
+	suite.Run(t, &LayerReportSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,326 @@
+package task
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/pkg/errors"
+)
+
+// opaqueWhiteout marks everything in the directory containing it as removed
+// from lower layers, as whiteoutPrefix does for a single path.
+const opaqueWhiteout = whiteoutPrefix + whiteoutPrefix + ".opq"
+
+// mergeGroups returns which adjacent layers, given their sizes, to merge to end
+// up with at most max layers: by repeatedly merging the adjacent pair which is
+// smallest combined, so that large layers, which are the most worth reusing
+// from the cache, are left alone where possible. Each group is a list of layer
+// indexes.
+func mergeGroups(sizes []int64, max int) [][]int {
+	groups := make([][]int, len(sizes))
+	groupSizes := make([]int64, len(sizes))
+	for i, size := range sizes {
+		groups[i] = []int{i}
+		groupSizes[i] = size
+	}
+
+	for len(groups) > max && len(groups) > 1 {
+		smallest := 0
+		for i := 1; i < len(groups)-1; i++ {
+			if groupSizes[i]+groupSizes[i+1] < groupSizes[smallest]+groupSizes[smallest+1] {
+				smallest = i
+			}
+		}
+
+		groups[smallest] = append(groups[smallest], groups[smallest+1]...)
+		groupSizes[smallest] += groupSizes[smallest+1]
+
+		groups = append(groups[:smallest+1], groups[smallest+2:]...)
+		groupSizes = append(groupSizes[:smallest+1], groupSizes[smallest+2:]...)
+	}
+
+	return groups
+}
+
+// limitLayers merges the image tarball's layers, re-packing it in place, so
+// that it has at most max layers.
+func limitLayers(imagePath string, max int) error {
+	tmpDir, err := ioutil.TempDir("", "merged-layers-")
+	if err != nil {
+		return errors.Wrap(err, "create temp dir")
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	return rewriteImageTarball(imagePath, func(image v1.Image) (v1.Image, error) {
+		return mergeImageLayers(image, max, tmpDir)
+	})
+}
+
+// mergeImageLayers returns the image with its layers merged down to at most
+// max, writing the merged layers to tmpDir.
+func mergeImageLayers(image v1.Image, max int, tmpDir string) (v1.Image, error) {
+	layers, err := image.Layers()
+	if err != nil {
+		return nil, errors.Wrap(err, "get image layers")
+	}
+
+	if len(layers) <= max {
+		return image, nil
+	}
+
+	sizes := make([]int64, len(layers))
+	for i, layer := range layers {
+		sizes[i], err = layer.Size()
+		if err != nil {
+			return nil, errors.Wrap(err, "get layer size")
+		}
+	}
+
+	groups := mergeGroups(sizes, max)
+
+	merged := make([]v1.Layer, len(groups))
+	for i, group := range groups {
+		if len(group) == 1 {
+			merged[i] = layers[group[0]]
+			continue
+		}
+
+		groupLayers := make([]v1.Layer, len(group))
+		for j, index := range group {
+			groupLayers[j] = layers[index]
+		}
+
+		merged[i], err = mergeLayers(groupLayers, tmpDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	configFile, err := image.ConfigFile()
+	if err != nil {
+		return nil, errors.Wrap(err, "get image config")
+	}
+
+	mediaType, err := image.MediaType()
+	if err != nil {
+		return nil, errors.Wrap(err, "get image media type")
+	}
+
+	manifest, err := image.Manifest()
+	if err != nil {
+		return nil, errors.Wrap(err, "get image manifest")
+	}
+
+	base := mutate.ConfigMediaType(mutate.MediaType(empty.Image, mediaType), manifest.Config.MediaType)
+
+	rebuilt, err := mutate.AppendLayers(base, merged...)
+	if err != nil {
+		return nil, errors.Wrap(err, "append merged layers")
+	}
+
+	rebuiltConfig, err := rebuilt.ConfigFile()
+	if err != nil {
+		return nil, errors.Wrap(err, "get merged config")
+	}
+
+	configFile = configFile.DeepCopy()
+	configFile.RootFS.DiffIDs = rebuiltConfig.RootFS.DiffIDs
+	configFile.History = mergeHistory(configFile.History, groups)
+
+	return mutate.ConfigFile(rebuilt, configFile)
+}
+
+// mergeHistory updates the image's history for its layers having been merged
+// into the groups: the first entry for each group keeps the layer, and the rest
+// are marked as empty. The history is dropped if it doesn't match up with the
+// layers.
+func mergeHistory(history []v1.History, groups [][]int) []v1.History {
+	merged := make([]v1.History, 0, len(history))
+
+	layerGroup := map[int]int{}
+	for g, group := range groups {
+		for _, index := range group {
+			layerGroup[index] = g
+		}
+	}
+
+	layer := 0
+	seen := map[int]bool{}
+	for _, entry := range history {
+		if !entry.EmptyLayer {
+			g, found := layerGroup[layer]
+			if !found {
+				return nil
+			}
+
+			if seen[g] {
+				entry.EmptyLayer = true
+				entry.Comment = strings.TrimSpace(entry.Comment + " (merged into an earlier layer)")
+			}
+
+			seen[g] = true
+			layer++
+		}
+
+		merged = append(merged, entry)
+	}
+
+	if layer != len(layerGroup) {
+		return nil
+	}
+
+	return merged
+}
+
+// whiteouts are the paths removed by whiteouts in a set of layers.
+type whiteouts struct {
+	removed map[string]bool
+	opaque  map[string]bool
+}
+
+func (w whiteouts) add(name string) {
+	dir, base := path.Split(name)
+	dir = path.Clean(dir)
+
+	if base == opaqueWhiteout {
+		w.opaque[dir] = true
+	} else if strings.HasPrefix(base, whiteoutPrefix) {
+		w.removed[path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))] = true
+	}
+}
+
+// hides returns whether a lower layer's entry is removed by the whiteouts.
+func (w whiteouts) hides(name string) bool {
+	if w.removed[name] {
+		return true
+	}
+
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if w.removed[dir] || w.opaque[dir] {
+			return true
+		}
+	}
+
+	return w.opaque["."] && name != "."
+}
+
+// cleanEntryName normalizes a tar entry's name, e.g. ./usr/bin/ to usr/bin.
+func cleanEntryName(name string) string {
+	return path.Clean(strings.TrimPrefix(name, "/"))
+}
+
+// mergeLayers combines the layers, lowest first, into one layer written to
+// tmpDir. Whiteouts only apply to lower layers, so entries removed by a
+// whiteout in a higher layer are dropped; the whiteouts themselves are kept
+// for the layers below. Entries replaced in a higher layer are kept, since
+// later entries win when the layer is extracted.
+func mergeLayers(layers []v1.Layer, tmpDir string) (v1.Layer, error) {
+	// the whiteouts in the layers above each layer
+	above := make([]whiteouts, len(layers))
+	current := whiteouts{removed: map[string]bool{}, opaque: map[string]bool{}}
+	for i := len(layers) - 1; i >= 0; i-- {
+		above[i] = whiteouts{removed: map[string]bool{}, opaque: map[string]bool{}}
+		for name := range current.removed {
+			above[i].removed[name] = true
+		}
+
+		for name := range current.opaque {
+			above[i].opaque[name] = true
+		}
+
+		err := eachLayerEntry(layers[i], func(header *tar.Header, _ io.Reader) error {
+			current.add(cleanEntryName(header.Name))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mergedFile, err := ioutil.TempFile(tmpDir, "layer-*.tar")
+	if err != nil {
+		return nil, errors.Wrap(err, "create merged layer")
+	}
+
+	defer mergedFile.Close()
+
+	writer := tar.NewWriter(mergedFile)
+	for i, layer := range layers {
+		dropped := map[string]bool{}
+		err := eachLayerEntry(layer, func(header *tar.Header, content io.Reader) error {
+			name := cleanEntryName(header.Name)
+			if above[i].hides(name) {
+				dropped[name] = true
+				return nil
+			}
+
+			if header.Typeflag == tar.TypeLink && dropped[cleanEntryName(header.Linkname)] {
+				return errors.Errorf("cannot merge layers: hard link %s is to removed file %s", header.Name, header.Linkname)
+			}
+
+			err := writer.WriteHeader(header)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(writer, content)
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "write merged layer")
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "write merged layer")
+	}
+
+	err = mergedFile.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "write merged layer")
+	}
+
+	mediaType, err := layers[0].MediaType()
+	if err != nil {
+		return nil, errors.Wrap(err, "get layer media type")
+	}
+
+	return tarball.LayerFromFile(mergedFile.Name(), tarball.WithMediaType(mediaType))
+}
+
+// eachLayerEntry calls fn with each entry in the layer's uncompressed tarball.
+func eachLayerEntry(layer v1.Layer, fn func(*tar.Header, io.Reader) error) error {
+	contents, err := layer.Uncompressed()
+	if err != nil {
+		return errors.Wrap(err, "read layer")
+	}
+
+	defer contents.Close()
+
+	reader := tar.NewReader(contents)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "read layer")
+		}
+
+		err = fn(header, reader)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package task
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type LayersSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+// layer returns a layer containing the given files, with content, or
+// directories, with a trailing slash.
+func (s *LayersSuite) layer(files ...string) v1.Layer {
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+
+	for _, file := range files {
+		if file[len(file)-1] == '/' {
+			s.NoError(writer.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: file, Mode: 0755}))
+			continue
+		}
+
+		s.NoError(writer.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: file, Mode: 0644, Size: int64(len(file))}))
+		_, err := writer.Write([]byte(file))
+		s.NoError(err)
+	}
+
+	s.NoError(writer.Close())
+
+	contents := buf.Bytes()
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(contents)), nil
+	})
+	s.NoError(err)
+
+	return layer
+}
+
+func (s *LayersSuite) entries(layer v1.Layer) []string {
+	names := []string{}
+	s.NoError(eachLayerEntry(layer, func(header *tar.Header, _ io.Reader) error {
+		names = append(names, header.Name)
+		return nil
+	}))
+
+	return names
+}
+
+func (s *LayersSuite) TestMergeGroups() {
+	s.Equal([][]int{{0}, {1, 2}, {3}}, mergeGroups([]int64{100, 5, 10, 50}, 3))
+	s.Equal([][]int{{0}, {1, 2, 3}}, mergeGroups([]int64{100, 5, 10, 50}, 2))
+	s.Equal([][]int{{0, 1, 2, 3}}, mergeGroups([]int64{100, 5, 10, 50}, 1))
+	s.Equal([][]int{{0, 1}, {2}, {3}}, mergeGroups([]int64{1, 1, 100, 100}, 3))
+	s.Equal([][]int{{0}, {1}}, mergeGroups([]int64{1, 2}, 5))
+}
+
+func (s *LayersSuite) TestMergeWhiteouts() {
+	merged, err := mergeLayers([]v1.Layer{
+		s.layer("etc/", "etc/keep", "etc/removed", "var/", "var/cache/", "var/cache/a", "tmp/", "tmp/b"),
+		s.layer("etc/.wh.removed", "var/cache/.wh..wh..opq", "var/cache/new", "tmp/c"),
+		s.layer(".wh.tmp", "etc/removed"),
+	}, s.T().TempDir())
+	s.NoError(err)
+
+	s.Equal([]string{
+		"etc/", "etc/keep", "var/", "var/cache/",
+		"etc/.wh.removed", "var/cache/.wh..wh..opq", "var/cache/new",
+		".wh.tmp", "etc/removed",
+	}, s.entries(merged))
+}
+
+func (s *LayersSuite) TestLimitLayers() {
+	big, err := random.Layer(4096, types.DockerLayer)
+	s.NoError(err)
+
+	big2, err := random.Layer(4096, types.DockerLayer)
+	s.NoError(err)
+
+	layers := []v1.Layer{big, s.layer("a"), s.layer("b"), s.layer("c"), big2}
+
+	history := []v1.History{}
+	for _, createdBy := range []string{"ADD big", "RUN a", "ENV FOO=bar", "RUN b", "RUN c", "ADD big2"} {
+		history = append(history, v1.History{CreatedBy: createdBy, EmptyLayer: createdBy == "ENV FOO=bar"})
+	}
+
+	var image v1.Image = empty.Image
+	for i, layer := range layers {
+		image, err = mutate.Append(image, mutate.Addendum{Layer: layer})
+		s.NoError(err, i)
+	}
+
+	configFile, err := image.ConfigFile()
+	s.NoError(err)
+	configFile = configFile.DeepCopy()
+	configFile.History = history
+	configFile.Config.Cmd = []string{"run"}
+	image, err = mutate.ConfigFile(image, configFile)
+	s.NoError(err)
+
+	imagePath := filepath.Join(s.T().TempDir(), "image.tar")
+	s.NoError(tarball.WriteToFile(imagePath, name.MustParseReference("some-image:some-tag"), image))
+
+	s.NoError(limitLayers(imagePath, 3))
+
+	limited, err := tarball.ImageFromPath(imagePath, nil)
+	s.NoError(err)
+
+	limitedLayers, err := limited.Layers()
+	s.NoError(err)
+	s.Len(limitedLayers, 3)
+
+	s.Equal([]string{"a", "b", "c"}, s.entries(limitedLayers[1]))
+
+	limitedConfig, err := limited.ConfigFile()
+	s.NoError(err)
+	s.Equal([]string{"run"}, limitedConfig.Config.Cmd)
+	s.Len(limitedConfig.RootFS.DiffIDs, 3)
+
+	for i, layer := range limitedLayers {
+		diffID, err := layer.DiffID()
+		s.NoError(err)
+		s.Equal(diffID, limitedConfig.RootFS.DiffIDs[i])
+	}
+
+	empty := []bool{}
+	for _, entry := range limitedConfig.History {
+		empty = append(empty, entry.EmptyLayer)
+	}
+	s.Equal([]bool{false, false, true, true, true, false}, empty)
+	s.Equal("(merged into an earlier layer)", limitedConfig.History[3].Comment)
+
+	// already within the limit
+	s.NoError(limitLayers(imagePath, 3))
+}
+
+func (s *LayersSuite) TestMergeHistoryMismatch() {
+	s.Nil(mergeHistory([]v1.History{{CreatedBy: "RUN a"}}, [][]int{{0, 1}}))
+}
+
+func (s *LayersSuite) TestSanitize() {
+	cfg := Config{MaxLayers: -1}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{MaxLayers: 10, OutputType: "oci"}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{MaxLayers: 10}
+	s.NoError(sanitize(&cfg))
+}
+
+func TestLayers(t *testing.T) {
+	suite.Run(t, &LayersSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,98 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/pkg/errors"
+)
+
+// checkSecretLeaks fails if the value of any of the build's secrets, by id,
+// appears in the image's config or history, e.g. because a RUN step echoed it
+// into an env var or label, or it was passed as a build arg.
+func checkSecretLeaks(imagePath string, secrets map[string]string) error {
+	image, err := tarball.ImageFromPath(imagePath, nil)
+	if err != nil {
+		return errors.Wrap(err, "open image")
+	}
+
+	config, err := image.ConfigFile()
+	if err != nil {
+		return errors.Wrap(err, "read image config")
+	}
+
+	leaked := leakedSecrets(config, secrets)
+	if len(leaked) > 0 {
+		return errors.Errorf("secret(s) leaked into the image config or history: %s", strings.Join(leaked, ", "))
+	}
+
+	return nil
+}
+
+// secretValues returns the values of the build's secrets by id, read from the
+// files of the BuildkitSecrets and the env vars of the SecretsEnv.
+func secretValues(cfg Config) (map[string]string, error) {
+	values := map[string]string{}
+	for id, path := range cfg.BuildkitSecrets {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read secret '%s'", id)
+		}
+
+		values[id] = string(content)
+	}
+
+	for id, env := range cfg.SecretsEnv {
+		values[id] = os.Getenv(env)
+	}
+
+	return values, nil
+}
+
+// leakedSecrets returns the ids of the secrets whose values appear in the
+// image config.
+func leakedSecrets(config *v1.ConfigFile, secrets map[string]string) []string {
+	fields := configStrings(config)
+
+	var leaked []string
+	for id, value := range secrets {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		for _, field := range fields {
+			if strings.Contains(field, value) {
+				leaked = append(leaked, id)
+				break
+			}
+		}
+	}
+
+	sort.Strings(leaked)
+
+	return leaked
+}
+
+// configStrings returns all of the free-form strings in the image config.
+func configStrings(config *v1.ConfigFile) []string {
+	var fields []string
+	fields = append(fields, config.Config.Env...)
+	fields = append(fields, config.Config.Cmd...)
+	fields = append(fields, config.Config.Entrypoint...)
+	fields = append(fields, config.Config.User, config.Config.WorkingDir)
+
+	for key, value := range config.Config.Labels {
+		fields = append(fields, key, value)
+	}
+
+	for _, history := range config.History {
+		fields = append(fields, history.CreatedBy, history.Comment)
+	}
+
+	return fields
+}
@@ -0,0 +1,129 @@
+package task
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type LeaksSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	dir string
+	cfg Config
+}
+
+func (s *LeaksSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+
+	s.cfg = Config{
+		BuildkitSecrets: map[string]string{
+			"token":  filepath.Join(s.dir, "token"),
+			"config": filepath.Join(s.dir, "config"),
+		},
+	}
+
+	s.NoError(ioutil.WriteFile(s.cfg.BuildkitSecrets["token"], []byte("s3cr3t-t0ken\n"), 0600))
+	s.NoError(ioutil.WriteFile(s.cfg.BuildkitSecrets["config"], []byte("password: hunter22\n"), 0600))
+}
+
+func (s *LeaksSuite) secrets() map[string]string {
+	secrets, err := secretValues(s.cfg)
+	s.NoError(err)
+
+	return secrets
+}
+
+func (s *LeaksSuite) image(history ...v1.History) string {
+	image, err := mutate.ConfigFile(empty.Image, &v1.ConfigFile{
+		Architecture: "amd64",
+		OS:           "linux",
+		Config: v1.Config{
+			Env:    []string{"PATH=/usr/local/bin:/usr/bin:/bin"},
+			Labels: map[string]string{"org.opencontainers.image.source": "https://example.com/repo"},
+		},
+		History: history,
+	})
+	s.NoError(err)
+
+	imagePath := filepath.Join(s.dir, "image.tar")
+	s.NoError(tarball.WriteToFile(imagePath, name.MustParseReference("leak-test:latest"), image))
+
+	return imagePath
+}
+
+func (s *LeaksSuite) TestNoLeaks() {
+	imagePath := s.image(v1.History{
+		CreatedBy: "RUN --mount=type=secret,id=token sh -c 'curl -H @/run/secrets/token https://example.com'",
+	})
+
+	s.NoError(checkSecretLeaks(imagePath, s.secrets()))
+}
+
+func (s *LeaksSuite) TestLeakInHistory() {
+	imagePath := s.image(v1.History{
+		CreatedBy: "RUN |1 TOKEN=s3cr3t-t0ken /bin/sh -c curl -H \"Authorization: $TOKEN\" https://example.com",
+	})
+
+	err := checkSecretLeaks(imagePath, s.secrets())
+	s.Error(err)
+	s.Contains(err.Error(), "leaked")
+	s.Contains(err.Error(), "token")
+	s.NotContains(err.Error(), "s3cr3t-t0ken")
+}
+
+func (s *LeaksSuite) TestLeakInEnv() {
+	leaked := leakedSecrets(&v1.ConfigFile{
+		Config: v1.Config{
+			Env: []string{"CONFIG=password: hunter22"},
+		},
+	}, s.secrets())
+	s.Equal([]string{"config"}, leaked)
+}
+
+func (s *LeaksSuite) TestLeakedEnvSecret() {
+	s.T().Setenv("NPM_TOKEN", "npm_4bcd3fgh")
+	s.cfg.SecretsEnv = map[string]string{"npm": "NPM_TOKEN"}
+
+	imagePath := s.image(v1.History{
+		CreatedBy: "RUN |1 NPM_TOKEN=npm_4bcd3fgh /bin/sh -c npm ci",
+	})
+
+	err := checkSecretLeaks(imagePath, s.secrets())
+	s.Error(err)
+	s.Contains(err.Error(), "npm")
+	s.NotContains(err.Error(), "token")
+	s.NotContains(err.Error(), "npm_4bcd3fgh")
+}
+
+func (s *LeaksSuite) TestUnreadableSecret() {
+	s.cfg.BuildkitSecrets["missing"] = filepath.Join(s.dir, "missing")
+
+	_, err := secretValues(s.cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "'missing'")
+}
+
+func (s *LeaksSuite) TestEmptySecretIgnored() {
+	s.NoError(ioutil.WriteFile(s.cfg.BuildkitSecrets["token"], []byte("\n"), 0600))
+
+	leaked := leakedSecrets(&v1.ConfigFile{
+		History: []v1.History{{CreatedBy: "RUN echo hello"}},
+	}, s.secrets())
+	s.Empty(leaked)
+}
+
+func TestLeaks(t *testing.T) {
+	suite.Run(t, &LeaksSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,127 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultHadolintPath is the hadolint binary looked up in the PATH unless
+// another is configured.
+const defaultHadolintPath = "hadolint"
+
+// defaultLintSeverity is the lowest severity of finding that fails the build
+// unless another is configured.
+const defaultLintSeverity = "error"
+
+// lintSeverities are hadolint's severities, from lowest to highest.
+var lintSeverities = []string{"style", "info", "warning", "error"}
+
+// lintFinding is a single issue reported in hadolint's JSON output.
+type lintFinding struct {
+	Code    string `json:"code"`
+	Level   string `json:"level"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// severityRank returns where the severity is in lintSeverities, or -1 if it
+// isn't one of them.
+func severityRank(severity string) int {
+	for i, s := range lintSeverities {
+		if s == severity {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// validateLintSeverity checks the severity is one of hadolint's.
+func validateLintSeverity(severity string) error {
+	if severityRank(severity) == -1 {
+		return errors.Errorf("invalid lint severity '%s': expected one of %s", severity, strings.Join(lintSeverities, ", "))
+	}
+
+	return nil
+}
+
+// hadolintCommand returns the command for linting the Dockerfile. Findings are
+// reported as JSON without failing, so that which fail the build is decided
+// by lintFailures.
+func hadolintCommand(cfg Config) []string {
+	cmd := []string{cfg.HadolintPath, "--format", "json", "--no-fail"}
+
+	if cfg.HadolintConfig != "" {
+		cmd = append(cmd, "--config", cfg.HadolintConfig)
+	}
+
+	return append(cmd, cfg.DockerfilePath)
+}
+
+// lintFailures returns the findings at or above the given severity.
+func lintFailures(findings []lintFinding, severity string) []lintFinding {
+	threshold := severityRank(severity)
+
+	var failures []lintFinding
+	for _, finding := range findings {
+		if severityRank(finding.Level) >= threshold {
+			failures = append(failures, finding)
+		}
+	}
+
+	return failures
+}
+
+// lintDockerfile runs hadolint against the Dockerfile, failing if it reports
+// anything at or above the LintSeverity. Linting is skipped with a warning if
+// hadolint isn't installed.
+func lintDockerfile(cfg Config) error {
+	_, err := exec.LookPath(cfg.HadolintPath)
+	if err != nil {
+		logrus.Warnf("skipping lint as '%s' is not installed", cfg.HadolintPath)
+		return nil
+	}
+
+	cmd := hadolintCommand(cfg)
+
+	logrus.Info("linting dockerfile")
+	logrus.Debugf("running %s", strings.Join(cmd, " "))
+
+	// only stdout is the JSON; anything on stderr, e.g. warnings about its
+	// config, would break parsing it
+	hadolint := exec.Command(cmd[0], cmd[1:]...)
+
+	var stderr bytes.Buffer
+	hadolint.Stderr = &stderr
+
+	out, err := hadolint.Output()
+	if err != nil {
+		return errors.Wrapf(err, "run hadolint: %s", bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	if stderr.Len() > 0 {
+		logrus.Warnf("hadolint: %s", bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var findings []lintFinding
+	err = json.Unmarshal(out, &findings)
+	if err != nil {
+		return errors.Wrapf(err, "parse hadolint output: %s", bytes.TrimSpace(out))
+	}
+
+	for _, finding := range findings {
+		logrus.Warnf("%s:%d %s %s: %s", cfg.DockerfilePath, finding.Line, finding.Code, finding.Level, finding.Message)
+	}
+
+	failures := lintFailures(findings, cfg.LintSeverity)
+	if len(failures) > 0 {
+		return errors.Errorf("dockerfile has %d lint finding(s) of severity '%s' or higher", len(failures), cfg.LintSeverity)
+	}
+
+	return nil
+}
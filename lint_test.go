@@ -0,0 +1,106 @@
+package task
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type LintSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+var lintFindings = []lintFinding{
+	{Code: "DL3006", Level: "warning", Line: 1, Message: "Always tag the version of an image explicitly"},
+	{Code: "DL3059", Level: "info", Line: 3, Message: "Multiple consecutive `RUN` instructions."},
+	{Code: "DL3000", Level: "error", Line: 4, Message: "Use absolute WORKDIR"},
+}
+
+// fakeHadolint writes a script which prints the given output in place of
+// hadolint.
+func (s *LintSuite) fakeHadolint(output string) string {
+	path := filepath.Join(s.T().TempDir(), "hadolint")
+	s.NoError(ioutil.WriteFile(path, []byte("#!/bin/sh\ncat <<'EOF'\n"+output+"\nEOF\n"), 0755))
+	return path
+}
+
+func (s *LintSuite) TestCommand() {
+	s.Equal(
+		[]string{"hadolint", "--format", "json", "--no-fail", "Dockerfile"},
+		hadolintCommand(Config{HadolintPath: "hadolint", DockerfilePath: "Dockerfile"}),
+	)
+
+	s.Equal(
+		[]string{"/usr/local/bin/hadolint", "--format", "json", "--no-fail", "--config", "ci/hadolint.yaml", "src/Dockerfile"},
+		hadolintCommand(Config{HadolintPath: "/usr/local/bin/hadolint", HadolintConfig: "ci/hadolint.yaml", DockerfilePath: "src/Dockerfile"}),
+	)
+}
+
+func (s *LintSuite) TestSeverityGating() {
+	s.Equal(lintFindings[2:], lintFailures(lintFindings, "error"))
+	s.Equal([]lintFinding{lintFindings[0], lintFindings[2]}, lintFailures(lintFindings, "warning"))
+	s.Equal(lintFindings, lintFailures(lintFindings, "info"))
+	s.Equal(lintFindings, lintFailures(lintFindings, "style"))
+	s.Empty(lintFailures(lintFindings[:2], "error"))
+}
+
+func (s *LintSuite) TestLint() {
+	cfg := Config{
+		Lint:           true,
+		LintSeverity:   "warning",
+		HadolintPath:   s.fakeHadolint(`[{"code":"DL3059","level":"info","line":3,"message":"Multiple consecutive RUN instructions."}]`),
+		DockerfilePath: "Dockerfile",
+	}
+	s.NoError(lintDockerfile(cfg))
+
+	cfg.HadolintPath = s.fakeHadolint(`[{"code":"DL3006","level":"warning","line":1,"message":"Always tag the version of an image explicitly"}]`)
+	err := lintDockerfile(cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "1 lint finding(s) of severity 'warning' or higher")
+
+	cfg.HadolintPath = s.fakeHadolint(`not json`)
+	err = lintDockerfile(cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "parse hadolint output")
+}
+
+func (s *LintSuite) TestStderrIgnored() {
+	path := filepath.Join(s.T().TempDir(), "hadolint")
+	s.NoError(ioutil.WriteFile(path, []byte("#!/bin/sh\necho 'warning: unknown config key' >&2\necho '[]'\n"), 0755))
+
+	s.NoError(lintDockerfile(Config{
+		Lint:           true,
+		LintSeverity:   "error",
+		HadolintPath:   path,
+		DockerfilePath: "Dockerfile",
+	}))
+}
+
+func (s *LintSuite) TestNotInstalled() {
+	s.NoError(lintDockerfile(Config{
+		Lint:           true,
+		LintSeverity:   "error",
+		HadolintPath:   filepath.Join(s.T().TempDir(), "hadolint"),
+		DockerfilePath: "Dockerfile",
+	}))
+}
+
+func (s *LintSuite) TestSanitize() {
+	cfg := Config{Lint: true}
+	s.NoError(sanitize(&cfg))
+	s.Equal("hadolint", cfg.HadolintPath)
+	s.Equal("error", cfg.LintSeverity)
+
+	cfg = Config{Lint: true, LintSeverity: "fatal"}
+	s.Error(sanitize(&cfg))
+}
+
+func TestLint(t *testing.T) {
+	suite.Run(t, &LintSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,78 @@
+package task
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const lockPollInterval = 100 * time.Millisecond
+
+// Lock is an exclusive flock held on a file.
+type Lock struct {
+	file *os.File
+}
+
+// AcquireLock takes an exclusive flock on the given path, creating it if
+// needed. It waits for the lock to be released by any other holder, giving up
+// after the timeout or once the context is done; a zero timeout waits until
+// then.
+//
+// It is taken before spawning buildkitd, so that builds sharing its root
+// don't run buildkitd on it at once.
+func AcquireLock(ctx context.Context, path string, timeout time.Duration) (*Lock, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "open lock file")
+	}
+
+	start := time.Now()
+	waiting := false
+	for {
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+
+		if err != syscall.EWOULDBLOCK {
+			file.Close()
+			return nil, errors.Wrap(err, "lock")
+		}
+
+		if timeout != 0 && time.Since(start) >= timeout {
+			file.Close()
+			return nil, errors.Errorf("timed out after %s waiting for lock on %s", timeout, path)
+		}
+
+		if !waiting {
+			logrus.Infof("waiting for lock on %s", path)
+			waiting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, errors.Wrapf(ctx.Err(), "waiting for lock on %s", path)
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	logrus.Debugf("acquired lock on %s", path)
+
+	return &Lock{file: file}, nil
+}
+
+// Release releases the lock.
+func (l *Lock) Release() error {
+	err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	if err != nil {
+		l.file.Close()
+		return errors.Wrap(err, "unlock")
+	}
+
+	return l.file.Close()
+}
@@ -0,0 +1,101 @@
+package task
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type LockSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	lockPath string
+}
+
+func (s *LockSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "oci-build-task-lock")
+	s.NoError(err)
+
+	s.lockPath = filepath.Join(dir, "build.lock")
+}
+
+func (s *LockSuite) TearDownTest() {
+	err := os.RemoveAll(filepath.Dir(s.lockPath))
+	s.NoError(err)
+}
+
+func (s *LockSuite) TestAcquireAndRelease() {
+	l, err := AcquireLock(context.Background(), s.lockPath, time.Second)
+	s.NoError(err)
+
+	err = l.Release()
+	s.NoError(err)
+
+	// can be re-acquired once released
+	l, err = AcquireLock(context.Background(), s.lockPath, time.Second)
+	s.NoError(err)
+
+	err = l.Release()
+	s.NoError(err)
+}
+
+func (s *LockSuite) TestTimeout() {
+	held, err := AcquireLock(context.Background(), s.lockPath, time.Second)
+	s.NoError(err)
+
+	defer held.Release()
+
+	start := time.Now()
+	_, err = AcquireLock(context.Background(), s.lockPath, 300*time.Millisecond)
+	s.Error(err)
+	s.Contains(err.Error(), "timed out")
+	s.True(time.Since(start) >= 300*time.Millisecond)
+}
+
+func (s *LockSuite) TestWaitsForRelease() {
+	held, err := AcquireLock(context.Background(), s.lockPath, time.Second)
+	s.NoError(err)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		held.Release()
+	}()
+
+	l, err := AcquireLock(context.Background(), s.lockPath, 5*time.Second)
+	s.NoError(err)
+
+	err = l.Release()
+	s.NoError(err)
+}
+
+func (s *LockSuite) TestStopsWaitingWhenDone() {
+	held, err := AcquireLock(context.Background(), s.lockPath, time.Second)
+	s.NoError(err)
+
+	defer held.Release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+
+	// without a timeout, only the context stops it waiting
+	_, err = AcquireLock(ctx, s.lockPath, 0)
+	s.Error(err)
+	s.Equal(context.Canceled, errors.Cause(err))
+}
+
+func TestLock(t *testing.T) {
+	suite.Run(t, &LockSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,169 @@
+package task
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Metric names written to the $METRICS_FILE.
+const (
+	metricBuildDuration = "oci_build_task_build_duration_seconds"
+	metricImageSize     = "oci_build_task_image_size_bytes"
+	metricCacheHitRatio = "oci_build_task_cache_hit_ratio"
+)
+
+// buildctl's plain progress output names each vertex when it starts and marks
+// it when it was satisfied from the cache:
+//
+//	#5 [2/3] RUN apk add git
+//	#5 CACHED
+var (
+	vertexLine = regexp.MustCompile(`^#(\d+) \[`)
+	cachedLine = regexp.MustCompile(`^#(\d+) CACHED$`)
+)
+
+// cacheCollector is an io.Writer which counts the build steps, and the steps
+// which were cached, in buildctl output written to it.
+type cacheCollector struct {
+	partial []byte
+	steps   map[string]bool
+	cached  map[string]bool
+
+	// vertex numbers restart with each buildctl invocation
+	build int
+}
+
+func (collector *cacheCollector) Write(p []byte) (int, error) {
+	collector.partial = scanLines(collector.partial, p, collector.scan)
+	return len(p), nil
+}
+
+// Next marks the start of another buildctl invocation.
+func (collector *cacheCollector) Next() {
+	collector.flush()
+	collector.build++
+}
+
+// HitRatio returns the ratio of cached steps to all steps seen, or 0 if no
+// steps were seen.
+func (collector *cacheCollector) HitRatio() float64 {
+	collector.flush()
+
+	if len(collector.steps) == 0 {
+		return 0
+	}
+
+	return float64(len(collector.cached)) / float64(len(collector.steps))
+}
+
+func (collector *cacheCollector) flush() {
+	if len(collector.partial) > 0 {
+		collector.scan(string(collector.partial))
+		collector.partial = nil
+	}
+}
+
+func (collector *cacheCollector) scan(line string) {
+	if collector.steps == nil {
+		collector.steps = map[string]bool{}
+		collector.cached = map[string]bool{}
+	}
+
+	if match := vertexLine.FindStringSubmatch(line); match != nil {
+		collector.steps[fmt.Sprintf("%d/%s", collector.build, match[1])] = true
+	} else if match := cachedLine.FindStringSubmatch(line); match != nil {
+		collector.cached[fmt.Sprintf("%d/%s", collector.build, match[1])] = true
+	}
+}
+
+type buildMetrics struct {
+	Duration      time.Duration
+	CacheHitRatio float64
+
+	// ImageSizes maps each output (e.g. "image") to the total size of its
+	// image tarballs.
+	ImageSizes map[string]int64
+}
+
+// imageSizes returns the total size of the image tarballs that were written,
+// keyed by output name.
+func imageSizes(imagePaths []string) map[string]int64 {
+	sizes := map[string]int64{}
+	for _, imagePath := range imagePaths {
+		info, err := os.Stat(imagePath)
+		if err != nil {
+			continue
+		}
+
+		sizes[filepath.Base(filepath.Dir(imagePath))] += info.Size()
+	}
+
+	return sizes
+}
+
+// formatMetrics renders the metrics in the Prometheus text exposition format.
+func formatMetrics(metrics buildMetrics) string {
+	out := new(strings.Builder)
+
+	fmt.Fprintf(out, "# HELP %s Time taken to build the image.\n", metricBuildDuration)
+	fmt.Fprintf(out, "# TYPE %s gauge\n", metricBuildDuration)
+	fmt.Fprintf(out, "%s %g\n", metricBuildDuration, metrics.Duration.Seconds())
+
+	if len(metrics.ImageSizes) > 0 {
+		outputs := make([]string, 0, len(metrics.ImageSizes))
+		for output := range metrics.ImageSizes {
+			outputs = append(outputs, output)
+		}
+
+		sort.Strings(outputs)
+
+		fmt.Fprintf(out, "# HELP %s Size of the image tarball.\n", metricImageSize)
+		fmt.Fprintf(out, "# TYPE %s gauge\n", metricImageSize)
+		for _, output := range outputs {
+			fmt.Fprintf(out, "%s{output=%q} %d\n", metricImageSize, output, metrics.ImageSizes[output])
+		}
+	}
+
+	fmt.Fprintf(out, "# HELP %s Ratio of build steps satisfied from the cache.\n", metricCacheHitRatio)
+	fmt.Fprintf(out, "# TYPE %s gauge\n", metricCacheHitRatio)
+	fmt.Fprintf(out, "%s %g\n", metricCacheHitRatio, metrics.CacheHitRatio)
+
+	return out.String()
+}
+
+// writeMetrics writes the metrics to the given path, replacing it atomically
+// so that a textfile collector never reads a partial file.
+func writeMetrics(path string, metrics buildMetrics) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "create metrics file")
+	}
+
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(formatMetrics(metrics))
+	if err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "write metrics file")
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return errors.Wrap(err, "write metrics file")
+	}
+
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return errors.Wrap(err, "chmod metrics file")
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
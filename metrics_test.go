@@ -0,0 +1,106 @@
+package task
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type MetricsSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *MetricsSuite) TestCacheHitRatio() {
+	collector := &cacheCollector{}
+
+	collector.Next()
+	_, err := fmt.Fprint(collector, `#1 [internal] load build definition from Dockerfile
+#1 DONE 0.0s
+
+#2 [1/2] FROM docker.io/library/busybox
+#2 CACHED
+
+#3 [2/2] RUN echo hello
+#3 0.155 hello
+#3 DONE 0.2s
+`)
+	s.NoError(err)
+
+	// a second invocation reuses vertex numbers
+	collector.Next()
+	_, err = fmt.Fprint(collector, `#1 [1/1] RUN echo CACHED
+#1 CACHED`)
+	s.NoError(err)
+
+	s.Equal(0.5, collector.HitRatio())
+}
+
+func (s *MetricsSuite) TestCacheHitRatioNoSteps() {
+	s.Equal(0.0, (&cacheCollector{}).HitRatio())
+}
+
+func (s *MetricsSuite) TestFormatMetrics() {
+	s.Equal(`# HELP oci_build_task_build_duration_seconds Time taken to build the image.
+# TYPE oci_build_task_build_duration_seconds gauge
+oci_build_task_build_duration_seconds 90.5
+# HELP oci_build_task_image_size_bytes Size of the image tarball.
+# TYPE oci_build_task_image_size_bytes gauge
+oci_build_task_image_size_bytes{output="additional-target"} 2048
+oci_build_task_image_size_bytes{output="image"} 1024
+# HELP oci_build_task_cache_hit_ratio Ratio of build steps satisfied from the cache.
+# TYPE oci_build_task_cache_hit_ratio gauge
+oci_build_task_cache_hit_ratio 0.75
+`, formatMetrics(buildMetrics{
+		Duration:      90*time.Second + 500*time.Millisecond,
+		CacheHitRatio: 0.75,
+		ImageSizes: map[string]int64{
+			"image":             1024,
+			"additional-target": 2048,
+		},
+	}))
+}
+
+func (s *MetricsSuite) TestFormatMetricsNoImage() {
+	s.NotContains(formatMetrics(buildMetrics{}), metricImageSize)
+}
+
+func (s *MetricsSuite) TestWriteMetrics() {
+	dir, err := ioutil.TempDir("", "metrics")
+	s.NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	imagePath := filepath.Join(dir, "image", "image.tar")
+	s.NoError(os.MkdirAll(filepath.Dir(imagePath), 0755))
+	s.NoError(ioutil.WriteFile(imagePath, make([]byte, 123), 0644))
+
+	metrics := buildMetrics{
+		Duration:   time.Second,
+		ImageSizes: imageSizes([]string{imagePath, filepath.Join(dir, "missing", "image.tar")}),
+	}
+	s.Equal(map[string]int64{"image": 123}, metrics.ImageSizes)
+
+	path := filepath.Join(dir, "build.prom")
+	s.NoError(writeMetrics(path, metrics))
+
+	content, err := ioutil.ReadFile(path)
+	s.NoError(err)
+	s.Equal(formatMetrics(metrics), string(content))
+
+	files, err := ioutil.ReadDir(dir)
+	s.NoError(err)
+	s.Len(files, 2, "temp file left behind")
+}
+
+func TestMetrics(t *testing.T) {
+	suite.Run(t, &MetricsSuite{
+		Assertions: require.New(t),
+	})
+}
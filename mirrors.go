@@ -0,0 +1,101 @@
+package task
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MirrorSpec is a registry mirror for docker.io, with the credentials to
+// pull through it if it is private.
+//
+// In the environment each mirror is given as [<username>:<password>@]<host>,
+// and in the request or params file as either that or an object.
+type MirrorSpec struct {
+	Host     string `json:"host"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Unmarshal parses a mirror from the environment.
+func (spec *MirrorSpec) Unmarshal(s string) error {
+	parsed, err := parseMirrorSpec(s)
+	if err != nil {
+		return err
+	}
+
+	*spec = parsed
+
+	return nil
+}
+
+// UnmarshalJSON parses a mirror given as either a string or an object.
+func (spec *MirrorSpec) UnmarshalJSON(payload []byte) error {
+	var s string
+	if json.Unmarshal(payload, &s) == nil {
+		return spec.Unmarshal(s)
+	}
+
+	// a distinct type, so that this isn't called again
+	type mirrorSpec MirrorSpec
+
+	var parsed mirrorSpec
+	err := json.Unmarshal(payload, &parsed)
+	if err != nil {
+		return err
+	}
+
+	*spec = MirrorSpec(parsed)
+
+	return nil
+}
+
+func parseMirrorSpec(s string) (MirrorSpec, error) {
+	s = strings.TrimSpace(s)
+
+	// the password may itself contain an @, but the host can't
+	at := strings.LastIndex(s, "@")
+	if at == -1 {
+		return MirrorSpec{Host: s}, nil
+	}
+
+	creds := strings.SplitN(s[:at], ":", 2)
+	if len(creds) != 2 {
+		return MirrorSpec{}, errors.Errorf("invalid registry mirror '%s': expected <username>:<password>@<host>", s[at+1:])
+	}
+
+	return MirrorSpec{
+		Host:     s[at+1:],
+		Username: creds[0],
+		Password: creds[1],
+	}, nil
+}
+
+// mirrorHosts returns the hosts of the mirrors, for the buildkitd config.
+func mirrorHosts(mirrors []MirrorSpec) []string {
+	hosts := make([]string, len(mirrors))
+	for i, mirror := range mirrors {
+		hosts[i] = mirror.Host
+	}
+
+	return hosts
+}
+
+// mirrorCreds returns the credentials for each mirror which has them, keyed
+// by host.
+func mirrorCreds(mirrors []MirrorSpec) map[string]RegistryCreds {
+	creds := map[string]RegistryCreds{}
+	for _, mirror := range mirrors {
+		if mirror.Username == "" && mirror.Password == "" {
+			continue
+		}
+
+		creds[mirror.Host] = RegistryCreds{
+			Username: mirror.Username,
+			Password: mirror.Password,
+		}
+	}
+
+	return creds
+}
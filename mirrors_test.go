@@ -0,0 +1,137 @@
+package task
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/vrischmann/envconfig"
+)
+
+type MirrorsSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *MirrorsSuite) TestEnv() {
+	s.T().Setenv("REGISTRY_MIRRORS", "mirror.gcr.io,some-user:p@ss:word@cache.internal:5000")
+
+	var cfg Config
+	s.NoError(envconfig.Init(&cfg))
+
+	s.Equal([]MirrorSpec{
+		{Host: "mirror.gcr.io"},
+		{Host: "cache.internal:5000", Username: "some-user", Password: "p@ss:word"},
+	}, cfg.RegistryMirrors)
+}
+
+func (s *MirrorsSuite) TestInvalid() {
+	var spec MirrorSpec
+	s.Error(spec.Unmarshal("some-token@cache.internal"))
+}
+
+func (s *MirrorsSuite) TestJSON() {
+	var cfg Config
+	s.NoError(json.Unmarshal([]byte(`{"registry_mirrors": [
+		"mirror.gcr.io",
+		{"host": "cache.internal", "username": "some-user", "password": "some-token"}
+	]}`), &cfg))
+
+	s.Equal([]MirrorSpec{
+		{Host: "mirror.gcr.io"},
+		{Host: "cache.internal", Username: "some-user", Password: "some-token"},
+	}, cfg.RegistryMirrors)
+
+	// as passed from build to task
+	payload, err := json.Marshal(cfg)
+	s.NoError(err)
+
+	var roundTripped Config
+	s.NoError(json.Unmarshal(payload, &roundTripped))
+	s.Equal(cfg.RegistryMirrors, roundTripped.RegistryMirrors)
+}
+
+func (s *MirrorsSuite) TestMirrorsWithAuth() {
+	dir := s.T().TempDir()
+
+	credsFile := filepath.Join(dir, "creds.json")
+	s.NoError(ioutil.WriteFile(credsFile, []byte(`{
+		"registry.example.com": {"username": "file-user", "password": "file-token"},
+		"other-cache.internal": {"username": "file-user", "password": "fresh-token"}
+	}`), 0644))
+
+	cfg := Config{
+		CredsRefreshFile: credsFile,
+		RegistryMirrors: []MirrorSpec{
+			{Host: "mirror.gcr.io"},
+			{Host: "cache.internal", Username: "some-user", Password: "some-token"},
+			{Host: "other-cache.internal", Username: "some-user", Password: "stale-token"},
+		},
+	}
+
+	s.Equal(BuildkitdConfig{
+		Registries: map[string]RegistryConfig{
+			"docker.io": {Mirrors: []string{"mirror.gcr.io", "cache.internal", "other-cache.internal"}},
+		},
+	}, newBuildkitdConfig(cfg))
+
+	configDir := filepath.Join(dir, "docker-config")
+	env, err := refreshCreds(cfg, configDir)
+	s.NoError(err)
+	s.Equal([]string{"DOCKER_CONFIG=" + configDir}, env)
+
+	payload, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	s.NoError(err)
+
+	var config dockerConfig
+	s.NoError(json.Unmarshal(payload, &config))
+
+	auths := map[string]string{}
+	for registry, auth := range config.Auths {
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		s.NoError(err)
+		auths[registry] = string(decoded)
+	}
+
+	s.Equal(map[string]string{
+		"cache.internal":       "some-user:some-token",
+		"other-cache.internal": "file-user:fresh-token",
+		"registry.example.com": "file-user:file-token",
+	}, auths)
+}
+
+func (s *MirrorsSuite) TestMirrorAuthWithoutCredsFile() {
+	configDir := filepath.Join(s.T().TempDir(), "docker-config")
+
+	env, err := refreshCreds(Config{RegistryMirrors: []MirrorSpec{{Host: "mirror.gcr.io"}}}, configDir)
+	s.NoError(err)
+	s.Nil(env)
+	s.NoFileExists(filepath.Join(configDir, "config.json"))
+
+	env, err = refreshCreds(Config{RegistryMirrors: []MirrorSpec{{Host: "cache.internal", Username: "some-user", Password: "some-token"}}}, configDir)
+	s.NoError(err)
+	s.NotNil(env)
+	s.FileExists(filepath.Join(configDir, "config.json"))
+}
+
+func (s *MirrorsSuite) TestRedacted() {
+	cfg := redactConfig(Config{RegistryMirrors: []MirrorSpec{
+		{Host: "mirror.gcr.io"},
+		{Host: "cache.internal", Username: "some-user", Password: "some-token"},
+	}})
+
+	s.Equal([]MirrorSpec{
+		{Host: "mirror.gcr.io"},
+		{Host: "cache.internal", Username: "some-user", Password: redacted},
+	}, cfg.RegistryMirrors)
+}
+
+func TestMirrors(t *testing.T) {
+	suite.Run(t, &MirrorsSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,249 @@
+package task
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+)
+
+// responseOutputs computes the list of outputs reported in the Response,
+// based on what the build actually produced.
+//
+// Each image path contributes the name of its output directory (e.g. "image"
+// or an additional target's name), as does each additional output, the trace
+// file, and the attestations dir, with a relative destination. "rootfs" and
+// "oci-layout" are listed when the corresponding artifacts were written
+// alongside an image, "files" when files were extracted from it, and "cache"
+// only when the cache was exported.
+func responseOutputs(cfg Config, imagePaths []string, cacheExported bool) []string {
+	outputs := []string{}
+
+	for _, imagePath := range imagePaths {
+		// there may be several images in one output when splitting by platform
+		output := filepath.Base(filepath.Dir(imagePath))
+		if !contains(outputs, output) {
+			outputs = append(outputs, output)
+		}
+	}
+
+	if len(imagePaths) > 0 {
+		if cfg.OutputType == "oci" {
+			outputs = append(outputs, "oci-layout")
+		} else if cfg.UnpackRootfs {
+			outputs = append(outputs, "rootfs")
+		}
+	}
+
+	dests := []string{}
+	for _, spec := range cfg.Outputs {
+		dests = append(dests, spec.Dest)
+	}
+
+	if cfg.TraceFile != "" {
+		dests = append(dests, cfg.TraceFile)
+	}
+
+	if cfg.AttestationsDir != "" && len(imagePaths) > 0 {
+		dests = append(dests, cfg.AttestationsDir)
+	}
+
+	for _, dest := range dests {
+		if filepath.IsAbs(dest) {
+			continue
+		}
+
+		output := strings.Split(filepath.ToSlash(filepath.Clean(dest)), "/")[0]
+		if !contains(outputs, output) {
+			outputs = append(outputs, output)
+		}
+	}
+
+	if len(cfg.ExtractFiles) > 0 {
+		outputs = append(outputs, "files")
+	}
+
+	if cacheExported {
+		outputs = append(outputs, "cache")
+	}
+
+	return outputs
+}
+
+// outputArg returns the buildctl --output spec for exporting the image to the
+// given path, or to the image store for the 'image' output type.
+func outputArg(cfg Config, imagePath string) string {
+	if cfg.OutputType == "image" {
+		names := imageNames(cfg)
+		if len(names) > 1 {
+			// buildctl parses the spec as CSV, so several names must be quoted
+			return `type=image,"name=` + strings.Join(names, ",") + `",store=true`
+		}
+
+		return "type=image,name=" + cfg.ImageName + ",store=true"
+	}
+
+	if cfg.DeterministicExport {
+		// clamp the timestamps within the layers to SOURCE_DATE_EPOCH too
+		return "type=" + cfg.OutputType + ",dest=" + imagePath + ",rewrite-timestamp=true"
+	}
+
+	return "type=" + cfg.OutputType + ",dest=" + imagePath
+}
+
+// streamOutputArgs returns the buildctl args for exporting the image to the
+// StreamOutput, e.g. a named pipe read by another process, instead of the
+// image output.
+func streamOutputArgs(cfg Config) []string {
+	return []string{"--output", outputArg(cfg, cfg.StreamOutput)}
+}
+
+// normalizeImageName lowercases the repository of the image name, leaving the
+// tag or digest alone, and validates the result, so that typos fail before
+// building rather than deep in buildkit.
+func normalizeImageName(imageName string) (string, error) {
+	repository, suffix := imageName, ""
+	if i := strings.IndexByte(imageName, '@'); i != -1 {
+		repository, suffix = imageName[:i], imageName[i:]
+	} else if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		// only a tag if it's after the last path component, i.e. not a port
+		repository, suffix = imageName[:i], imageName[i:]
+	}
+
+	normalized := strings.ToLower(repository) + suffix
+
+	_, err := name.ParseReference(normalized)
+	if err == nil && suffix == ":" {
+		err = errors.New("empty tag")
+	}
+
+	if err == nil && (strings.Contains(repository, "//") || strings.HasSuffix(repository, "/")) {
+		// allowed by the parser, but not by buildkit
+		err = errors.New("empty path component")
+	}
+
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid image name '%s'", imageName)
+	}
+
+	return normalized, nil
+}
+
+// imageNames returns the names to store the image under for the 'image'
+// output type: the ImageName, and the same repository's 'latest' tag with
+// LatestTag, unless that is the ImageName already.
+func imageNames(cfg Config) []string {
+	names := []string{cfg.ImageName}
+	if !cfg.LatestTag {
+		return names
+	}
+
+	tag, err := name.NewTag(cfg.ImageName)
+	if err != nil {
+		// already validated by sanitize
+		return names
+	}
+
+	if tag.TagStr() == "latest" {
+		return names
+	}
+
+	repository := strings.TrimSuffix(cfg.ImageName, ":"+tag.TagStr())
+	return append(names, repository+":latest")
+}
+
+// reservedOutputs are the outputs the task writes itself, which additional
+// outputs may not replace.
+var reservedOutputs = []string{"image", "cache", "rootfs", "files"}
+
+// outputSpecArgs returns the buildctl --output args for the given additional
+// outputs, with relative destinations resolved against the outputs dir. It
+// fails if any two outputs, including the already taken destinations, would
+// write to the same place, if a relative destination is not within the
+// outputs dir, or if one would replace the task's own outputs.
+func outputSpecArgs(specs []OutputSpec, outputsDir string, taken ...string) ([]string, error) {
+	seen := map[string]bool{}
+	for _, dest := range taken {
+		seen[filepath.Clean(dest)] = true
+	}
+
+	var args []string
+	for _, spec := range specs {
+		switch spec.Type {
+		case "docker", "oci", "tar", "local":
+		default:
+			return nil, errors.Errorf("unknown type '%s' for output '%s'", spec.Type, spec.Dest)
+		}
+
+		if spec.Dest == "" {
+			return nil, errors.Errorf("no destination for '%s' output", spec.Type)
+		}
+
+		dest := spec.Dest
+		if !filepath.IsAbs(dest) {
+			rel := filepath.Clean(dest)
+			if !isWithin(rel, ".") || rel == "." {
+				return nil, errors.Errorf("output '%s' is not within the outputs", spec.Dest)
+			}
+
+			if contains(reservedOutputs, rel) {
+				return nil, errors.Errorf("output '%s' would replace the task's own '%s' output", spec.Dest, rel)
+			}
+
+			dest = filepath.Join(outputsDir, dest)
+		}
+
+		dest = filepath.Clean(dest)
+		if seen[dest] {
+			return nil, errors.Errorf("multiple outputs write to '%s'", spec.Dest)
+		}
+
+		for _, path := range taken {
+			if path != dest && isWithin(path, dest) {
+				return nil, errors.Errorf("output '%s' would replace '%s'", spec.Dest, path)
+			}
+		}
+
+		seen[dest] = true
+
+		args = append(args, "--output", "type="+spec.Type+",dest="+dest)
+	}
+
+	return args, nil
+}
+
+// isWithin returns whether path is dir or beneath it, lexically.
+func isWithin(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// traceArgs returns the buildctl args for writing a trace to the TraceFile, if
+// set, resolved against the outputs dir.
+func traceArgs(cfg Config, outputsDir string) []string {
+	if cfg.TraceFile == "" {
+		return nil
+	}
+
+	traceFile := cfg.TraceFile
+	if !filepath.IsAbs(traceFile) {
+		traceFile = filepath.Join(outputsDir, traceFile)
+	}
+
+	return []string{"--trace", traceFile}
+}
+
+func contains(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+
+	return false
+}
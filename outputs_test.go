@@ -0,0 +1,314 @@
+package task
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type OutputsSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *OutputsSuite) TestImageAndCache() {
+	outputs := responseOutputs(Config{}, []string{"/outputs/image/image.tar"}, true)
+	s.Equal([]string{"image", "cache"}, outputs)
+}
+
+func (s *OutputsSuite) TestNoImageOutput() {
+	outputs := responseOutputs(Config{UnpackRootfs: true}, nil, true)
+	s.Equal([]string{"cache"}, outputs)
+}
+
+func (s *OutputsSuite) TestNoCacheOutput() {
+	outputs := responseOutputs(Config{}, []string{"/outputs/image/image.tar"}, false)
+	s.Equal([]string{"image"}, outputs)
+}
+
+func (s *OutputsSuite) TestNothingProduced() {
+	outputs := responseOutputs(Config{}, nil, false)
+	s.Empty(outputs)
+}
+
+func (s *OutputsSuite) TestAdditionalTargets() {
+	outputs := responseOutputs(Config{}, []string{
+		"/outputs/additional-target/image.tar",
+		"/outputs/image/image.tar",
+	}, false)
+	s.Equal([]string{"additional-target", "image"}, outputs)
+}
+
+func (s *OutputsSuite) TestUnpackRootfs() {
+	outputs := responseOutputs(Config{UnpackRootfs: true}, []string{"/outputs/image/image.tar"}, true)
+	s.Equal([]string{"image", "rootfs", "cache"}, outputs)
+}
+
+func (s *OutputsSuite) TestOCILayout() {
+	outputs := responseOutputs(Config{OutputType: "oci"}, []string{"/outputs/image/image.tar"}, true)
+	s.Equal([]string{"image", "oci-layout", "cache"}, outputs)
+}
+
+func (s *OutputsSuite) TestOCILayoutIgnoresUnpack() {
+	// rootfs is never unpacked for OCI images
+	outputs := responseOutputs(Config{OutputType: "oci", UnpackRootfs: true}, []string{"/outputs/image/image.tar"}, false)
+	s.Equal([]string{"image", "oci-layout"}, outputs)
+}
+
+func (s *OutputsSuite) TestExtractFiles() {
+	outputs := responseOutputs(Config{ExtractFiles: []string{"/usr/bin/app"}}, []string{"/outputs/image/image.tar"}, true)
+	s.Equal([]string{"image", "files", "cache"}, outputs)
+}
+
+func (s *OutputsSuite) TestTraceFile() {
+	outputs := responseOutputs(Config{TraceFile: "trace/trace.json"}, []string{"/outputs/image/image.tar"}, true)
+	s.Equal([]string{"image", "trace", "cache"}, outputs)
+
+	outputs = responseOutputs(Config{TraceFile: "/tmp/trace.json"}, []string{"/outputs/image/image.tar"}, true)
+	s.Equal([]string{"image", "cache"}, outputs)
+}
+
+func (s *OutputsSuite) TestTraceArgs() {
+	s.Equal([]string{"--trace", "/outputs/trace/trace.json"}, traceArgs(Config{TraceFile: "trace/trace.json"}, "/outputs"))
+	s.Equal([]string{"--trace", "/tmp/trace.json"}, traceArgs(Config{TraceFile: "/tmp/trace.json"}, "/outputs"))
+	s.Empty(traceArgs(Config{}, "/outputs"))
+}
+
+func (s *OutputsSuite) TestOutputArg() {
+	s.Equal(
+		"type=docker,dest=/outputs/image/image.tar",
+		outputArg(Config{OutputType: "docker"}, "/outputs/image/image.tar"),
+	)
+
+	s.Equal(
+		"type=oci,dest=/outputs/image/image.tar",
+		outputArg(Config{OutputType: "oci"}, "/outputs/image/image.tar"),
+	)
+
+	s.Equal(
+		"type=docker,dest=/outputs/image/image.tar,rewrite-timestamp=true",
+		outputArg(Config{OutputType: "docker", DeterministicExport: true}, "/outputs/image/image.tar"),
+	)
+}
+
+func (s *OutputsSuite) TestOutputArgImageStore() {
+	s.Equal(
+		"type=image,name=docker.io/some/image:latest,store=true",
+		outputArg(Config{OutputType: "image", ImageName: "docker.io/some/image:latest"}, ""),
+	)
+}
+
+func (s *OutputsSuite) TestOutputArgLatestTag() {
+	s.Equal(
+		`type=image,"name=docker.io/some/image:1.2.3,docker.io/some/image:latest",store=true`,
+		outputArg(Config{OutputType: "image", ImageName: "docker.io/some/image:1.2.3", LatestTag: true}, ""),
+	)
+
+	s.Equal(
+		`type=image,"name=localhost:5000/some/image:1.2.3,localhost:5000/some/image:latest",store=true`,
+		outputArg(Config{OutputType: "image", ImageName: "localhost:5000/some/image:1.2.3", LatestTag: true}, ""),
+	)
+
+	// not duplicated when already latest, or implicitly so
+	s.Equal([]string{"docker.io/some/image:latest"}, imageNames(Config{ImageName: "docker.io/some/image:latest", LatestTag: true}))
+	s.Equal([]string{"some/image"}, imageNames(Config{ImageName: "some/image", LatestTag: true}))
+
+	s.Equal([]string{"some/image:1.2.3"}, imageNames(Config{ImageName: "some/image:1.2.3"}))
+}
+
+func (s *OutputsSuite) TestLatestTagSanitize() {
+	cfg := Config{OutputType: "image", ImageName: "some/image:1.2.3", LatestTag: true}
+	s.NoError(sanitize(&cfg))
+
+	cfg = Config{OutputType: "image", ImageName: "some/image@sha256:" + strings.Repeat("a", 64), LatestTag: true}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{LatestTag: true}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "output type 'docker'")
+}
+
+func (s *OutputsSuite) TestStreamOutputArgs() {
+	s.Equal(
+		[]string{"--output", "type=docker,dest=/tmp/image.pipe"},
+		streamOutputArgs(Config{OutputType: "docker", StreamOutput: "/tmp/image.pipe"}),
+	)
+
+	s.Equal(
+		[]string{"--output", "type=oci,dest=/dev/fd/3"},
+		streamOutputArgs(Config{OutputType: "oci", StreamOutput: "/dev/fd/3"}),
+	)
+}
+
+func (s *OutputsSuite) TestStreamOutputSanitize() {
+	cfg := Config{StreamOutput: "/tmp/image.pipe"}
+	s.NoError(sanitize(&cfg))
+
+	cfg = Config{StreamOutput: "-"}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "stdout")
+
+	cfg = Config{StreamOutput: "/tmp/image.pipe", OutputType: "image", ImageName: "some/image"}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{StreamOutput: "/tmp/image.pipe", UnpackRootfs: true}
+	s.Error(sanitize(&cfg))
+}
+
+func (s *OutputsSuite) TestNormalizeImageName() {
+	for given, expected := range map[string]string{
+		"some/image":                                   "some/image",
+		"Some/Image:Latest":                            "some/image:Latest",
+		"docker.io/My-User/my_repo:1.2.3":              "docker.io/my-user/my_repo:1.2.3",
+		"Localhost:5000/Some/Image":                    "localhost:5000/some/image",
+		"localhost:5000/some/image:v1":                 "localhost:5000/some/image:v1",
+		"Some/Image@sha256:" + strings.Repeat("a", 64): "some/image@sha256:" + strings.Repeat("a", 64),
+	} {
+		normalized, err := normalizeImageName(given)
+		s.NoError(err, given)
+		s.Equal(expected, normalized, given)
+	}
+
+	for _, invalid := range []string{
+		"some/image:",
+		"some/image:bad tag",
+		"some image",
+		"some/image!",
+		"some//image",
+		"some/image@sha256:nope",
+		"some/image:" + strings.Repeat("a", 129),
+	} {
+		_, err := normalizeImageName(invalid)
+		s.Error(err, invalid)
+	}
+}
+
+func (s *OutputsSuite) TestImageNameSanitize() {
+	cfg := Config{OutputType: "image", ImageName: "Docker.io/Some/Image:Latest"}
+	s.NoError(sanitize(&cfg))
+	s.Equal("docker.io/some/image:Latest", cfg.ImageName)
+
+	cfg = Config{OutputType: "image", ImageName: "some/image:bad tag"}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "invalid image name")
+}
+
+func (s *OutputsSuite) TestAdditionalOutputs() {
+	outputs := responseOutputs(Config{
+		Outputs: []OutputSpec{
+			{Type: "oci", Dest: "oci/image.tar"},
+			{Type: "tar", Dest: "oci/rootfs.tar"},
+			{Type: "local", Dest: "/somewhere/else"},
+		},
+	}, []string{"/outputs/image/image.tar"}, false)
+	s.Equal([]string{"image", "oci"}, outputs)
+}
+
+func (s *OutputsSuite) TestOutputSpecArgs() {
+	args, err := outputSpecArgs([]OutputSpec{
+		{Type: "oci", Dest: "oci/image.tar"},
+		{Type: "local", Dest: "/somewhere/else"},
+	}, "/outputs", "/outputs/image/image.tar")
+	s.NoError(err)
+	s.Equal([]string{
+		"--output", "type=oci,dest=/outputs/oci/image.tar",
+		"--output", "type=local,dest=/somewhere/else",
+	}, args)
+}
+
+func (s *OutputsSuite) TestOutputSpecArgsNone() {
+	args, err := outputSpecArgs(nil, "/outputs", "/outputs/image/image.tar")
+	s.NoError(err)
+	s.Empty(args)
+}
+
+func (s *OutputsSuite) TestOutputSpecArgsCollision() {
+	_, err := outputSpecArgs([]OutputSpec{
+		{Type: "oci", Dest: "oci/image.tar"},
+		{Type: "docker", Dest: "./oci/../oci/image.tar"},
+	}, "/outputs")
+	s.Error(err)
+	s.Contains(err.Error(), "multiple outputs")
+
+	_, err = outputSpecArgs([]OutputSpec{
+		{Type: "oci", Dest: "image/image.tar"},
+	}, "/outputs", "/outputs/image/image.tar")
+	s.Error(err)
+	s.Contains(err.Error(), "multiple outputs")
+}
+
+func (s *OutputsSuite) TestOutputSpecArgsOutsideOutputs() {
+	for _, dest := range []string{".", "..", "../elsewhere", "oci/../../elsewhere"} {
+		_, err := outputSpecArgs([]OutputSpec{{Type: "local", Dest: dest}}, "/outputs")
+		s.Error(err, dest)
+		s.Contains(err.Error(), "not within the outputs", dest)
+	}
+}
+
+func (s *OutputsSuite) TestOutputSpecArgsReserved() {
+	for _, dest := range []string{"image", "cache", "rootfs", "files", "./cache/"} {
+		_, err := outputSpecArgs([]OutputSpec{{Type: "local", Dest: dest}}, "/outputs")
+		s.Error(err, dest)
+		s.Contains(err.Error(), "task's own", dest)
+	}
+
+	// nor any parent of the images, e.g. an additional target's output
+	_, err := outputSpecArgs([]OutputSpec{{Type: "local", Dest: "additional-target"}}, "/outputs", "/outputs/image/image.tar", "/outputs/additional-target/image.tar")
+	s.Error(err)
+	s.Contains(err.Error(), "would replace '/outputs/additional-target/image.tar'")
+
+	_, err = outputSpecArgs([]OutputSpec{{Type: "local", Dest: "/outputs"}}, "/outputs", "/outputs/image/image.tar")
+	s.Error(err)
+
+	// but alongside them is fine
+	_, err = outputSpecArgs([]OutputSpec{{Type: "oci", Dest: "image/oci.tar"}}, "/outputs", "/outputs/image/image.tar")
+	s.NoError(err)
+}
+
+func (s *OutputsSuite) TestOutputSpecArgsInvalid() {
+	_, err := outputSpecArgs([]OutputSpec{{Type: "bogus", Dest: "oci/image.tar"}}, "/outputs")
+	s.Error(err)
+
+	_, err = outputSpecArgs([]OutputSpec{{Type: "oci"}}, "/outputs")
+	s.Error(err)
+}
+
+func (s *OutputsSuite) TestOutputTypeFile() {
+	dir := s.T().TempDir()
+
+	outputTypeFile := filepath.Join(dir, "output-type")
+	s.NoError(ioutil.WriteFile(outputTypeFile, []byte("oci\n"), 0644))
+
+	cfg := Config{OutputTypeFile: outputTypeFile}
+	s.NoError(sanitize(&cfg))
+	s.Equal("oci", cfg.OutputType)
+
+	s.NoError(ioutil.WriteFile(outputTypeFile, []byte("bogus\n"), 0644))
+
+	cfg = Config{OutputTypeFile: outputTypeFile}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "unknown output type 'bogus'")
+
+	cfg = Config{OutputTypeFile: filepath.Join(dir, "missing")}
+	s.Error(sanitize(&cfg))
+}
+
+func (s *OutputsSuite) TestDefaultOutputType() {
+	cfg := Config{}
+	s.NoError(sanitize(&cfg))
+	s.Equal("docker", cfg.OutputType)
+}
+
+func TestOutputs(t *testing.T) {
+	suite.Run(t, &OutputsSuite{
+		Assertions: require.New(t),
+	})
+}
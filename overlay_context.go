@@ -0,0 +1,109 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// overlayContext mounts an overlay of the context dir, returning the path to
+// build from instead, and a func which unmounts it. Writes to the overlay,
+// e.g. injected files, go to an upper dir on a tmpfs, leaving the context
+// itself untouched.
+func overlayContext(contextDir string) (string, func() error, error) {
+	lower, err := filepath.Abs(contextDir)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "resolve context dir")
+	}
+
+	// these separate overlay's mount options and lower dirs
+	if strings.ContainsAny(lower, ",:") {
+		return "", nil, errors.Errorf("context dir '%s' contains ',' or ':'", lower)
+	}
+
+	dir, err := ioutil.TempDir("", "context-overlay-")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "create overlay dir")
+	}
+
+	var mounted []string
+	cleanup := func() error {
+		var firstErr error
+		for i := len(mounted) - 1; i >= 0; i-- {
+			err := syscall.Unmount(mounted[i], 0)
+			if err != nil && firstErr == nil {
+				firstErr = errors.Wrapf(err, "unmount %s", mounted[i])
+			}
+		}
+
+		if firstErr != nil {
+			// don't remove anything still mounted; the lower dir is the context
+			return firstErr
+		}
+
+		return os.RemoveAll(dir)
+	}
+
+	// the upper dir can't be on an overlay itself, as the task's own
+	// filesystem may well be
+	err = syscall.Mount("tmpfs", dir, "tmpfs", 0, "mode=0755")
+	if err != nil {
+		cleanup()
+		return "", nil, errors.Wrap(err, "mount tmpfs")
+	}
+
+	mounted = append(mounted, dir)
+
+	upper := filepath.Join(dir, "upper")
+	work := filepath.Join(dir, "work")
+	merged := filepath.Join(dir, "merged")
+	for _, d := range []string{upper, work, merged} {
+		err := os.Mkdir(d, 0755)
+		if err != nil {
+			cleanup()
+			return "", nil, errors.Wrap(err, "create overlay dir")
+		}
+	}
+
+	logrus.Debugf("mounting read-only overlay of context %s at %s", lower, merged)
+
+	err = syscall.Mount("overlay", merged, "overlay", 0, "lowerdir="+lower+",upperdir="+upper+",workdir="+work)
+	if err != nil {
+		cleanup()
+		return "", nil, errors.Wrap(err, "mount overlay")
+	}
+
+	mounted = append(mounted, merged)
+
+	return merged, cleanup, nil
+}
+
+// overlayPath returns the path within the overlay mounted at merged for the
+// path within the context dir, or the path itself if it's outside of it.
+func overlayPath(contextDir string, merged string, path string) (string, error) {
+	absContext, err := filepath.Abs(contextDir)
+	if err != nil {
+		return "", errors.Wrap(err, "resolve context dir")
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.Wrap(err, "resolve path")
+	}
+
+	if !within(absContext, absPath) {
+		return path, nil
+	}
+
+	rel, err := filepath.Rel(absContext, absPath)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(merged, rel), nil
+}
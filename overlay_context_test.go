@@ -0,0 +1,97 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type OverlayContextSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	context string
+}
+
+func (s *OverlayContextSuite) SetupTest() {
+	s.context = s.T().TempDir()
+
+	s.NoError(ioutil.WriteFile(filepath.Join(s.context, "Dockerfile"), []byte("FROM busybox\n"), 0644))
+	s.NoError(os.Mkdir(filepath.Join(s.context, "config"), 0755))
+	s.NoError(ioutil.WriteFile(filepath.Join(s.context, "config", "app.yml"), []byte("original\n"), 0644))
+}
+
+func (s *OverlayContextSuite) overlay() (string, func() error) {
+	merged, unmount, err := overlayContext(s.context)
+	if err != nil {
+		// mounting requires privileges which tests may not have
+		s.T().Skip("cannot mount overlay:", err)
+	}
+
+	return merged, unmount
+}
+
+func (s *OverlayContextSuite) TestUnmodified() {
+	merged, unmount := s.overlay()
+
+	contents, err := ioutil.ReadFile(filepath.Join(merged, "config", "app.yml"))
+	s.NoError(err)
+	s.Equal("original\n", string(contents))
+
+	src := filepath.Join(s.T().TempDir(), "app.yml")
+	s.NoError(ioutil.WriteFile(src, []byte("injected\n"), 0644))
+
+	_, err = injectFiles(merged, map[string]string{
+		"config/app.yml":   src,
+		"new/dir/file.yml": src,
+	})
+	s.NoError(err)
+
+	s.NoError(ioutil.WriteFile(filepath.Join(merged, "Dockerfile"), []byte("FROM alpine\n"), 0644))
+	s.NoError(os.Remove(filepath.Join(merged, "config", "app.yml")))
+
+	s.NoError(unmount())
+
+	contents, err = ioutil.ReadFile(filepath.Join(s.context, "config", "app.yml"))
+	s.NoError(err)
+	s.Equal("original\n", string(contents))
+
+	contents, err = ioutil.ReadFile(filepath.Join(s.context, "Dockerfile"))
+	s.NoError(err)
+	s.Equal("FROM busybox\n", string(contents))
+
+	_, err = os.Stat(filepath.Join(s.context, "new"))
+	s.True(os.IsNotExist(err))
+
+	_, err = os.Stat(merged)
+	s.True(os.IsNotExist(err))
+}
+
+func (s *OverlayContextSuite) TestInvalidContextDir() {
+	_, _, err := overlayContext(filepath.Join(s.T().TempDir(), "some,dir"))
+	s.Error(err)
+}
+
+func (s *OverlayContextSuite) TestPath() {
+	path, err := overlayPath("/context", "/tmp/merged", "/context/sub/Dockerfile")
+	s.NoError(err)
+	s.Equal("/tmp/merged/sub/Dockerfile", path)
+
+	path, err = overlayPath("/context", "/tmp/merged", "/elsewhere/Dockerfile")
+	s.NoError(err)
+	s.Equal("/elsewhere/Dockerfile", path)
+
+	path, err = overlayPath("/context", "/tmp/merged", "/context-other/Dockerfile")
+	s.NoError(err)
+	s.Equal("/context-other/Dockerfile", path)
+}
+
+func TestOverlayContext(t *testing.T) {
+	suite.Run(t, &OverlayContextSuite{
+		Assertions: require.New(t),
+	})
+}
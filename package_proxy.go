@@ -0,0 +1,73 @@
+package task
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// packageCacheID is the id passed as the PACKAGE_CACHE_ID build arg, for
+// Dockerfiles to use for their package managers' cache mounts.
+const packageCacheID = "packages"
+
+// packageProxyBuildArgs returns the build args for using the package proxy:
+// the proxy itself and the cache mount id, for Dockerfiles to use explicitly,
+// as well as the proxy vars, which RUN instructions get in their env without
+// declaring them and which are left out of the image's history.
+func packageProxyBuildArgs(proxy string) []string {
+	return []string{
+		"PACKAGE_PROXY=" + proxy,
+		"PACKAGE_CACHE_ID=" + packageCacheID,
+		"HTTP_PROXY=" + proxy,
+		"http_proxy=" + proxy,
+		"HTTPS_PROXY=" + proxy,
+		"https_proxy=" + proxy,
+	}
+}
+
+// validatePackageProxy checks that the package proxy is an http(s) URL. It
+// returns whether it includes a password, in which case the build args
+// carrying it must be kept out of the logs.
+func validatePackageProxy(proxy string) (bool, error) {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return false, err
+	}
+
+	if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" {
+		return false, errors.Errorf("must be http or https, not '%s'", proxyURL.Scheme)
+	}
+
+	if proxyURL.Host == "" {
+		return false, errors.New("missing host")
+	}
+
+	_, hasPassword := proxyURL.User.Password()
+
+	return hasPassword, nil
+}
+
+// addPackageProxy adds the package proxy's build args to the config, unless
+// given explicitly, marking them as secret if the proxy includes a password.
+func addPackageProxy(cfg *Config) error {
+	hasPassword, err := validatePackageProxy(cfg.PackageProxy)
+	if err != nil {
+		return errors.Wrap(err, "package proxy")
+	}
+
+	for _, arg := range packageProxyBuildArgs(cfg.PackageProxy) {
+		key := strings.SplitN(arg, "=", 2)[0]
+		if hasBuildArg(cfg.BuildArgs, key) {
+			continue
+		}
+
+		cfg.BuildArgs = append(cfg.BuildArgs, arg)
+
+		if hasPassword && key != "PACKAGE_CACHE_ID" && !contains(cfg.SecretBuildArgs, key) {
+			cfg.SecretBuildArgs = append(cfg.SecretBuildArgs, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package task
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadParamsFile merges the config from the YAML file at cfg.ParamsFile, if
+// set, underneath cfg. Any field set in cfg takes precedence over the file.
+//
+// The file uses the same keys as the JSON request, e.g.:
+//
+//	context: my-repo
+//	build_args: [foo=bar]
+func LoadParamsFile(cfg *Config) error {
+	if cfg.ParamsFile == "" {
+		return nil
+	}
+
+	payload, err := ioutil.ReadFile(cfg.ParamsFile)
+	if err != nil {
+		return errors.Wrap(err, "read params file")
+	}
+
+	var params map[string]interface{}
+	err = yaml.Unmarshal(payload, &params)
+	if err != nil {
+		return errors.Wrap(err, "parse params file")
+	}
+
+	// round-trip through JSON so that the file uses the request's keys
+	jsonPayload, err := json.Marshal(params)
+	if err != nil {
+		return errors.Wrap(err, "convert params file")
+	}
+
+	var fileCfg Config
+	err = json.Unmarshal(jsonPayload, &fileCfg)
+	if err != nil {
+		return errors.Wrap(err, "decode params file")
+	}
+
+	*cfg = mergeConfig(fileCfg, *cfg)
+
+	return nil
+}
+
+// mergeConfig returns base with every non-zero field of override applied on
+// top. Empty slices and maps count as zero.
+func mergeConfig(base, override Config) Config {
+	merged := reflect.ValueOf(&base).Elem()
+	overrides := reflect.ValueOf(override)
+
+	for i := 0; i < overrides.NumField(); i++ {
+		field := overrides.Field(i)
+
+		switch field.Kind() {
+		case reflect.Slice, reflect.Map:
+			if field.Len() == 0 {
+				continue
+			}
+		default:
+			if field.IsZero() {
+				continue
+			}
+		}
+
+		merged.Field(i).Set(field)
+	}
+
+	return base
+}
@@ -0,0 +1,104 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ParamsSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	dir string
+}
+
+func (s *ParamsSuite) SetupTest() {
+	var err error
+	s.dir, err = ioutil.TempDir("", "oci-build-task-params")
+	s.NoError(err)
+}
+
+func (s *ParamsSuite) TearDownTest() {
+	err := os.RemoveAll(s.dir)
+	s.NoError(err)
+}
+
+func (s *ParamsSuite) TestNoParamsFile() {
+	cfg := Config{ContextDir: "some-context"}
+
+	err := LoadParamsFile(&cfg)
+	s.NoError(err)
+	s.Equal(Config{ContextDir: "some-context"}, cfg)
+}
+
+func (s *ParamsSuite) TestDecodeAndMerge() {
+	paramsFile := s.writeParams(`
+context: file-context
+dockerfile: file-context/Dockerfile
+build_args:
+- from_file=true
+labels:
+- from_file=true
+unpack_rootfs: true
+buildkit_secrets:
+  token: file-secret
+`)
+
+	cfg := Config{
+		ParamsFile: paramsFile,
+		ContextDir: "request-context",
+		Labels:     []string{"from_request=true"},
+
+		// empty, as initialized by the build command
+		BuildkitSecrets: map[string]string{},
+	}
+
+	err := LoadParamsFile(&cfg)
+	s.NoError(err)
+
+	// set in the request, so the request wins
+	s.Equal("request-context", cfg.ContextDir)
+	s.Equal([]string{"from_request=true"}, cfg.Labels)
+
+	// only set in the file
+	s.Equal("file-context/Dockerfile", cfg.DockerfilePath)
+	s.Equal([]string{"from_file=true"}, cfg.BuildArgs)
+	s.True(cfg.UnpackRootfs)
+	s.Equal(map[string]string{"token": "file-secret"}, cfg.BuildkitSecrets)
+
+	s.Equal(paramsFile, cfg.ParamsFile)
+}
+
+func (s *ParamsSuite) TestInvalidParamsFile() {
+	cfg := Config{ParamsFile: s.writeParams("context: [")}
+	err := LoadParamsFile(&cfg)
+	s.Error(err)
+
+	cfg = Config{ParamsFile: s.writeParams("context: [not, a, string]")}
+	err = LoadParamsFile(&cfg)
+	s.Error(err)
+
+	cfg = Config{ParamsFile: filepath.Join(s.dir, "bogus.yml")}
+	err = LoadParamsFile(&cfg)
+	s.Error(err)
+}
+
+func (s *ParamsSuite) writeParams(content string) string {
+	path := filepath.Join(s.dir, "params.yml")
+
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	s.NoError(err)
+
+	return path
+}
+
+func TestParams(t *testing.T) {
+	suite.Run(t, &ParamsSuite{
+		Assertions: require.New(t),
+	})
+}
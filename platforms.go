@@ -0,0 +1,86 @@
+package task
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// platformVariants are the variants of each architecture that images are
+// published for, e.g. linux/arm/v7. Architectures not listed have none.
+var platformVariants = map[string][]string{
+	"arm":   {"v5", "v6", "v7", "v8"},
+	"arm64": {"v8", "v9"},
+	"amd64": {"v1", "v2", "v3", "v4"},
+}
+
+// splitPlatforms returns each of the comma-separated platforms.
+func splitPlatforms(platforms string) []string {
+	var split []string
+	for _, platform := range strings.Split(platforms, ",") {
+		platform = strings.TrimSpace(platform)
+		if platform != "" {
+			split = append(split, platform)
+		}
+	}
+
+	return split
+}
+
+// validatePlatform checks that the platform is <os>/<arch>[/<variant>], with a
+// variant that exists for the architecture, since buildkit would otherwise
+// only fail once pulling a base image finds no match.
+func validatePlatform(platform string) error {
+	segs := strings.Split(platform, "/")
+	if len(segs) < 2 || len(segs) > 3 || segs[0] == "" || segs[1] == "" {
+		return errors.Errorf("invalid platform '%s': expected <os>/<arch>[/<variant>]", platform)
+	}
+
+	if len(segs) == 2 {
+		return nil
+	}
+
+	arch, variant := segs[1], segs[2]
+
+	variants, found := platformVariants[arch]
+	if !found {
+		return errors.Errorf("invalid platform '%s': architecture '%s' has no variants", platform, arch)
+	}
+
+	if !contains(variants, variant) {
+		return errors.Errorf("invalid platform '%s': architecture '%s' has no variant '%s' (expected one of %s)", platform, arch, variant, strings.Join(variants, ", "))
+	}
+
+	return nil
+}
+
+// platformSuffix returns the suffix identifying the platform's files when
+// splitting by platform, e.g. "-linux-arm64-v8" for linux/arm64/v8.
+func platformSuffix(platform string) string {
+	return "-" + strings.ReplaceAll(platform, "/", "-")
+}
+
+// platformImagePath returns the path of the image tarball for the platform
+// within the output dir, e.g. image/image-linux-amd64.tar.
+func platformImagePath(outputDir string, platform string) string {
+	return filepath.Join(outputDir, "image"+platformSuffix(platform)+".tar")
+}
+
+// digestPath returns the path of the digest file for the image tarball, e.g.
+// image/digest for image/image.tar, or image/digest-linux-amd64 for
+// image/image-linux-amd64.tar.
+func digestPath(imagePath string) string {
+	return imageFilePath(imagePath, "digest")
+}
+
+// digestTagPath returns the path of the digest tag file for the image
+// tarball, named like its digest file.
+func digestTagPath(imagePath string) string {
+	return imageFilePath(imagePath, "digest-tag")
+}
+
+func imageFilePath(imagePath string, name string) string {
+	suffix := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(imagePath), "image"), ".tar")
+	return filepath.Join(filepath.Dir(imagePath), name+suffix)
+}
@@ -0,0 +1,85 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type PlatformsSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *PlatformsSuite) TestSplitPlatforms() {
+	s.Equal(
+		[]string{"linux/amd64", "linux/arm64", "linux/arm/v7"},
+		splitPlatforms("linux/amd64, linux/arm64,,linux/arm/v7"),
+	)
+
+	s.Empty(splitPlatforms(""))
+}
+
+func (s *PlatformsSuite) TestValidatePlatform() {
+	for _, platform := range []string{"linux/amd64", "linux/arm/v7", "linux/arm/v6", "linux/arm64/v8", "linux/amd64/v3", "windows/amd64"} {
+		s.NoError(validatePlatform(platform), platform)
+	}
+
+	for _, platform := range []string{"linux", "linux/", "/amd64", "linux/arm/v7/extra", "linux/arm/v9", "linux/arm64/v7", "linux/s390x/v1"} {
+		s.Error(validatePlatform(platform), platform)
+	}
+
+	err := validatePlatform("linux/arm/v9")
+	s.Contains(err.Error(), "expected one of v5, v6, v7, v8")
+}
+
+func (s *PlatformsSuite) TestPlatformImagePath() {
+	s.Equal("/outputs/image/image-linux-amd64.tar", platformImagePath("/outputs/image", "linux/amd64"))
+	s.Equal("/outputs/image/image-linux-arm-v7.tar", platformImagePath("/outputs/image", "linux/arm/v7"))
+}
+
+func (s *PlatformsSuite) TestDigestPath() {
+	s.Equal("/outputs/image/digest", digestPath("/outputs/image/image.tar"))
+	s.Equal("/outputs/image/digest-linux-amd64", digestPath("/outputs/image/image-linux-amd64.tar"))
+	s.Equal("/outputs/image/digest-linux-arm-v7", digestPath(platformImagePath("/outputs/image", "linux/arm/v7")))
+}
+
+func (s *PlatformsSuite) TestDigestTagPath() {
+	s.Equal("/outputs/image/digest-tag", digestTagPath("/outputs/image/image.tar"))
+	s.Equal("/outputs/image/digest-tag-linux-amd64", digestTagPath("/outputs/image/image-linux-amd64.tar"))
+}
+
+func (s *PlatformsSuite) TestResponseOutputs() {
+	outputs := responseOutputs(Config{SplitByPlatform: true}, []string{
+		"/outputs/image/image-linux-amd64.tar",
+		"/outputs/image/image-linux-arm64.tar",
+	}, true)
+	s.Equal([]string{"image", "cache"}, outputs)
+}
+
+func (s *PlatformsSuite) TestSanitize() {
+	cfg := Config{SplitByPlatform: true, ImagePlatform: "linux/amd64,linux/arm64"}
+	s.NoError(sanitize(&cfg))
+
+	cfg = Config{SplitByPlatform: true}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{SplitByPlatform: true, ImagePlatform: "linux/amd64", OutputType: "oci"}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{SplitByPlatform: true, ImagePlatform: "linux/amd64", UnpackRootfs: true}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{ImagePlatform: "linux/amd64,linux/arm/v7"}
+	s.NoError(sanitize(&cfg))
+
+	cfg = Config{ImagePlatform: "linux/amd64,linux/amd64/v7"}
+	s.Error(sanitize(&cfg))
+}
+
+func TestPlatforms(t *testing.T) {
+	suite.Run(t, &PlatformsSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,133 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+)
+
+// wantsProvenance returns whether a provenance attestation was requested.
+func wantsProvenance(cfg Config) bool {
+	for _, attestation := range cfg.Attestations {
+		if strings.HasPrefix(attestation, "attest:provenance=") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// slsaPredicateTypePrefix prefixes the predicate type of every version of
+// SLSA provenance, e.g. https://slsa.dev/provenance/v0.2.
+const slsaPredicateTypePrefix = "https://slsa.dev/provenance/"
+
+// extractProvenance writes the provenance attached to the image in the OCI
+// layout at layoutDir to the given path, as the in-toto statement.
+func extractProvenance(layoutDir string, dest string) error {
+	provenance, err := readProvenance(layoutDir)
+	if err != nil {
+		return err
+	}
+
+	return writeIndented(dest, provenance)
+}
+
+// extractSLSAPredicate writes just the SLSA predicate of the provenance
+// attached to the image in the OCI layout at layoutDir to the given path, for
+// policy engines which expect it on its own rather than wrapped in an in-toto
+// statement.
+func extractSLSAPredicate(layoutDir string, dest string) error {
+	provenance, err := readProvenance(layoutDir)
+	if err != nil {
+		return err
+	}
+
+	predicate, err := slsaPredicate(provenance)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return errors.Wrap(err, "create SLSA provenance dir")
+	}
+
+	return writeIndented(dest, predicate)
+}
+
+// readProvenance returns the in-toto statement of the first provenance
+// attestation attached to the image in the OCI layout at layoutDir. For a
+// multi-platform image, that is the first platform's.
+func readProvenance(layoutDir string) ([]byte, error) {
+	var provenance []byte
+	err := walkAttestations(layoutDir, func(_ v1.Hash, predicateType string, statement []byte) error {
+		if provenance == nil && strings.HasPrefix(predicateType, slsaPredicateTypePrefix) {
+			provenance = statement
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if provenance == nil {
+		// buildkit older than v0.11 ignores the attest:provenance opt
+		return nil, errors.New("no provenance attestation attached to the image; provenance requires buildkit v0.11+")
+	}
+
+	return provenance, nil
+}
+
+// inTotoStatement is the envelope of an in-toto attestation.
+type inTotoStatement struct {
+	Type          string          `json:"_type"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// slsaPredicate returns the SLSA predicate of the provenance's in-toto
+// statement.
+func slsaPredicate(provenance []byte) ([]byte, error) {
+	var statement inTotoStatement
+	err := json.Unmarshal(provenance, &statement)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse provenance")
+	}
+
+	if !strings.HasPrefix(statement.PredicateType, slsaPredicateTypePrefix) {
+		return nil, errors.Errorf("provenance has predicate type '%s', not SLSA provenance", statement.PredicateType)
+	}
+
+	if len(statement.Predicate) == 0 {
+		return nil, errors.New("provenance has no predicate")
+	}
+
+	return statement.Predicate, nil
+}
+
+// slsaProvenancePath returns where to write the SLSA provenance: the
+// configured path, which is within the outputs unless absolute.
+func slsaProvenancePath(cfg Config, outputsDir string) string {
+	if filepath.IsAbs(cfg.SLSAProvenanceFile) {
+		return cfg.SLSAProvenanceFile
+	}
+
+	return filepath.Join(outputsDir, cfg.SLSAProvenanceFile)
+}
+
+func writeIndented(dest string, content []byte) error {
+	var indented bytes.Buffer
+	err := json.Indent(&indented, content, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "parse provenance")
+	}
+
+	return ioutil.WriteFile(dest, indented.Bytes(), 0644)
+}
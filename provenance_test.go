@@ -0,0 +1,131 @@
+package task
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProvenanceSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *ProvenanceSuite) provenance(path string) map[string]interface{} {
+	content, err := ioutil.ReadFile(path)
+	s.NoError(err)
+
+	var provenance map[string]interface{}
+	s.NoError(json.Unmarshal(content, &provenance))
+
+	return provenance
+}
+
+// noAttestationsLayout writes an OCI layout of an image without any
+// attestations, as exported by buildkit older than v0.11.
+func (s *ProvenanceSuite) noAttestationsLayout() string {
+	image, err := random.Image(1024, 1)
+	s.NoError(err)
+
+	layoutDir := s.T().TempDir()
+	l, err := layout.Write(layoutDir, empty.Index)
+	s.NoError(err)
+	s.NoError(l.AppendImage(image))
+
+	return layoutDir
+}
+
+func (s *ProvenanceSuite) TestWantsProvenance() {
+	s.True(wantsProvenance(Config{Attestations: []string{"attest:sbom=", "attest:provenance=mode=max"}}))
+	s.False(wantsProvenance(Config{Attestations: []string{"attest:sbom="}}))
+	s.False(wantsProvenance(Config{}))
+}
+
+func (s *ProvenanceSuite) TestExtract() {
+	dest := filepath.Join(s.T().TempDir(), "provenance.json")
+
+	s.NoError(extractProvenance("testdata/attestations", dest))
+
+	provenance := s.provenance(dest)
+	s.Equal("https://in-toto.io/Statement/v0.1", provenance["_type"])
+	s.Equal("https://slsa.dev/provenance/v0.2", provenance["predicateType"])
+	s.Equal("https://mobyproject.org/buildkit@v1", provenance["predicate"].(map[string]interface{})["buildType"])
+}
+
+func (s *ProvenanceSuite) TestNoProvenance() {
+	err := extractProvenance(s.noAttestationsLayout(), filepath.Join(s.T().TempDir(), "provenance.json"))
+	s.Error(err)
+	s.Contains(err.Error(), "no provenance")
+}
+
+func (s *ProvenanceSuite) TestExtractSLSAPredicate() {
+	dest := filepath.Join(s.T().TempDir(), "provenance", "slsa.json")
+
+	s.NoError(extractSLSAPredicate("testdata/attestations", dest))
+
+	predicate := s.provenance(dest)
+	s.Equal("https://mobyproject.org/buildkit@v1", predicate["buildType"])
+	s.Equal(map[string]interface{}{"id": ""}, predicate["builder"])
+}
+
+func (s *ProvenanceSuite) TestSLSAPredicateNotSLSA() {
+	_, err := slsaPredicate([]byte(`{
+		"_type": "https://in-toto.io/Statement/v0.1",
+		"predicateType": "https://spdx.dev/Document",
+		"predicate": {}
+	}`))
+	s.Error(err)
+	s.Contains(err.Error(), "not SLSA provenance")
+}
+
+func (s *ProvenanceSuite) TestSLSAPredicateMissing() {
+	_, err := slsaPredicate([]byte(`{
+		"_type": "https://in-toto.io/Statement/v0.1",
+		"predicateType": "https://slsa.dev/provenance/v0.2"
+	}`))
+	s.Error(err)
+	s.Contains(err.Error(), "no predicate")
+}
+
+func (s *ProvenanceSuite) TestExtractSLSAPredicateNoProvenance() {
+	dest := filepath.Join(s.T().TempDir(), "slsa.json")
+
+	err := extractSLSAPredicate(s.noAttestationsLayout(), dest)
+	s.Error(err)
+	s.Contains(err.Error(), "no provenance")
+
+	s.NoFileExists(dest)
+}
+
+func (s *ProvenanceSuite) TestSLSAProvenancePath() {
+	s.Equal("/outputs/provenance/slsa.json", slsaProvenancePath(Config{SLSAProvenanceFile: "provenance/slsa.json"}, "/outputs"))
+	s.Equal("/tmp/slsa.json", slsaProvenancePath(Config{SLSAProvenanceFile: "/tmp/slsa.json"}, "/outputs"))
+}
+
+func (s *ProvenanceSuite) TestSanitizeSLSAProvenance() {
+	cfg := Config{SLSAProvenanceFile: "provenance/slsa.json", OutputType: "oci"}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "requires a provenance attestation")
+
+	cfg = Config{SLSAProvenanceFile: "provenance/slsa.json", Attestations: []string{"attest:provenance=mode=max"}}
+	err = sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "output type 'docker'")
+
+	cfg = Config{SLSAProvenanceFile: "provenance/slsa.json", Attestations: []string{"attest:provenance=mode=max"}, OutputType: "oci"}
+	s.NoError(sanitize(&cfg))
+}
+
+func TestProvenance(t *testing.T) {
+	suite.Run(t, &ProvenanceSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,54 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// pruneArgs returns the buildctl args for pruning the cache down to what is
+// allowed by PruneAfter, which is either a duration (e.g. '24h') to keep
+// recently used records for, or a size (e.g. '10GB') to keep under. Values
+// which parse as a duration are treated as one, so '30m' is 30 minutes.
+// Zero is rejected rather than pruning everything.
+func pruneArgs(pruneAfter string) ([]string, error) {
+	if duration, err := time.ParseDuration(pruneAfter); err == nil {
+		if duration <= 0 {
+			return nil, fmt.Errorf("must be more than zero, or empty to not prune")
+		}
+
+		return []string{"prune", "--keep-duration", duration.String()}, nil
+	}
+
+	size, err := parseSize(pruneAfter)
+	if err != nil {
+		return nil, fmt.Errorf("must be a duration or a size: %w", err)
+	}
+
+	if size <= 0 {
+		return nil, fmt.Errorf("must be more than zero, or empty to not prune")
+	}
+
+	// buildctl takes the storage to keep in MB
+	return []string{"prune", "--keep-storage", fmt.Sprintf("%g", float64(size)/(1<<20))}, nil
+}
+
+// prune prunes buildkit's cache on a best-effort basis; failing to prune does
+// not fail the build.
+func prune(ctx context.Context, buildkitd *Buildkitd, pruneAfter string) {
+	args, err := pruneArgs(pruneAfter)
+	if err != nil {
+		logrus.Warn("failed to prune cache:", err)
+		return
+	}
+
+	logrus.Info("pruning cache")
+
+	err = buildkitd.buildctl(ctx, os.Stdout, args...)
+	if err != nil {
+		logrus.Warn("failed to prune cache:", err)
+	}
+}
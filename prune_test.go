@@ -0,0 +1,57 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type PruneSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *PruneSuite) TestDuration() {
+	args, err := pruneArgs("24h")
+	s.NoError(err)
+	s.Equal([]string{"prune", "--keep-duration", "24h0m0s"}, args)
+}
+
+func (s *PruneSuite) TestSize() {
+	args, err := pruneArgs("10GB")
+	s.NoError(err)
+	s.Equal([]string{"prune", "--keep-storage", "10240"}, args)
+
+	args, err = pruneArgs("512MB")
+	s.NoError(err)
+	s.Equal([]string{"prune", "--keep-storage", "512"}, args)
+}
+
+func (s *PruneSuite) TestAmbiguousUnit() {
+	// 'm' is minutes, not megabytes
+	args, err := pruneArgs("30m")
+	s.NoError(err)
+	s.Equal([]string{"prune", "--keep-duration", "30m0s"}, args)
+}
+
+func (s *PruneSuite) TestInvalid() {
+	_, err := pruneArgs("a while")
+	s.Error(err)
+}
+
+func (s *PruneSuite) TestZero() {
+	for _, pruneAfter := range []string{"0", "0s", "0B", "-1h"} {
+		_, err := pruneArgs(pruneAfter)
+		s.Error(err, pruneAfter)
+	}
+
+	cfg := Config{PruneAfter: "0"}
+	s.Error(sanitize(&cfg))
+}
+
+func TestPrune(t *testing.T) {
+	suite.Run(t, &PruneSuite{
+		Assertions: require.New(t),
+	})
+}
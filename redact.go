@@ -0,0 +1,134 @@
+package task
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "[REDACTED]"
+
+// redactConfig returns a copy of the config with any secret values masked so
+// that it is safe to log.
+func redactConfig(cfg Config) Config {
+	if len(cfg.BuildkitSecrets) > 0 {
+		secrets := make(map[string]string, len(cfg.BuildkitSecrets))
+		for id := range cfg.BuildkitSecrets {
+			secrets[id] = redacted
+		}
+
+		cfg.BuildkitSecrets = secrets
+	}
+
+	if len(cfg.SecretBuildArgs) > 0 {
+		buildArgs := make([]string, len(cfg.BuildArgs))
+		for i, arg := range cfg.BuildArgs {
+			buildArgs[i] = redactBuildArg(cfg.SecretBuildArgs, arg)
+		}
+
+		cfg.BuildArgs = buildArgs
+	}
+
+	if isRemoteContext(cfg.ContextDir) {
+		contextURL, err := url.Parse(cfg.ContextDir)
+		if err == nil {
+			cfg.ContextDir = redactContextURL(contextURL)
+		}
+	}
+
+	if cfg.WebhookURL != "" {
+		cfg.WebhookURL = redactURL(cfg.WebhookURL)
+	}
+
+	if cfg.WebhookSecret != "" {
+		cfg.WebhookSecret = redacted
+	}
+
+	if cfg.PackageProxy != "" {
+		proxyURL, err := url.Parse(cfg.PackageProxy)
+		if err == nil {
+			cfg.PackageProxy = proxyURL.Redacted()
+		}
+	}
+
+	if len(cfg.RegistryMirrors) > 0 {
+		mirrors := make([]MirrorSpec, len(cfg.RegistryMirrors))
+		for i, mirror := range cfg.RegistryMirrors {
+			if mirror.Password != "" {
+				mirror.Password = redacted
+			}
+
+			mirrors[i] = mirror
+		}
+
+		cfg.RegistryMirrors = mirrors
+	}
+
+	return cfg
+}
+
+// redactURL masks all but the scheme and host of the URL, as its userinfo,
+// path or query may hold a token.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+
+	return u.Scheme + "://" + u.Host + "/" + redacted
+}
+
+// redactBuildArg masks the value of a key=value build arg if its key is one
+// of the secret build args.
+func redactBuildArg(secretBuildArgs []string, arg string) string {
+	key := strings.SplitN(arg, "=", 2)[0]
+	if !contains(secretBuildArgs, key) {
+		return arg
+	}
+
+	return key + "=" + redacted
+}
+
+// redactArgs returns a copy of the buildctl args with the sources of any
+// secrets, and the values of any secret build args, masked, matching
+// redactConfig.
+func redactArgs(cfg Config, args []string) []string {
+	redactedArgs := make([]string, len(args))
+	copy(redactedArgs, args)
+
+	for i := 1; i < len(redactedArgs); i++ {
+		if redactedArgs[i-1] == "--opt" && strings.HasPrefix(redactedArgs[i], "build-arg:") {
+			arg := strings.TrimPrefix(redactedArgs[i], "build-arg:")
+			redactedArgs[i] = "build-arg:" + redactBuildArg(cfg.SecretBuildArgs, arg)
+			continue
+		}
+
+		if redactedArgs[i-1] != "--secret" {
+			continue
+		}
+
+		fields := strings.Split(redactedArgs[i], ",")
+		for j, field := range fields {
+			if strings.HasPrefix(field, "src=") {
+				fields[j] = "src=" + redacted
+			}
+		}
+
+		redactedArgs[i] = strings.Join(fields, ",")
+	}
+
+	return redactedArgs
+}
+
+func printConfig(cfg Config) error {
+	payload, err := json.MarshalIndent(redactConfig(cfg), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("resolved config:\n%s", payload)
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package task
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type RedactSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *RedactSuite) TestRedactConfig() {
+	cfg := Config{
+		ContextDir: "some-context",
+		BuildkitSecrets: map[string]string{
+			"token": "/tmp/buildkit-secrets/token",
+		},
+	}
+
+	redactedCfg := redactConfig(cfg)
+	s.Equal(map[string]string{"token": redacted}, redactedCfg.BuildkitSecrets)
+	s.Equal("some-context", redactedCfg.ContextDir)
+
+	// the original config is left untouched
+	s.Equal("/tmp/buildkit-secrets/token", cfg.BuildkitSecrets["token"])
+}
+
+func (s *RedactSuite) TestPrintConfig() {
+	buf := new(bytes.Buffer)
+	logrus.SetOutput(buf)
+	defer logrus.SetOutput(os.Stderr)
+
+	err := printConfig(Config{
+		ContextDir:     "some-context",
+		DockerfilePath: "some-context/Dockerfile",
+		BuildArgs:      []string{"some_arg=some_value"},
+		BuildkitSecrets: map[string]string{
+			"token": "/tmp/buildkit-secrets/token",
+		},
+	})
+	s.NoError(err)
+
+	s.Contains(buf.String(), `\"context\": \"some-context\"`)
+	s.Contains(buf.String(), `\"dockerfile\": \"some-context/Dockerfile\"`)
+	s.Contains(buf.String(), `\"some_arg=some_value\"`)
+	s.Contains(buf.String(), `\"token\": \"`+redacted+`\"`)
+	s.NotContains(buf.String(), "/tmp/buildkit-secrets/token")
+}
+
+func (s *RedactSuite) TestRedactArgs() {
+	args := commonBuildArgs(Config{
+		ContextDir:     "some-context",
+		DockerfilePath: "some-context/Dockerfile",
+		ContextName:    "context",
+		BuildArgs:      []string{"some_arg=some_value"},
+		BuildkitSecrets: map[string]string{
+			"token": "/tmp/buildkit-secrets/token",
+		},
+	})
+
+	s.Equal([]string{
+		"build",
+		"--progress", "plain",
+		"--frontend", "dockerfile.v0",
+		"--local", "context=some-context",
+		"--local", "dockerfile=some-context",
+		"--opt", "filename=Dockerfile",
+		"--opt", "build-arg:some_arg=some_value",
+		"--secret", "id=token,src=" + redacted,
+	}, redactArgs(Config{}, args))
+
+	// the original args are left untouched
+	s.Equal("id=token,src=/tmp/buildkit-secrets/token", args[len(args)-1])
+}
+
+func (s *RedactSuite) TestRedactSecretBuildArgs() {
+	cfg := Config{
+		ContextDir:      "some-context",
+		DockerfilePath:  "some-context/Dockerfile",
+		ContextName:     "context",
+		BuildArgs:       []string{"some_arg=some_value", "TOKEN=hunter2", "TOKEN_NAME=deploy"},
+		SecretBuildArgs: []string{"TOKEN"},
+	}
+
+	args := commonBuildArgs(cfg)
+
+	// the secret build arg is still sent to buildkit
+	s.Contains(args, "build-arg:TOKEN=hunter2")
+
+	redactedArgs := redactArgs(cfg, args)
+	s.Contains(redactedArgs, "build-arg:some_arg=some_value")
+	s.Contains(redactedArgs, "build-arg:TOKEN="+redacted)
+	s.Contains(redactedArgs, "build-arg:TOKEN_NAME=deploy")
+	s.NotContains(strings.Join(redactedArgs, " "), "hunter2")
+
+	redactedCfg := redactConfig(cfg)
+	s.Equal([]string{"some_arg=some_value", "TOKEN=" + redacted, "TOKEN_NAME=deploy"}, redactedCfg.BuildArgs)
+
+	// the original config is left untouched
+	s.Equal("TOKEN=hunter2", cfg.BuildArgs[1])
+}
+
+func TestRedact(t *testing.T) {
+	suite.Run(t, &RedactSuite{
+		Assertions: require.New(t),
+	})
+}
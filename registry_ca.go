@@ -0,0 +1,64 @@
+package task
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// splitRegistryCACert splits a <registry>=<path> RegistryCACerts entry.
+func splitRegistryCACert(entry string) (string, string, bool) {
+	seg := strings.SplitN(entry, "=", 2)
+	if len(seg) != 2 || seg[0] == "" || seg[1] == "" {
+		return "", "", false
+	}
+
+	return seg[0], seg[1], true
+}
+
+// validateRegistryCACerts checks that each RegistryCACerts entry is of the
+// form <registry>=<path>, and that the path is a PEM-encoded certificate, so
+// that a typo fails clearly rather than buildkitd failing to start.
+func validateRegistryCACerts(entries []string) error {
+	for _, entry := range entries {
+		registry, path, ok := splitRegistryCACert(entry)
+		if !ok {
+			return errors.Errorf("invalid registry ca cert '%s'; expected <registry>=<path>", entry)
+		}
+
+		pem, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "read ca cert for registry '%s'", registry)
+		}
+
+		if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			return errors.Errorf("no certificates in ca cert '%s' for registry '%s'", path, registry)
+		}
+	}
+
+	return nil
+}
+
+// registryCACerts returns the absolute paths of the CA certs to trust for
+// each registry, as buildkitd resolves them relative to its own working dir.
+func registryCACerts(entries []string) map[string][]string {
+	certs := map[string][]string{}
+	for _, entry := range entries {
+		registry, path, ok := splitRegistryCACert(entry)
+		if !ok {
+			continue
+		}
+
+		abs, err := filepath.Abs(path)
+		if err == nil {
+			path = abs
+		}
+
+		certs[registry] = append(certs[registry], path)
+	}
+
+	return certs
+}
@@ -0,0 +1,208 @@
+package task
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/concourse/go-archive/tgzfs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxRemoteContextSize is the most that will be downloaded for a remote
+// context, to avoid filling up the worker's disk.
+const maxRemoteContextSize = 1 << 30
+
+// contextFetcher downloads a remote context tarball.
+type contextFetcher interface {
+	Fetch(contextURL *url.URL) (io.ReadCloser, error)
+}
+
+// contextFetchers are the fetchers for each supported remote context URL
+// scheme.
+var contextFetchers = map[string]contextFetcher{
+	"http":  httpFetcher{},
+	"https": httpFetcher{},
+
+	// object storage is fetched with the provider's CLI, so that it picks up
+	// credentials in the usual ways (env, instance metadata, etc.)
+	"s3": commandFetcher{"aws", "s3", "cp", "{url}", "-"},
+	"gs": commandFetcher{"gsutil", "cat", "{url}"},
+}
+
+// isRemoteContext returns whether the context is a URL of a gzipped tarball to
+// download, rather than a local directory.
+func isRemoteContext(context string) bool {
+	u, err := url.Parse(context)
+	if err != nil {
+		return false
+	}
+
+	if _, ok := contextFetchers[u.Scheme]; !ok {
+		return false
+	}
+
+	return strings.HasSuffix(u.Path, ".tar.gz") || strings.HasSuffix(u.Path, ".tgz")
+}
+
+// redactContextURL returns the context URL without its userinfo or query, as
+// a presigned URL carries its credentials there.
+func redactContextURL(contextURL *url.URL) string {
+	stripped := *contextURL
+	stripped.User = nil
+	stripped.RawQuery = ""
+	stripped.Fragment = ""
+	return stripped.String()
+}
+
+// fetchContext downloads the gzipped tarball at the given URL and extracts it
+// into a new temporary directory, which the caller must remove when done.
+func fetchContext(contextURL string, maxSize int64) (string, error) {
+	u, err := url.Parse(contextURL)
+	if err != nil {
+		return "", withoutURL(err)
+	}
+
+	fetcher, ok := contextFetchers[u.Scheme]
+	if !ok {
+		return "", errors.Errorf("unsupported context URL scheme '%s'", u.Scheme)
+	}
+
+	logrus.Infof("fetching context from %s", redactContextURL(u))
+
+	body, err := fetcher.Fetch(u)
+	if err != nil {
+		return "", errors.Wrap(err, "download")
+	}
+
+	archive, err := ioutil.TempFile("", "oci-build-task-context-*.tar.gz")
+	if err != nil {
+		body.Close()
+		return "", errors.Wrap(err, "create temp file")
+	}
+
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	n, err := io.Copy(archive, io.LimitReader(body, maxSize+1))
+	if err != nil {
+		body.Close()
+		return "", errors.Wrap(err, "download")
+	}
+
+	if n > maxSize {
+		body.Close()
+		return "", errors.Errorf("download: context exceeds maximum size of %d bytes", maxSize)
+	}
+
+	err = body.Close()
+	if err != nil {
+		return "", errors.Wrap(err, "download")
+	}
+
+	_, err = archive.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", errors.Wrap(err, "rewind")
+	}
+
+	contextDir, err := ioutil.TempDir("", "oci-build-task-context")
+	if err != nil {
+		return "", errors.Wrap(err, "create context dir")
+	}
+
+	err = tgzfs.Extract(archive, contextDir)
+	if err != nil {
+		os.RemoveAll(contextDir)
+		return "", errors.Wrap(err, "extract")
+	}
+
+	return contextDir, nil
+}
+
+var remoteContextTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/x-compressed-tar": true,
+	"application/x-tar":            true,
+	"application/octet-stream":     true,
+}
+
+// httpFetcher downloads the context with a GET, verifying that the response
+// looks like a tarball.
+type httpFetcher struct{}
+
+func (httpFetcher) Fetch(contextURL *url.URL) (io.ReadCloser, error) {
+	resp, err := http.Get(contextURL.String())
+	if err != nil {
+		return nil, withoutURL(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("unexpected status %s", resp.Status)
+	}
+
+	contentType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !remoteContextTypes[contentType] {
+		resp.Body.Close()
+		return nil, errors.Errorf("unexpected content type '%s'", resp.Header.Get("Content-Type"))
+	}
+
+	return resp.Body, nil
+}
+
+// commandFetcher streams the context from the stdout of a command, with any
+// "{url}" arg replaced with the context URL.
+type commandFetcher []string
+
+func (fetcher commandFetcher) Fetch(contextURL *url.URL) (io.ReadCloser, error) {
+	args := make([]string, len(fetcher)-1)
+	for i, arg := range fetcher[1:] {
+		args[i] = strings.ReplaceAll(arg, "{url}", contextURL.String())
+	}
+
+	cmd := exec.Command(fetcher[0], args...)
+
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, errors.Wrapf(err, "run %s", fetcher[0])
+	}
+
+	return &commandOutput{ReadCloser: stdout, cmd: cmd, stderr: stderr}, nil
+}
+
+// commandOutput is the stdout of a running command, which is waited on when
+// closed.
+type commandOutput struct {
+	io.ReadCloser
+
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (output *commandOutput) Close() error {
+	// stop the command if it hasn't finished writing, e.g. when too large
+	output.ReadCloser.Close()
+
+	err := output.cmd.Wait()
+	if err != nil {
+		return errors.Wrapf(err, "%s: %s", output.cmd.Path, strings.TrimSpace(output.stderr.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package task
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type RemoteContextSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	tarball []byte
+}
+
+func (s *RemoteContextSuite) SetupTest() {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+
+	dockerfile := []byte("FROM busybox\n")
+	s.NoError(tw.WriteHeader(&tar.Header{
+		Name:     "Dockerfile",
+		Mode:     0644,
+		Size:     int64(len(dockerfile)),
+		Typeflag: tar.TypeReg,
+	}))
+	_, err := tw.Write(dockerfile)
+	s.NoError(err)
+
+	s.NoError(tw.Close())
+	s.NoError(gz.Close())
+
+	s.tarball = buf.Bytes()
+}
+
+func (s *RemoteContextSuite) serve(contentType string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/context.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Write(s.tarball)
+	}))
+
+	s.T().Cleanup(server.Close)
+
+	return server
+}
+
+func (s *RemoteContextSuite) TestIsRemoteContext() {
+	s.True(isRemoteContext("https://example.com/source/context.tar.gz"))
+	s.True(isRemoteContext("http://example.com/context.tgz"))
+	s.True(isRemoteContext("https://example.com/context.tar.gz?token=abc"))
+
+	s.False(isRemoteContext("."))
+	s.False(isRemoteContext("some/context.tar.gz"))
+	s.False(isRemoteContext("ftp://example.com/context.tar.gz"))
+	s.False(isRemoteContext("https://example.com/context.zip"))
+	s.False(isRemoteContext("https://example.com/"))
+}
+
+func (s *RemoteContextSuite) TestIsRemoteContextObjectStorage() {
+	s.True(isRemoteContext("s3://bucket/path/context.tar.gz"))
+	s.True(isRemoteContext("gs://bucket/context.tgz"))
+
+	s.False(isRemoteContext("s3://bucket/context.zip"))
+	s.False(isRemoteContext("azure://container/context.tar.gz"))
+}
+
+func (s *RemoteContextSuite) TestFetchContextDispatch() {
+	fetcher := &fakeFetcher{tarball: s.tarball}
+	contextFetchers["fake"] = fetcher
+	defer delete(contextFetchers, "fake")
+
+	s.True(isRemoteContext("fake://bucket/context.tar.gz"))
+
+	contextDir, err := fetchContext("fake://bucket/context.tar.gz", maxRemoteContextSize)
+	s.NoError(err)
+
+	defer os.RemoveAll(contextDir)
+
+	s.Equal("fake://bucket/context.tar.gz", fetcher.fetched)
+
+	dockerfile, err := ioutil.ReadFile(filepath.Join(contextDir, "Dockerfile"))
+	s.NoError(err)
+	s.Equal("FROM busybox\n", string(dockerfile))
+}
+
+func (s *RemoteContextSuite) TestCommandFetcher() {
+	tarball := filepath.Join(s.T().TempDir(), "context.tar.gz")
+	s.NoError(ioutil.WriteFile(tarball, s.tarball, 0644))
+
+	contextFetchers["fake"] = commandFetcher{"sh", "-c", "test {url} = fake://bucket/context.tar.gz && cat " + tarball}
+	defer delete(contextFetchers, "fake")
+
+	contextDir, err := fetchContext("fake://bucket/context.tar.gz", maxRemoteContextSize)
+	s.NoError(err)
+
+	defer os.RemoveAll(contextDir)
+
+	_, err = os.Stat(filepath.Join(contextDir, "Dockerfile"))
+	s.NoError(err)
+}
+
+func (s *RemoteContextSuite) TestCommandFetcherFails() {
+	contextFetchers["fake"] = commandFetcher{"sh", "-c", "echo access denied >&2; exit 1"}
+	defer delete(contextFetchers, "fake")
+
+	_, err := fetchContext("fake://bucket/context.tar.gz", maxRemoteContextSize)
+	s.Error(err)
+	s.Contains(err.Error(), "access denied")
+}
+
+func (s *RemoteContextSuite) TestFetchContext() {
+	server := s.serve("application/gzip")
+
+	contextDir, err := fetchContext(server.URL+"/context.tar.gz", maxRemoteContextSize)
+	s.NoError(err)
+
+	defer os.RemoveAll(contextDir)
+
+	dockerfile, err := ioutil.ReadFile(filepath.Join(contextDir, "Dockerfile"))
+	s.NoError(err)
+	s.Equal("FROM busybox\n", string(dockerfile))
+}
+
+func (s *RemoteContextSuite) TestFetchContextLogsRedactedURL() {
+	buf := new(bytes.Buffer)
+	logrus.SetOutput(buf)
+	defer logrus.SetOutput(os.Stderr)
+
+	server := s.serve("application/gzip")
+	contextURL, err := url.Parse(server.URL + "/context.tar.gz?X-Amz-Signature=some-signature")
+	s.NoError(err)
+	contextURL.User = url.UserPassword("some-user", "some-password")
+
+	contextDir, err := fetchContext(contextURL.String(), maxRemoteContextSize)
+	s.NoError(err)
+
+	defer os.RemoveAll(contextDir)
+
+	s.Contains(buf.String(), "fetching context from "+server.URL+"/context.tar.gz")
+	s.NotContains(buf.String(), "some-signature")
+	s.NotContains(buf.String(), "some-password")
+}
+
+func (s *RemoteContextSuite) TestRedacted() {
+	s.Equal("https://bucket.example.com/context.tar.gz", redactConfig(Config{ContextDir: "https://bucket.example.com/context.tar.gz?X-Amz-Signature=some-signature"}).ContextDir)
+	s.Equal("some-context", redactConfig(Config{ContextDir: "some-context"}).ContextDir)
+}
+
+func (s *RemoteContextSuite) TestFetchContextErrorOmitsQuery() {
+	server := s.serve("application/gzip")
+	server.Close()
+
+	_, err := fetchContext(server.URL+"/context.tar.gz?X-Amz-Signature=some-signature", maxRemoteContextSize)
+	s.Error(err)
+	s.NotContains(err.Error(), "some-signature")
+}
+
+func (s *RemoteContextSuite) TestFetchContextTooLarge() {
+	server := s.serve("application/gzip")
+
+	_, err := fetchContext(server.URL+"/context.tar.gz", int64(len(s.tarball)-1))
+	s.Error(err)
+	s.Contains(err.Error(), "maximum size")
+}
+
+func (s *RemoteContextSuite) TestFetchContextBadContentType() {
+	server := s.serve("text/html; charset=utf-8")
+
+	_, err := fetchContext(server.URL+"/context.tar.gz", maxRemoteContextSize)
+	s.Error(err)
+	s.Contains(err.Error(), "content type")
+}
+
+func (s *RemoteContextSuite) TestFetchContextNotFound() {
+	server := s.serve("application/gzip")
+
+	_, err := fetchContext(server.URL+"/missing.tar.gz", maxRemoteContextSize)
+	s.Error(err)
+	s.Contains(err.Error(), "404")
+}
+
+type fakeFetcher struct {
+	tarball []byte
+	fetched string
+}
+
+func (fetcher *fakeFetcher) Fetch(contextURL *url.URL) (io.ReadCloser, error) {
+	fetcher.fetched = contextURL.String()
+	return ioutil.NopCloser(bytes.NewReader(fetcher.tarball)), nil
+}
+
+func TestRemoteContext(t *testing.T) {
+	suite.Run(t, &RemoteContextSuite{
+		Assertions: require.New(t),
+	})
+}
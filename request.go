@@ -0,0 +1,29 @@
+package task
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// defaultTerminalWidth is the TerminalWidth when it isn't configured,
+// matching its envconfig default for the task's params.
+const defaultTerminalWidth = 100
+
+// ReadRequest decodes the request from r, with the same defaults as envconfig
+// applies to the task's params, i.e. to TerminalWidth unless the request sets
+// it, even to 0.
+func ReadRequest(r io.Reader) (Request, error) {
+	// decode over the defaults, so that only the fields present replace them
+	req := Request{
+		Config: Config{
+			TerminalWidth: defaultTerminalWidth,
+		},
+	}
+
+	err := json.NewDecoder(r).Decode(&req)
+	if err != nil {
+		return Request{}, err
+	}
+
+	return req, nil
+}
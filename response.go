@@ -0,0 +1,57 @@
+package task
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// responseFormats are the formats the response may be written in, the first
+// being the default.
+var responseFormats = []string{"json", "yaml"}
+
+// validateResponseFormat checks the format is one of responseFormats, or empty
+// for the default.
+func validateResponseFormat(format string) error {
+	if format != "" && !contains(responseFormats, format) {
+		return errors.Errorf("invalid response format '%s': expected json or yaml", format)
+	}
+
+	return nil
+}
+
+// WriteResponse writes the response to w in the given format, json by
+// default. YAML uses the same keys as JSON.
+func WriteResponse(w io.Writer, res Response, format string) error {
+	err := validateResponseFormat(format)
+	if err != nil {
+		return err
+	}
+
+	if format == "" || format == "json" {
+		return json.NewEncoder(w).Encode(res)
+	}
+
+	// round-trip through JSON so that the YAML uses the response's keys
+	payload, err := json.Marshal(res)
+	if err != nil {
+		return errors.Wrap(err, "marshal response")
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(payload, &fields)
+	if err != nil {
+		return errors.Wrap(err, "convert response")
+	}
+
+	encoder := yaml.NewEncoder(w)
+
+	err = encoder.Encode(fields)
+	if err != nil {
+		return errors.Wrap(err, "encode response")
+	}
+
+	return encoder.Close()
+}
@@ -0,0 +1,82 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/yaml.v3"
+)
+
+type ResponseSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+var testResponse = Response{
+	Outputs:       []string{"image", "cache"},
+	Command:       []string{"buildctl", "build"},
+	Warnings:      []string{"FromAsCasing: 'as' and 'FROM' keywords' casing do not match"},
+	CacheDigest:   "sha256:abc123",
+	StageTimings:  map[string]string{"builder": "12.3s"},
+	ContextDigest: "sha256:def456",
+}
+
+// decoded returns the generic form of the response, for comparing formats.
+func (s *ResponseSuite) decoded(format string) map[string]interface{} {
+	var buf bytes.Buffer
+	s.NoError(WriteResponse(&buf, testResponse, format))
+
+	var fields map[string]interface{}
+	if format == "yaml" {
+		s.NoError(yaml.Unmarshal(buf.Bytes(), &fields))
+	} else {
+		s.NoError(json.Unmarshal(buf.Bytes(), &fields))
+	}
+
+	return fields
+}
+
+func (s *ResponseSuite) TestEquivalent() {
+	fromJSON := s.decoded("json")
+	s.Equal(fromJSON, s.decoded("yaml"))
+	s.Equal(fromJSON, s.decoded(""))
+
+	s.Equal("sha256:abc123", fromJSON["cache_digest"])
+	s.Equal(false, fromJSON["skipped"])
+}
+
+func (s *ResponseSuite) TestYAMLDecodesIntoResponse() {
+	var buf bytes.Buffer
+	s.NoError(WriteResponse(&buf, testResponse, "yaml"))
+
+	// as a consumer would, via the JSON keys
+	var fields map[string]interface{}
+	s.NoError(yaml.Unmarshal(buf.Bytes(), &fields))
+
+	payload, err := json.Marshal(fields)
+	s.NoError(err)
+
+	var res Response
+	s.NoError(json.Unmarshal(payload, &res))
+	s.Equal(testResponse, res)
+}
+
+func (s *ResponseSuite) TestInvalidFormat() {
+	var buf bytes.Buffer
+	s.Error(WriteResponse(&buf, testResponse, "toml"))
+
+	cfg := Config{ResponseFormat: "toml"}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{ResponseFormat: "yaml"}
+	s.NoError(sanitize(&cfg))
+}
+
+func TestResponse(t *testing.T) {
+	suite.Run(t, &ResponseSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,33 @@
+package task
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// scanImagePlaceholder is replaced with the path to the image tarball in the
+// ScanCommand.
+const scanImagePlaceholder = "{image}"
+
+// scanCommand returns the command to run for scanning the image at the given
+// path. It is run with sh so that pipes, quoting, etc. work as expected.
+func scanCommand(command string, imagePath string) []string {
+	return []string{"sh", "-c", strings.ReplaceAll(command, scanImagePlaceholder, imagePath)}
+}
+
+func scanImage(command string, imagePath string) error {
+	cmd := scanCommand(command, imagePath)
+
+	logrus.Info("scanning image")
+	logrus.Debugf("running %s", strings.Join(cmd, " "))
+
+	err := run(os.Stdout, cmd[0], cmd[1:]...)
+	if err != nil {
+		return errors.Wrap(err, "scan failed")
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ScanSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *ScanSuite) TestScanCommand() {
+	s.Equal(
+		[]string{"sh", "-c", "trivy image --input /outputs/image/image.tar --exit-code 1"},
+		scanCommand("trivy image --input {image} --exit-code 1", "/outputs/image/image.tar"),
+	)
+}
+
+func (s *ScanSuite) TestScanCommandWithoutPlaceholder() {
+	s.Equal(
+		[]string{"sh", "-c", "my-scanner"},
+		scanCommand("my-scanner", "/outputs/image/image.tar"),
+	)
+}
+
+func (s *ScanSuite) TestScanPasses() {
+	err := scanImage(`test "{image}" = /outputs/image/image.tar`, "/outputs/image/image.tar")
+	s.NoError(err)
+}
+
+func (s *ScanSuite) TestScanFails() {
+	err := scanImage("echo found vulnerabilities; exit 1", "/outputs/image/image.tar")
+	s.Error(err)
+	s.Contains(err.Error(), "scan failed")
+}
+
+func TestScan(t *testing.T) {
+	suite.Run(t, &ScanSuite{
+		Assertions: require.New(t),
+	})
+}
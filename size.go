@@ -0,0 +1,52 @@
+package task
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+}
+
+// parseSize parses a human-readable size such as '500MB' or '10g' into bytes.
+// Units are case-insensitive multiples of 1024.
+func parseSize(size string) (int64, error) {
+	size = strings.TrimSpace(size)
+
+	i := strings.IndexFunc(size, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(size)
+	}
+
+	num, unit := size[:i], strings.ToLower(strings.TrimSpace(size[i:]))
+
+	multiplier, found := sizeUnits[unit]
+	if !found {
+		return 0, errors.Errorf("invalid size '%s': unknown unit '%s'", size, unit)
+	}
+
+	value, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid size '%s'", size)
+	}
+
+	return int64(value * float64(multiplier)), nil
+}
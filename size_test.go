@@ -0,0 +1,45 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type SizeSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *SizeSuite) TestParseSize() {
+	for size, expected := range map[string]int64{
+		"1024":   1024,
+		"100b":   100,
+		"1k":     1024,
+		"1KB":    1024,
+		"1KiB":   1024,
+		"500MB":  500 << 20,
+		"1.5GB":  3 << 29,
+		"2 gb":   2 << 30,
+		"1T":     1 << 40,
+		" 10mb ": 10 << 20,
+	} {
+		actual, err := parseSize(size)
+		s.NoError(err, size)
+		s.Equal(expected, actual, size)
+	}
+}
+
+func (s *SizeSuite) TestParseSizeInvalid() {
+	for _, size := range []string{"", "MB", "10XB", "1.2.3GB", "-1GB"} {
+		_, err := parseSize(size)
+		s.Error(err, size)
+	}
+}
+
+func TestSize(t *testing.T) {
+	suite.Run(t, &SizeSuite{
+		Assertions: require.New(t),
+	})
+}
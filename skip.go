@@ -0,0 +1,277 @@
+package task
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/pkg/fileutils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// previousBuildDir is where, within the cache dir, the last build's inputs
+// hash and images are kept for $SKIP_IF_UNCHANGED.
+const previousBuildDir = "oci-build-task"
+
+// buildInputs are the inputs, besides the context, which determine what is
+// built. Any option which changes the images produced must be included, or
+// changing it would reuse a stale image.
+type buildInputs struct {
+	Dockerfile      string       `json:"dockerfile"`
+	GatewayImage    string       `json:"gateway_image"`
+	BuildArgs       []string     `json:"build_args"`
+	ImageArgs       []string     `json:"image_args"`
+	Labels          []string     `json:"labels"`
+	Target          string       `json:"target"`
+	Targets         []string     `json:"additional_targets"`
+	ImagePlatform   string       `json:"image_platform"`
+	SplitByPlatform bool         `json:"split_by_platform"`
+	OutputType      string       `json:"output_type"`
+	Outputs         []OutputSpec `json:"outputs"`
+	ImageName       string       `json:"image_name"`
+	AddHosts        string       `json:"add_hosts"`
+	Entitlements    []string     `json:"entitlements"`
+	Attestations    []string     `json:"attestations"`
+	MaxLayers       int          `json:"max_layers"`
+	Deterministic   bool         `json:"deterministic_export"`
+	Entrypoint      []string     `json:"entrypoint_override"`
+	Cmd             []string     `json:"cmd_override"`
+}
+
+// inputsHash computes a hash of the context, Dockerfile, and build config.
+// Anything referenced but not contained by these, e.g. a base image tag being
+// moved, is not detected.
+//
+// As with the context sent to buildkit, files matched by the .dockerignore
+// are left out, as are the task's own outputs in case the context contains
+// them, e.g. with the default context of the working dir. Those change with
+// every build, so would otherwise never let one be skipped.
+func inputsHash(cfg Config, outputsDir string, imagePaths []string) (string, error) {
+	hash := sha256.New()
+
+	dockerfile, err := ioutil.ReadFile(cfg.DockerfilePath)
+	if err != nil {
+		return "", errors.Wrap(err, "read dockerfile")
+	}
+
+	// labels and build args derived from the context (e.g. from
+	// LabelsFromBuildArgs or AutoLabelDirty) have been added to these already
+	inputs := buildInputs{
+		Dockerfile:      string(dockerfile),
+		GatewayImage:    cfg.GatewayImage,
+		BuildArgs:       cfg.BuildArgs,
+		Labels:          cfg.Labels,
+		Target:          cfg.Target,
+		Targets:         cfg.AdditionalTargets,
+		ImagePlatform:   cfg.ImagePlatform,
+		SplitByPlatform: cfg.SplitByPlatform,
+		OutputType:      cfg.OutputType,
+		Outputs:         cfg.Outputs,
+		ImageName:       cfg.ImageName,
+		AddHosts:        cfg.AddHosts,
+		Entitlements:    cfg.Entitlements,
+		Attestations:    cfg.Attestations,
+		MaxLayers:       cfg.MaxLayers,
+		Deterministic:   cfg.DeterministicExport,
+		Entrypoint:      cfg.EntrypointOverride,
+		Cmd:             cfg.CmdOverride,
+	}
+
+	// image args are referenced by path, so hash their content instead
+	for _, arg := range cfg.ImageArgs {
+		segs := strings.SplitN(arg, "=", 2)
+		if len(segs) != 2 {
+			continue
+		}
+
+		digest, err := fileHash(segs[1])
+		if err != nil {
+			return "", errors.Wrapf(err, "hash image arg '%s'", segs[0])
+		}
+
+		inputs.ImageArgs = append(inputs.ImageArgs, segs[0]+"="+digest)
+	}
+
+	err = json.NewEncoder(hash).Encode(inputs)
+	if err != nil {
+		return "", err
+	}
+
+	patterns, err := dockerignorePatterns(cfg.ContextDir, cfg.DockerfilePath)
+	if err != nil {
+		return "", err
+	}
+
+	// last, so that no exclusion in the .dockerignore brings them back
+	outputs, err := outputPatterns(cfg.ContextDir, outputsDir, responseOutputs(cfg, imagePaths, true))
+	if err != nil {
+		return "", err
+	}
+
+	patterns = append(patterns, outputs...)
+
+	var ignored *fileutils.PatternMatcher
+	if len(patterns) > 0 {
+		ignored, err = fileutils.NewPatternMatcher(patterns)
+		if err != nil {
+			return "", errors.Wrap(err, "parse dockerignore")
+		}
+	}
+
+	err = hashContext(hash, cfg.ContextDir, ignored)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// outputPatterns returns dockerignore patterns matching each of the outputs
+// within the context dir.
+func outputPatterns(contextDir string, outputsDir string, outputs []string) ([]string, error) {
+	absContext, err := filepath.Abs(contextDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve context dir")
+	}
+
+	var patterns []string
+	for _, output := range outputs {
+		absOutput, err := filepath.Abs(filepath.Join(outputsDir, output))
+		if err != nil {
+			return nil, errors.Wrap(err, "resolve output dir")
+		}
+
+		rel, err := filepath.Rel(absContext, absOutput)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			// not within the context
+			continue
+		}
+
+		patterns = append(patterns, filepath.ToSlash(rel))
+	}
+
+	return patterns, nil
+}
+
+func fileHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// reusePreviousImages copies the images from the previous build into place if
+// it had the same inputs hash and produced all of the given images, returning
+// whether it did.
+func reusePreviousImages(cacheDir string, hash string, imagePaths []string) (bool, error) {
+	previousDir := filepath.Join(cacheDir, previousBuildDir)
+
+	previousHash, err := ioutil.ReadFile(filepath.Join(previousDir, "hash"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, errors.Wrap(err, "read previous hash")
+	}
+
+	if strings.TrimSpace(string(previousHash)) != hash {
+		return false, nil
+	}
+
+	for _, imagePath := range imagePaths {
+		_, err := os.Stat(previousImagePath(previousDir, imagePath))
+		if err != nil {
+			logrus.Warnf("previous build has no image for '%s'; rebuilding", filepath.Base(filepath.Dir(imagePath)))
+			return false, nil
+		}
+	}
+
+	for _, imagePath := range imagePaths {
+		err := linkOrCopy(previousImagePath(previousDir, imagePath), imagePath)
+		if err != nil {
+			return false, errors.Wrap(err, "reuse previous image")
+		}
+	}
+
+	return true, nil
+}
+
+// storePreviousImages saves the built images and inputs hash to the cache dir
+// for the next build to compare against.
+func storePreviousImages(cacheDir string, hash string, imagePaths []string) error {
+	previousDir := filepath.Join(cacheDir, previousBuildDir)
+
+	// clear out any images from the previous build
+	err := os.RemoveAll(previousDir)
+	if err != nil {
+		return err
+	}
+
+	for _, imagePath := range imagePaths {
+		dest := previousImagePath(previousDir, imagePath)
+
+		err := os.MkdirAll(filepath.Dir(dest), 0755)
+		if err != nil {
+			return err
+		}
+
+		err = linkOrCopy(imagePath, dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	// written last, so that it's only present once all images are
+	return ioutil.WriteFile(filepath.Join(previousDir, "hash"), []byte(hash+"\n"), 0644)
+}
+
+func previousImagePath(previousDir string, imagePath string) string {
+	return filepath.Join(previousDir, filepath.Base(filepath.Dir(imagePath)), filepath.Base(imagePath))
+}
+
+// linkOrCopy hard links src to dest, or copies it if they're on different
+// filesystems (e.g. separate volumes).
+func linkOrCopy(src string, dest string) error {
+	err := os.Link(src, dest)
+	if err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,189 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type SkipSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	cfg        Config
+	outputsDir string
+	cacheDir   string
+	imagePaths []string
+}
+
+func (s *SkipSuite) SetupTest() {
+	contextDir := s.T().TempDir()
+	s.NoError(ioutil.WriteFile(filepath.Join(contextDir, "Dockerfile"), []byte("FROM busybox\nCOPY . /app\n"), 0644))
+	s.NoError(os.Mkdir(filepath.Join(contextDir, "src"), 0755))
+	s.NoError(ioutil.WriteFile(filepath.Join(contextDir, "src", "main.go"), []byte("package main\n"), 0644))
+
+	s.cfg = Config{
+		ContextDir: contextDir,
+		BuildArgs:  []string{"VERSION=1.2.3"},
+	}
+	s.NoError(sanitize(&s.cfg))
+
+	s.useOutputsDir(s.T().TempDir())
+}
+
+func (s *SkipSuite) useOutputsDir(outputsDir string) {
+	s.outputsDir = outputsDir
+
+	s.cacheDir = filepath.Join(outputsDir, "cache")
+	s.NoError(os.Mkdir(s.cacheDir, 0755))
+
+	s.imagePaths = []string{filepath.Join(outputsDir, "image", "image.tar")}
+	s.NoError(os.Mkdir(filepath.Join(outputsDir, "image"), 0755))
+}
+
+func (s *SkipSuite) hash() string {
+	hash, err := inputsHash(s.cfg, s.outputsDir, s.imagePaths)
+	s.NoError(err)
+	return hash
+}
+
+func (s *SkipSuite) build(hash string) {
+	s.NoError(ioutil.WriteFile(s.imagePaths[0], []byte("image for "+hash), 0644))
+	s.NoError(storePreviousImages(s.cacheDir, hash, s.imagePaths))
+	s.NoError(os.Remove(s.imagePaths[0]))
+}
+
+func (s *SkipSuite) TestHashStable() {
+	s.Equal(s.hash(), s.hash())
+}
+
+func (s *SkipSuite) TestHashChanges() {
+	original := s.hash()
+
+	s.NoError(ioutil.WriteFile(filepath.Join(s.cfg.ContextDir, "src", "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	changedContext := s.hash()
+	s.NotEqual(original, changedContext)
+
+	s.NoError(ioutil.WriteFile(s.cfg.DockerfilePath, []byte("FROM alpine\n"), 0644))
+	changedDockerfile := s.hash()
+	s.NotEqual(changedContext, changedDockerfile)
+
+	s.cfg.BuildArgs = []string{"VERSION=1.2.4"}
+	s.NotEqual(changedDockerfile, s.hash())
+}
+
+func (s *SkipSuite) TestHashChangesWithOptions() {
+	for name, change := range map[string]func(*Config){
+		"labels":         func(cfg *Config) { cfg.Labels = []string{"version=1.2.3"} },
+		"cmd override":   func(cfg *Config) { cfg.CmdOverride = []string{"serve"} },
+		"entrypoint":     func(cfg *Config) { cfg.EntrypointOverride = []string{"/app"} },
+		"max layers":     func(cfg *Config) { cfg.MaxLayers = 5 },
+		"deterministic":  func(cfg *Config) { cfg.DeterministicExport = true },
+		"outputs":        func(cfg *Config) { cfg.Outputs = []OutputSpec{{Type: "oci", Dest: "oci/image.tar"}} },
+		"split":          func(cfg *Config) { cfg.SplitByPlatform = true },
+		"gateway image":  func(cfg *Config) { cfg.GatewayImage = "docker/dockerfile:1.4" },
+		"add hosts":      func(cfg *Config) { cfg.AddHosts = "example.com=1.2.3.4" },
+		"attestations":   func(cfg *Config) { cfg.Attestations = []string{"attest:sbom="} },
+		"entitlements":   func(cfg *Config) { cfg.Entitlements = []string{"network.host"} },
+		"image name":     func(cfg *Config) { cfg.ImageName = "example/image:latest" },
+		"output type":    func(cfg *Config) { cfg.OutputType = "oci" },
+		"image platform": func(cfg *Config) { cfg.ImagePlatform = "linux/arm64" },
+	} {
+		original := s.cfg
+		hash := s.hash()
+		s.build(hash)
+
+		change(&s.cfg)
+
+		reused, err := reusePreviousImages(s.cacheDir, s.hash(), s.imagePaths)
+		s.NoError(err)
+		s.False(reused, name)
+
+		s.cfg = original
+	}
+}
+
+func (s *SkipSuite) TestDockerignoredChangeSkips() {
+	s.NoError(ioutil.WriteFile(filepath.Join(s.cfg.ContextDir, ".dockerignore"), []byte(".git\n"), 0644))
+	s.NoError(os.Mkdir(filepath.Join(s.cfg.ContextDir, ".git"), 0755))
+	s.NoError(ioutil.WriteFile(filepath.Join(s.cfg.ContextDir, ".git", "HEAD"), []byte("abc\n"), 0644))
+
+	s.build(s.hash())
+
+	// e.g. a new commit which changes nothing that is sent to buildkit
+	s.NoError(ioutil.WriteFile(filepath.Join(s.cfg.ContextDir, ".git", "HEAD"), []byte("def\n"), 0644))
+
+	reused, err := reusePreviousImages(s.cacheDir, s.hash(), s.imagePaths)
+	s.NoError(err)
+	s.True(reused)
+}
+
+func (s *SkipSuite) TestOutputsWithinContextSkips() {
+	// the default context is the working dir, which holds the outputs
+	s.useOutputsDir(s.cfg.ContextDir)
+
+	s.build(s.hash())
+
+	// the previous build's image and hash are now in the context, as is the
+	// image output it left behind
+	s.FileExists(filepath.Join(s.cacheDir, previousBuildDir, "hash"))
+	s.NoError(ioutil.WriteFile(s.imagePaths[0], []byte("previous image"), 0644))
+
+	reused, err := reusePreviousImages(s.cacheDir, s.hash(), s.imagePaths)
+	s.NoError(err)
+	s.True(reused)
+}
+
+func (s *SkipSuite) TestSkipUnchanged() {
+	hash := s.hash()
+	s.build(hash)
+
+	reused, err := reusePreviousImages(s.cacheDir, s.hash(), s.imagePaths)
+	s.NoError(err)
+	s.True(reused)
+
+	image, err := ioutil.ReadFile(s.imagePaths[0])
+	s.NoError(err)
+	s.Equal("image for "+hash, string(image))
+}
+
+func (s *SkipSuite) TestRebuildChanged() {
+	s.build(s.hash())
+
+	s.NoError(ioutil.WriteFile(filepath.Join(s.cfg.ContextDir, "new-file"), []byte("hello\n"), 0644))
+
+	reused, err := reusePreviousImages(s.cacheDir, s.hash(), s.imagePaths)
+	s.NoError(err)
+	s.False(reused)
+
+	_, err = os.Stat(s.imagePaths[0])
+	s.True(os.IsNotExist(err))
+}
+
+func (s *SkipSuite) TestNoPreviousBuild() {
+	reused, err := reusePreviousImages(s.cacheDir, s.hash(), s.imagePaths)
+	s.NoError(err)
+	s.False(reused)
+}
+
+func (s *SkipSuite) TestPreviousBuildMissingImage() {
+	hash := s.hash()
+	s.build(hash)
+
+	// e.g. an additional target was added
+	imagePaths := append(s.imagePaths, filepath.Join(filepath.Dir(filepath.Dir(s.imagePaths[0])), "other", "image.tar"))
+
+	reused, err := reusePreviousImages(s.cacheDir, hash, imagePaths)
+	s.NoError(err)
+	s.False(reused)
+}
+
+func TestSkip(t *testing.T) {
+	suite.Run(t, &SkipSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,53 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// smokeTestCommand returns the command for running the smoke test command in
+// a throwaway container from the given image. It is run with the image's sh
+// so that pipes, quoting, etc. work as expected.
+func smokeTestCommand(image string, command string) []string {
+	return []string{"docker", "run", "--rm", "--entrypoint", "sh", image, "-c", command}
+}
+
+// smokeTest runs the command in a container from the image tarball at the
+// given path, loading it into the docker daemon first unless it already has
+// been, or warns and does nothing if there is no daemon socket.
+func smokeTest(imagePath string, command string, loaded bool) error {
+	socket, ok := dockerSocket(os.Getenv("DOCKER_HOST"))
+	if !ok {
+		logrus.Warnf("no docker daemon socket at %s; skipping smoke test", socket)
+		return nil
+	}
+
+	if !loaded {
+		err := loadIntoDaemon(imagePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	// docker load keeps the config digest as the image's id
+	digest, err := ioutil.ReadFile(digestPath(imagePath))
+	if err != nil {
+		return errors.Wrap(err, "read image digest")
+	}
+
+	cmd := smokeTestCommand(strings.TrimSpace(string(digest)), command)
+
+	logrus.Info("running smoke test")
+	logrus.Debugf("running %s", strings.Join(cmd, " "))
+
+	err = run(os.Stdout, cmd[0], cmd[1:]...)
+	if err != nil {
+		return errors.Wrap(err, "smoke test failed")
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package task
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type SmokeTestSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *SmokeTestSuite) TestCommand() {
+	s.Equal(
+		[]string{"docker", "run", "--rm", "--entrypoint", "sh", "sha256:abc123", "-c", "my-app --version | grep 1.2.3"},
+		smokeTestCommand("sha256:abc123", "my-app --version | grep 1.2.3"),
+	)
+}
+
+func (s *SmokeTestSuite) TestWithoutSocket() {
+	s.T().Setenv("DOCKER_HOST", "unix://"+filepath.Join(s.T().TempDir(), "missing.sock"))
+
+	s.NoError(smokeTest("/outputs/image/image.tar", "true", false))
+}
+
+func (s *SmokeTestSuite) TestSanitize() {
+	cfg := Config{SmokeTest: "true"}
+	s.NoError(sanitize(&cfg))
+
+	cfg = Config{SmokeTest: "true", OutputType: "oci"}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{SmokeTest: "true", StreamOutput: "/tmp/image.pipe"}
+	s.Error(sanitize(&cfg))
+}
+
+func TestSmokeTest(t *testing.T) {
+	suite.Run(t, &SmokeTestSuite{
+		Assertions: require.New(t),
+	})
+}
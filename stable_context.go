@@ -0,0 +1,42 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// linkContext symlinks the context dir to the given stable path, so that it is
+// passed to buildkit under the same path on every run regardless of where it
+// was checked out. A symlink left at the path by a previous run is replaced.
+func linkContext(stablePath string, contextDir string) error {
+	target, err := filepath.Abs(contextDir)
+	if err != nil {
+		return errors.Wrap(err, "resolve context dir")
+	}
+
+	info, err := os.Lstat(stablePath)
+	if err == nil {
+		if info.Mode()&os.ModeSymlink == 0 {
+			return errors.Errorf("'%s' already exists and is not a symlink", stablePath)
+		}
+
+		err = os.Remove(stablePath)
+		if err != nil {
+			return errors.Wrap(err, "remove stale symlink")
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(stablePath), 0755)
+	if err != nil {
+		return errors.Wrap(err, "create parent dir")
+	}
+
+	logrus.Debugf("linking context %s to %s", target, stablePath)
+
+	return os.Symlink(target, stablePath)
+}
@@ -0,0 +1,84 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type StableContextSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	dir string
+}
+
+func (s *StableContextSuite) SetupTest() {
+	var err error
+	s.dir, err = ioutil.TempDir("", "stable-context")
+	s.NoError(err)
+
+	s.NoError(os.Mkdir(filepath.Join(s.dir, "checkout"), 0755))
+	s.NoError(ioutil.WriteFile(filepath.Join(s.dir, "checkout", "Dockerfile"), []byte("FROM busybox\n"), 0644))
+}
+
+func (s *StableContextSuite) TearDownTest() {
+	s.NoError(os.RemoveAll(s.dir))
+}
+
+func (s *StableContextSuite) TestLink() {
+	stablePath := filepath.Join(s.dir, "stable", "context")
+
+	s.NoError(linkContext(stablePath, filepath.Join(s.dir, "checkout")))
+
+	target, err := os.Readlink(stablePath)
+	s.NoError(err)
+	s.Equal(filepath.Join(s.dir, "checkout"), target)
+
+	_, err = os.Stat(filepath.Join(stablePath, "Dockerfile"))
+	s.NoError(err)
+}
+
+func (s *StableContextSuite) TestReplacesStaleLink() {
+	stablePath := filepath.Join(s.dir, "context")
+	s.NoError(os.Symlink(filepath.Join(s.dir, "previous-checkout"), stablePath))
+
+	s.NoError(linkContext(stablePath, filepath.Join(s.dir, "checkout")))
+
+	target, err := os.Readlink(stablePath)
+	s.NoError(err)
+	s.Equal(filepath.Join(s.dir, "checkout"), target)
+}
+
+func (s *StableContextSuite) TestRefusesToReplaceDir() {
+	stablePath := filepath.Join(s.dir, "context")
+	s.NoError(os.Mkdir(stablePath, 0755))
+
+	err := linkContext(stablePath, filepath.Join(s.dir, "checkout"))
+	s.Error(err)
+	s.Contains(err.Error(), "not a symlink")
+}
+
+func (s *StableContextSuite) TestStablePathPassedToLocal() {
+	cfg := Config{
+		ContextDir:        filepath.Join(s.dir, "checkout"),
+		StableContextPath: "/tmp/context",
+	}
+	s.NoError(sanitize(&cfg))
+
+	// as done by Build once the link is in place
+	cfg.ContextDir = cfg.StableContextPath
+
+	args := commonBuildArgs(cfg)
+	s.Equal("context=/tmp/context", args[indexOf(args, "--local")+1])
+}
+
+func TestStableContext(t *testing.T) {
+	suite.Run(t, &StableContextSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,106 @@
+package task
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// buildctl's plain progress output names each Dockerfile step with its stage,
+// unless there is only the one, and reports how long it took once it's done:
+//
+//	#7 [builder 2/3] RUN go build ./...
+//	#7 DONE 12.3s
+//
+// When building for several platforms, the stage is preceded by the platform,
+// e.g. '[linux/amd64 builder 2/3]', and each platform's steps count towards the
+// same stage.
+//
+// Steps which aren't part of a stage, e.g. '[internal] load metadata', have no
+// step number and are skipped.
+var (
+	stageVertexLine = regexp.MustCompile(`^#(\d+) \[(?:\S+/\S+ )?(?:([^\s/]+) )?\d+/\d+\] `)
+	doneLine        = regexp.MustCompile(`^#(\d+) DONE (\d+(?:\.\d+)?s)$`)
+)
+
+// defaultStage is what steps are attributed to when the Dockerfile has just
+// the one unnamed stage.
+const defaultStage = "default"
+
+// stageTimingCollector is an io.Writer which adds up the time taken by each
+// stage's steps in buildctl output written to it.
+type stageTimingCollector struct {
+	partial []byte
+	stages  map[string]string
+	timings map[string]time.Duration
+
+	// vertex numbers restart with each buildctl invocation
+	build int
+}
+
+func (collector *stageTimingCollector) Write(p []byte) (int, error) {
+	collector.partial = scanLines(collector.partial, p, collector.scan)
+	return len(p), nil
+}
+
+// Next marks the start of another buildctl invocation.
+func (collector *stageTimingCollector) Next() {
+	collector.flush()
+	collector.build++
+}
+
+// Timings returns the time taken by each stage seen, e.g. "builder": "12.3s",
+// summed across buildctl invocations. Cached steps take no time.
+func (collector *stageTimingCollector) Timings() map[string]string {
+	collector.flush()
+
+	if len(collector.timings) == 0 {
+		return nil
+	}
+
+	timings := map[string]string{}
+	for stage, duration := range collector.timings {
+		timings[stage] = duration.String()
+	}
+
+	return timings
+}
+
+func (collector *stageTimingCollector) flush() {
+	if len(collector.partial) > 0 {
+		collector.scan(string(collector.partial))
+		collector.partial = nil
+	}
+}
+
+func (collector *stageTimingCollector) scan(line string) {
+	if collector.stages == nil {
+		collector.stages = map[string]string{}
+		collector.timings = map[string]time.Duration{}
+	}
+
+	if match := stageVertexLine.FindStringSubmatch(line); match != nil {
+		stage := match[2]
+		if stage == "" {
+			stage = defaultStage
+		}
+
+		vertex := fmt.Sprintf("%d/%s", collector.build, match[1])
+		collector.stages[vertex] = stage
+
+		// so that fully cached stages are still listed
+		collector.timings[stage] += 0
+	} else if match := doneLine.FindStringSubmatch(line); match != nil {
+		stage, found := collector.stages[fmt.Sprintf("%d/%s", collector.build, match[1])]
+		if !found {
+			return
+		}
+
+		duration, err := time.ParseDuration(match[2])
+		if err != nil {
+			return
+		}
+
+		collector.timings[stage] += duration
+	}
+}
@@ -0,0 +1,143 @@
+package task
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type StageTimingsSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *StageTimingsSuite) TestMultiStage() {
+	collector := &stageTimingCollector{}
+
+	collector.Next()
+	_, err := fmt.Fprint(collector, `#1 [internal] load build definition from Dockerfile
+#1 transferring dockerfile: 245B done
+#1 DONE 0.1s
+
+#2 [internal] load metadata for docker.io/library/golang:1.18
+#2 DONE 1.5s
+
+#3 [builder 1/3] FROM docker.io/library/golang:1.18
+#3 DONE 4.0s
+
+#4 [builder 2/3] COPY . .
+#4 CACHED
+
+#5 [builder 3/3] RUN go build ./...
+#5 0.512 building...
+#6 [final 1/2] FROM docker.io/library/busybox
+#6 DONE 0.7s
+#5 [builder 3/3] RUN go build ./...
+#5 DONE 12.3s
+
+#7 [final 2/2] COPY --from=builder /app /app
+#7 DONE 0.2s
+
+#8 exporting to docker image format
+#8 DONE 1.0s
+`)
+	s.NoError(err)
+
+	s.Equal(map[string]string{
+		"builder": "16.3s",
+		"final":   "900ms",
+	}, collector.Timings())
+}
+
+func (s *StageTimingsSuite) TestSingleStage() {
+	collector := &stageTimingCollector{}
+
+	collector.Next()
+	_, err := fmt.Fprint(collector, `#2 [1/2] FROM docker.io/library/busybox
+#2 CACHED
+
+#3 [2/2] RUN echo hello
+#3 0.155 hello
+#3 DONE 0.2s`)
+	s.NoError(err)
+
+	s.Equal(map[string]string{"default": "200ms"}, collector.Timings())
+}
+
+func (s *StageTimingsSuite) TestMultiPlatform() {
+	collector := &stageTimingCollector{}
+
+	collector.Next()
+	_, err := fmt.Fprint(collector, `#4 [linux/amd64 builder 1/2] FROM docker.io/library/golang:1.18
+#4 DONE 3.0s
+
+#5 [linux/arm64 builder 1/2] FROM docker.io/library/golang:1.18
+#5 DONE 3.5s
+
+#6 [linux/amd64 builder 2/2] RUN go build ./...
+#6 DONE 10.0s
+
+#7 [linux/arm/v7 builder 2/2] RUN go build ./...
+#7 DONE 20.0s
+
+#8 [linux/amd64 final 1/1] COPY --from=builder /app /app
+#8 DONE 0.5s
+`)
+	s.NoError(err)
+
+	s.Equal(map[string]string{
+		"builder": "36.5s",
+		"final":   "500ms",
+	}, collector.Timings())
+}
+
+func (s *StageTimingsSuite) TestMultiPlatformSingleStage() {
+	collector := &stageTimingCollector{}
+
+	collector.Next()
+	_, err := fmt.Fprint(collector, "#2 [linux/amd64 1/1] RUN make\n#2 DONE 1.0s\n#3 [linux/arm64 1/1] RUN make\n#3 DONE 2.0s\n")
+	s.NoError(err)
+
+	s.Equal(map[string]string{"default": "3s"}, collector.Timings())
+}
+
+func (s *StageTimingsSuite) TestMultipleBuilds() {
+	collector := &stageTimingCollector{}
+
+	collector.Next()
+	_, err := fmt.Fprint(collector, "#1 [base 1/1] RUN make\n#1 DONE 2.0s\n#2 [final 1/1] RUN make install\n#2 DONE 1.0s\n")
+	s.NoError(err)
+
+	// the second invocation reuses vertex numbers, which mustn't be
+	// attributed to the first's stages
+	collector.Next()
+	_, err = fmt.Fprint(collector, "#2 [base 1/1] RUN make\n#2 CACHED\n#1 [final 1/1] RUN make install\n#1 DONE 1.5s\n")
+	s.NoError(err)
+
+	s.Equal(map[string]string{
+		"base":  "2s",
+		"final": "2.5s",
+	}, collector.Timings())
+}
+
+func (s *StageTimingsSuite) TestCachedStage() {
+	collector := &stageTimingCollector{}
+
+	collector.Next()
+	_, err := fmt.Fprint(collector, "#1 [builder 1/1] RUN make\n#1 CACHED\n")
+	s.NoError(err)
+
+	s.Equal(map[string]string{"builder": "0s"}, collector.Timings())
+}
+
+func (s *StageTimingsSuite) TestNoStages() {
+	s.Nil((&stageTimingCollector{}).Timings())
+}
+
+func TestStageTimings(t *testing.T) {
+	suite.Run(t, &StageTimingsSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,144 @@
+package task
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultTagBranchEnv is the env var to take the branch for the tag template
+// from when none is checked out, unless configured otherwise.
+const defaultTagBranchEnv = "BRANCH"
+
+// validTag matches the tags a registry accepts.
+var validTag = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127}$`)
+
+// invalidTagChars matches runs of characters which can't appear in a tag, e.g.
+// the '/' in a branch name like feature/foo.
+var invalidTagChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// tagTemplateData is what a TagTemplate is evaluated against.
+type tagTemplateData struct {
+	// Sha of the context's checked out commit.
+	SHA string
+
+	// First 7 characters of the SHA.
+	ShortSHA string
+
+	// Time the build started, in UTC, e.g. 20060102150405.
+	Timestamp string
+
+	// See Branch.
+	branch string
+
+	// Why the branch is unknown, if it is, e.g. as HEAD is detached.
+	branchErr error
+}
+
+// Branch returns the name of the context's checked out branch, with
+// characters not allowed in tags replaced with '-'. Rendering a template
+// which uses it fails if the branch is unknown.
+func (data tagTemplateData) Branch() (string, error) {
+	if data.branchErr != nil {
+		return "", data.branchErr
+	}
+
+	return data.branch, nil
+}
+
+// parseTagTemplate parses the TagTemplate.
+func parseTagTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("tag").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse tag template")
+	}
+
+	return tmpl, nil
+}
+
+// renderTag evaluates the TagTemplate against the data, failing if the result
+// isn't a valid tag.
+func renderTag(text string, data tagTemplateData) (string, error) {
+	tmpl, err := parseTagTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", errors.Wrap(err, "render tag template")
+	}
+
+	tag := strings.TrimSpace(buf.String())
+	if !validTag.MatchString(tag) {
+		return "", errors.Errorf("tag template rendered invalid tag '%s'", tag)
+	}
+
+	return tag, nil
+}
+
+// contextTagTemplateData returns the tagTemplateData for the context at dir.
+// The git fields are left empty, with a warning, if it isn't a git
+// repository. The branch is taken from the branchEnv env var if none is
+// checked out, e.g. as Concourse checks out a detached HEAD.
+func contextTagTemplateData(dir string, started time.Time, branchEnv string) (tagTemplateData, error) {
+	data := tagTemplateData{
+		Timestamp: started.UTC().Format("20060102150405"),
+	}
+
+	sha, isRepo, err := gitHead(dir)
+	if err != nil {
+		return tagTemplateData{}, errors.Wrap(err, "detect git ref")
+	}
+
+	var branch string
+	if isRepo {
+		branch, _, err = gitBranch(dir)
+		if err != nil {
+			return tagTemplateData{}, errors.Wrap(err, "detect git branch")
+		}
+
+		data.SHA = sha
+		data.ShortSHA = sha
+		if len(sha) > 7 {
+			data.ShortSHA = sha[:7]
+		}
+	} else {
+		logrus.Warn("context is not a git repository; tag template git fields are empty")
+	}
+
+	if branch == "" && branchEnv != "" {
+		branch = os.Getenv(branchEnv)
+	}
+
+	data.branch = strings.Trim(invalidTagChars.ReplaceAllString(branch, "-"), "-.")
+
+	if data.branch == "" {
+		reason := "context is not a git repository"
+		if isRepo {
+			reason = "context's HEAD is detached"
+		}
+
+		data.branchErr = errors.Errorf("branch unknown, as the %s and $%s is not set", reason, branchEnv)
+	}
+
+	return data, nil
+}
+
+// writeTag writes the tag to the tag file.
+func writeTag(tagPath string, tag string) error {
+	err := ioutil.WriteFile(tagPath, []byte(tag), 0644)
+	if err != nil {
+		return errors.Wrap(err, "write tag file")
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package task
+
+import (
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TagTemplateSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+var sampleTagTemplateData = tagTemplateData{
+	SHA:       "0123456789abcdef0123456789abcdef01234567",
+	ShortSHA:  "0123456",
+	Timestamp: "20221014093000",
+	branch:    "feature-foo",
+}
+
+func (s *TagTemplateSuite) TestRender() {
+	tag, err := renderTag("{{.Branch}}-{{.ShortSHA}}", sampleTagTemplateData)
+	s.NoError(err)
+	s.Equal("feature-foo-0123456", tag)
+
+	tag, err = renderTag("v1.{{.Timestamp}}", sampleTagTemplateData)
+	s.NoError(err)
+	s.Equal("v1.20221014093000", tag)
+
+	tag, err = renderTag("{{.SHA}}\n", sampleTagTemplateData)
+	s.NoError(err)
+	s.Equal("0123456789abcdef0123456789abcdef01234567", tag)
+}
+
+func (s *TagTemplateSuite) TestRenderInvalidTag() {
+	_, err := renderTag("{{.Branch}}", tagTemplateData{})
+	s.Error(err)
+	s.Contains(err.Error(), "invalid tag")
+
+	_, err = renderTag("{{.Branch}}:{{.ShortSHA}}", sampleTagTemplateData)
+	s.Error(err)
+}
+
+func (s *TagTemplateSuite) TestRenderUnknownField() {
+	_, err := renderTag("{{.Version}}", sampleTagTemplateData)
+	s.Error(err)
+	s.Contains(err.Error(), "render tag template")
+}
+
+func (s *TagTemplateSuite) TestRenderUnknownBranch() {
+	data := sampleTagTemplateData
+	data.branch = ""
+	data.branchErr = errors.New("branch unknown")
+
+	_, err := renderTag("{{.Branch}}-{{.ShortSHA}}", data)
+	s.Error(err)
+	s.Contains(err.Error(), "branch unknown")
+
+	// only if the template uses it
+	tag, err := renderTag("{{.ShortSHA}}", data)
+	s.NoError(err)
+	s.Equal("0123456", tag)
+}
+
+func (s *TagTemplateSuite) TestSanitize() {
+	cfg := Config{TagTemplate: "{{.Branch"}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "parse tag template")
+
+	cfg = Config{TagTemplate: "{{.Branch}}-{{.ShortSHA}}"}
+	s.NoError(sanitize(&cfg))
+}
+
+func (s *TagTemplateSuite) TestContextData() {
+	if _, err := exec.LookPath("git"); err != nil {
+		s.T().Skip("git not installed")
+	}
+
+	repo := s.T().TempDir()
+	git := func(args ...string) {
+		out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput()
+		s.NoError(err, string(out))
+	}
+
+	git("init", "-q")
+	git("checkout", "-q", "-b", "feature/Foo_bar")
+	s.NoError(ioutil.WriteFile(filepath.Join(repo, "Dockerfile"), []byte("FROM busybox\n"), 0644))
+	git("add", "Dockerfile")
+	git("-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init")
+
+	started := time.Date(2022, 10, 14, 9, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	s.T().Setenv("BRANCH", "main")
+
+	data, err := contextTagTemplateData(repo, started, "BRANCH")
+	s.NoError(err)
+	s.Len(data.SHA, 40)
+	s.Equal(data.SHA[:7], data.ShortSHA)
+	s.Equal("20221014073000", data.Timestamp)
+
+	// the checked out branch wins over the env
+	branch, err := data.Branch()
+	s.NoError(err)
+	s.Equal("feature-Foo_bar", branch)
+}
+
+func (s *TagTemplateSuite) TestContextDataDetachedHead() {
+	if _, err := exec.LookPath("git"); err != nil {
+		s.T().Skip("git not installed")
+	}
+
+	repo := s.T().TempDir()
+	git := func(args ...string) {
+		out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput()
+		s.NoError(err, string(out))
+	}
+
+	git("init", "-q")
+	s.NoError(ioutil.WriteFile(filepath.Join(repo, "Dockerfile"), []byte("FROM busybox\n"), 0644))
+	git("add", "Dockerfile")
+	git("-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init")
+	// as Concourse's git resource checks out
+	git("checkout", "-q", "--detach")
+
+	started := time.Date(2022, 10, 14, 9, 30, 0, 0, time.UTC)
+
+	s.T().Setenv("GIT_BRANCH", "release/1.x")
+
+	data, err := contextTagTemplateData(repo, started, "GIT_BRANCH")
+	s.NoError(err)
+
+	tag, err := renderTag("{{.Branch}}-{{.ShortSHA}}", data)
+	s.NoError(err)
+	s.Equal("release-1.x-"+data.ShortSHA, tag)
+
+	s.T().Setenv("GIT_BRANCH", "")
+
+	data, err = contextTagTemplateData(repo, started, "GIT_BRANCH")
+	s.NoError(err)
+
+	_, err = renderTag("{{.Branch}}-{{.ShortSHA}}", data)
+	s.Error(err)
+	s.Contains(err.Error(), "HEAD is detached and $GIT_BRANCH is not set")
+
+	// templates not using the branch still render
+	tag, err = renderTag("{{.ShortSHA}}", data)
+	s.NoError(err)
+	s.Equal(data.ShortSHA, tag)
+}
+
+func (s *TagTemplateSuite) TestContextDataNotARepo() {
+	s.T().Setenv("BRANCH", "")
+
+	data, err := contextTagTemplateData(s.T().TempDir(), time.Date(2022, 10, 14, 9, 30, 0, 0, time.UTC), "BRANCH")
+	s.NoError(err)
+	s.Equal("20221014093000", data.Timestamp)
+	s.Empty(data.SHA)
+
+	_, err = data.Branch()
+	s.Error(err)
+	s.Contains(err.Error(), "not a git repository")
+
+	s.T().Setenv("BRANCH", "main")
+
+	data, err = contextTagTemplateData(s.T().TempDir(), time.Date(2022, 10, 14, 9, 30, 0, 0, time.UTC), "BRANCH")
+	s.NoError(err)
+
+	branch, err := data.Branch()
+	s.NoError(err)
+	s.Equal("main", branch)
+}
+
+func (s *TagTemplateSuite) TestSanitizeBranchEnv() {
+	cfg := Config{TagTemplate: "{{.Branch}}"}
+	s.NoError(sanitize(&cfg))
+	s.Equal("BRANCH", cfg.TagBranchEnv)
+
+	cfg = Config{TagTemplate: "{{.Branch}}", TagBranchEnv: "GIT_BRANCH"}
+	s.NoError(sanitize(&cfg))
+	s.Equal("GIT_BRANCH", cfg.TagBranchEnv)
+}
+
+func TestTagTemplate(t *testing.T) {
+	suite.Run(t, &TagTemplateSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,161 @@
+package task
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// escapeDirective sets the Dockerfile's escape character, if given in the
+// parser directives at the top of the file:
+//
+//	# escape=`
+var escapeDirective = regexp.MustCompile("(?i)^#\\s*escape\\s*=\\s*([\\\\`])\\s*$")
+
+// dockerfileInstructions returns the Dockerfile's instructions, in order,
+// with continued lines joined and comments dropped.
+func dockerfileInstructions(dockerfile io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(dockerfile)
+
+	escape := `\`
+	directives := true
+
+	instructions := []string{}
+	instruction := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if directives {
+			if match := escapeDirective.FindStringSubmatch(line); match != nil {
+				escape = match[1]
+				continue
+			}
+
+			if !strings.HasPrefix(line, "#") || line == "" {
+				directives = false
+			}
+		}
+
+		// comments may appear between continued lines, and are dropped
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasSuffix(line, escape) {
+			instruction += strings.TrimSuffix(line, escape) + " "
+			continue
+		}
+
+		instruction += line
+
+		if strings.TrimSpace(instruction) != "" {
+			instructions = append(instructions, instruction)
+		}
+
+		instruction = ""
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read dockerfile")
+	}
+
+	if strings.TrimSpace(instruction) != "" {
+		instructions = append(instructions, instruction)
+	}
+
+	return instructions, nil
+}
+
+// dockerfileStages returns the names of the Dockerfile's stages, as named with
+// 'FROM ... AS <name>', in order. Unnamed stages are skipped, since they can't
+// be given as a Target.
+func dockerfileStages(dockerfile io.Reader) ([]string, error) {
+	instructions, err := dockerfileInstructions(dockerfile)
+	if err != nil {
+		return nil, err
+	}
+
+	stages := []string{}
+	for _, instruction := range instructions {
+		if stage, ok := fromStage(instruction); ok {
+			stages = append(stages, stage)
+		}
+	}
+
+	return stages, nil
+}
+
+// fromStage returns the stage name of a 'FROM [--flags] <image> AS <name>'
+// instruction.
+func fromStage(instruction string) (string, bool) {
+	args, ok := fromArgs(instruction)
+	if !ok || len(args) != 3 || !strings.EqualFold(args[1], "AS") {
+		return "", false
+	}
+
+	return args[2], true
+}
+
+// fromArgs returns the arguments of a FROM instruction, without its flags,
+// e.g. [<image> AS <name>].
+func fromArgs(instruction string) ([]string, bool) {
+	fields := strings.Fields(instruction)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "FROM") {
+		return nil, false
+	}
+
+	args := []string{}
+	for _, field := range fields[1:] {
+		if !strings.HasPrefix(field, "--") {
+			args = append(args, field)
+		}
+	}
+
+	return args, true
+}
+
+// listTargets prints the Dockerfile's targets and, if there is a 'targets'
+// output, writes them to targets/targets, one per line. It returns whether the
+// file was written.
+func listTargets(cfg Config, outputsDir string) (bool, error) {
+	dockerfile, err := os.Open(cfg.DockerfilePath)
+	if err != nil {
+		return false, errors.Wrap(err, "open dockerfile")
+	}
+
+	defer dockerfile.Close()
+
+	stages, err := dockerfileStages(dockerfile)
+	if err != nil {
+		return false, err
+	}
+
+	logrus.Infof("targets in %s:", cfg.DockerfilePath)
+	for _, stage := range stages {
+		logrus.Infof("  %s", stage)
+	}
+
+	targetsDir := filepath.Join(outputsDir, "targets")
+	if _, err := os.Stat(targetsDir); err != nil {
+		return false, nil
+	}
+
+	contents := ""
+	for _, stage := range stages {
+		contents += stage + "\n"
+	}
+
+	err = ioutil.WriteFile(filepath.Join(targetsDir, "targets"), []byte(contents), 0644)
+	if err != nil {
+		return false, errors.Wrap(err, "write targets")
+	}
+
+	return true, nil
+}
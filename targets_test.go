@@ -0,0 +1,82 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TargetsSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *TargetsSuite) TestMultiStage() {
+	stages, err := dockerfileStages(strings.NewReader(`# syntax=docker/dockerfile:1
+FROM golang:1.18 AS builder
+RUN go build ./...
+
+# FROM scratch AS commented-out
+from --platform=$BUILDPLATFORM alpine as Tools
+RUN apk add git
+
+FROM builder
+RUN echo unnamed
+
+FROM \
+  # the base image
+  busybox \
+  AS final
+COPY --from=builder /app /app
+`))
+	s.NoError(err)
+	s.Equal([]string{"builder", "Tools", "final"}, stages)
+}
+
+func (s *TargetsSuite) TestEscapeDirective() {
+	stages, err := dockerfileStages(strings.NewReader("# escape=`\nFROM mcr.microsoft.com/windows/servercore `\n  AS windows\nRUN dir C:\\\n"))
+	s.NoError(err)
+	s.Equal([]string{"windows"}, stages)
+}
+
+func (s *TargetsSuite) TestTestdata() {
+	dockerfile, err := os.Open("testdata/multi-target/Dockerfile")
+	s.NoError(err)
+	defer dockerfile.Close()
+
+	stages, err := dockerfileStages(dockerfile)
+	s.NoError(err)
+	s.Equal([]string{"additional-target", "final-target"}, stages)
+}
+
+func (s *TargetsSuite) TestList() {
+	dir := s.T().TempDir()
+
+	dockerfilePath := filepath.Join(dir, "Dockerfile")
+	s.NoError(ioutil.WriteFile(dockerfilePath, []byte("FROM busybox AS a\nFROM busybox AS b\n"), 0644))
+
+	written, err := listTargets(Config{DockerfilePath: dockerfilePath}, dir)
+	s.NoError(err)
+	s.False(written)
+
+	s.NoError(os.Mkdir(filepath.Join(dir, "targets"), 0755))
+
+	written, err = listTargets(Config{DockerfilePath: dockerfilePath}, dir)
+	s.NoError(err)
+	s.True(written)
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "targets", "targets"))
+	s.NoError(err)
+	s.Equal("a\nb\n", string(contents))
+}
+
+func TestTargets(t *testing.T) {
+	suite.Run(t, &TargetsSuite{
+		Assertions: require.New(t),
+	})
+}
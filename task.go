@@ -1,15 +1,21 @@
 package task
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
@@ -37,46 +43,229 @@ func StoreSecret(req *Request, name, value string) error {
 }
 
 func Build(buildkitd *Buildkitd, outputsDir string, req Request) (Response, error) {
+	return BuildContext(context.Background(), buildkitd, outputsDir, req)
+}
+
+// BuildContext is like Build, but stops building once the context is
+// cancelled, e.g. when the task is interrupted.
+func BuildContext(ctx context.Context, buildkitd *Buildkitd, outputsDir string, req Request) (Response, error) {
+	return buildWithWebhook(ctx, req.Config, outputsDir, func() (Response, error) {
+		return buildContext(ctx, buildkitd, outputsDir, req)
+	})
+}
+
+func buildContext(ctx context.Context, buildkitd *Buildkitd, outputsDir string, req Request) (Response, error) {
 	if req.Config.Debug {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 
 	cfg := req.Config
+	if isRemoteContext(cfg.ContextDir) {
+		contextDir, err := fetchContext(cfg.ContextDir, maxRemoteContextSize)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "fetch context")
+		}
+
+		defer os.RemoveAll(contextDir)
+
+		cfg.ContextDir = contextDir
+	}
+
 	err := sanitize(&cfg)
 	if err != nil {
 		return Response{}, errors.Wrap(err, "config")
 	}
 
-	cacheDir := filepath.Join(outputsDir, "cache")
+	if cfg.ListTargets {
+		written, err := listTargets(cfg, outputsDir)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "list targets")
+		}
 
-	res := Response{
-		Outputs: []string{"image", "cache"},
+		outputs := []string{}
+		if written {
+			outputs = append(outputs, "targets")
+		}
+
+		return Response{Outputs: outputs}, nil
 	}
 
-	dockerfileDir := filepath.Dir(cfg.DockerfilePath)
-	dockerfileName := filepath.Base(cfg.DockerfilePath)
+	// a docker config of the build's own, so that builds running concurrently
+	// (see BuildAll) don't use each other's credentials
+	dockerConfigDir, err := ioutil.TempDir("", "docker-config")
+	if err != nil {
+		return Response{}, errors.Wrap(err, "create docker config dir")
+	}
 
-	buildctlArgs := []string{
-		"build",
-		"--progress", "plain",
-		"--frontend", "dockerfile.v0",
-		"--local", "context=" + cfg.ContextDir,
-		"--local", "dockerfile=" + dockerfileDir,
-		"--opt", "filename=" + dockerfileName,
+	defer os.RemoveAll(dockerConfigDir)
+
+	if cfg.SkipIfExists && !cfg.WarmOnly {
+		credsEnv, err := refreshCreds(cfg, dockerConfigDir)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "refresh creds")
+		}
+
+		exists, err := imageExists(ctx, cfg.ImageName, registryKeychain(credsEnv, dockerConfigDir))
+		if err != nil {
+			// a flaky registry shouldn't stop a build that may be needed
+			logrus.Warn("failed to check for existing image; building anyway:", err)
+		} else if exists {
+			logrus.Infof("image '%s' already exists; skipping build", cfg.ImageName)
+			return Response{Outputs: []string{}, Skipped: true}, nil
+		}
 	}
 
-	for _, arg := range cfg.Labels {
-		buildctlArgs = append(buildctlArgs,
-			"--opt", "label:"+arg,
-		)
+	if cfg.MinFreeSpace != "" {
+		err = checkFreeSpace(syscall.Statfs, cfg.MinFreeSpace, outputsDir)
+		if err != nil {
+			return Response{}, err
+		}
 	}
 
-	for _, arg := range cfg.BuildArgs {
-		buildctlArgs = append(buildctlArgs,
-			"--opt", "build-arg:"+arg,
-		)
+	// before injecting files, which would otherwise count as changes
+	if cfg.AutoLabelDirty {
+		dirty, isRepo, err := gitDirty(cfg.ContextDir)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "detect uncommitted changes")
+		}
+
+		if isRepo {
+			cfg.Labels = append(cfg.Labels, dirtyLabelArg(dirty))
+		} else {
+			logrus.Warn("context is not a git repository; not labeling image as dirty")
+		}
+	}
+
+	if cfg.GitRefBuildArg != "" && !hasBuildArg(cfg.BuildArgs, cfg.GitRefBuildArg) {
+		sha, isRepo, err := gitHead(cfg.ContextDir)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "detect git ref")
+		}
+
+		if isRepo {
+			cfg.BuildArgs = append(cfg.BuildArgs, cfg.GitRefBuildArg+"="+sha)
+		} else {
+			logrus.Warnf("context is not a git repository; not setting build arg '%s'", cfg.GitRefBuildArg)
+		}
+	}
+
+	if len(cfg.LabelsFromBuildArgs) > 0 {
+		labels, err := labelsFromBuildArgs(cfg.BuildArgs, cfg.SecretBuildArgs, cfg.LabelsFromBuildArgs)
+		if err != nil {
+			return Response{}, err
+		}
+
+		cfg.Labels = append(cfg.Labels, labels...)
+	}
+
+	var tag string
+	if cfg.TagTemplate != "" {
+		data, err := contextTagTemplateData(cfg.ContextDir, time.Now(), cfg.TagBranchEnv)
+		if err != nil {
+			return Response{}, err
+		}
+
+		tag, err = renderTag(cfg.TagTemplate, data)
+		if err != nil {
+			return Response{}, err
+		}
+
+		logrus.Infof("tag: %s", tag)
+	}
+
+	// before injecting files, which then go to the overlay
+	if cfg.ReadOnlyContext {
+		merged, unmount, err := overlayContext(cfg.ContextDir)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "overlay context")
+		}
+
+		defer func() {
+			err := unmount()
+			if err != nil {
+				logrus.Warn("failed to unmount context overlay:", err)
+			}
+		}()
+
+		// so that a Dockerfile injected in its place is picked up
+		cfg.DockerfilePath, err = overlayPath(cfg.ContextDir, merged, cfg.DockerfilePath)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "overlay context")
+		}
+
+		cfg.ContextDir = merged
+	}
+
+	if len(cfg.InjectFiles) > 0 {
+		restore, err := injectFiles(cfg.ContextDir, cfg.InjectFiles)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "inject files")
+		}
+
+		defer func() {
+			err := restore()
+			if err != nil {
+				logrus.Warn("failed to restore context after injecting files:", err)
+			}
+		}()
 	}
 
+	if cfg.ExpandIncludes {
+		expandedPath, err := writeExpandedDockerfile(cfg.DockerfilePath)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "expand includes")
+		}
+
+		defer os.RemoveAll(filepath.Dir(expandedPath))
+
+		cfg.DockerfilePath = expandedPath
+	}
+
+	if cfg.Lint {
+		err = lintDockerfile(cfg)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "lint")
+		}
+	}
+
+	if cfg.VerifyBaseImages {
+		err = verifyBaseImages(cfg)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "verify base images")
+		}
+	}
+
+	if cfg.StableContextPath != "" {
+		err = linkContext(cfg.StableContextPath, cfg.ContextDir)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "link context")
+		}
+
+		defer os.Remove(cfg.StableContextPath)
+
+		cfg.ContextDir = cfg.StableContextPath
+	}
+
+	// after any files are injected, so that it covers what is actually sent
+	var ctxDigest string
+	if cfg.ReportContextDigest {
+		ctxDigest, err = contextDigest(cfg)
+		if err != nil {
+			logrus.Warn("failed to compute context digest:", err)
+		}
+	}
+
+	if cfg.PrintConfig {
+		err = printConfig(cfg)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "print config")
+		}
+	}
+
+	cacheDir := filepath.Join(outputsDir, "cache")
+
+	buildctlArgs := commonBuildArgs(cfg)
+
 	if len(req.Config.ImageArgs) > 0 {
 		imagePaths := map[string]string{}
 		for _, arg := range req.Config.ImageArgs {
@@ -101,27 +290,19 @@ func Build(buildkitd *Buildkitd, outputsDir string, req Request) (Response, erro
 		}
 	}
 
-	if _, err := os.Stat(cacheDir); err == nil {
-		buildctlArgs = append(buildctlArgs,
-			"--export-cache", "type=local,mode=max,dest="+cacheDir,
-		)
-	}
-
-	for id, src := range cfg.BuildkitSecrets {
+	var cacheExported bool
+	if _, err := os.Stat(cacheDir); err == nil && !cfg.WarmOnly {
+		cacheExported = true
 		buildctlArgs = append(buildctlArgs,
-			"--secret", "id="+id+",src="+src,
+			"--export-cache", exportCacheArg(cfg, cacheDir),
 		)
 	}
 
 	var builds [][]string
 	var targets []string
+	var platforms []string
 	var imagePaths []string
 
-	outputType := "docker"
-	if cfg.OutputOCI {
-		outputType = "oci"
-	}
-
 	for _, t := range cfg.AdditionalTargets {
 		// prevent re-use of the buildctlArgs slice as it is appended to later on,
 		// and that would clobber args for all targets if the slice was re-used
@@ -132,95 +313,513 @@ func Build(buildkitd *Buildkitd, outputsDir string, req Request) (Response, erro
 
 		targetDir := filepath.Join(outputsDir, t)
 
-		if _, err := os.Stat(targetDir); err == nil {
+		// only the final target is stored as an image, since there is just
+		// the one image name
+		if _, err := os.Stat(targetDir); err == nil && cfg.OutputType != "image" && !cfg.WarmOnly {
 			imagePath := filepath.Join(targetDir, "image.tar")
 			imagePaths = append(imagePaths, imagePath)
 
 			targetArgs = append(targetArgs,
-				"--output", "type="+outputType+",dest="+imagePath,
+				"--output", outputArg(cfg, imagePath),
 			)
 		}
 
 		builds = append(builds, targetArgs)
 		targets = append(targets, t)
+		platforms = append(platforms, "")
 	}
 
 	finalTargetDir := filepath.Join(outputsDir, "image")
-	if _, err := os.Stat(finalTargetDir); err == nil {
+	if cfg.WarmOnly {
+		// no outputs; the build is only run to populate buildkit's content
+		// store with the imported cache and base images
+	} else if cfg.OutputType == "image" {
+		// nothing is written to the output; the image goes straight into the
+		// worker's image store
+		buildctlArgs = append(buildctlArgs,
+			"--output", outputArg(cfg, ""),
+		)
+	} else if cfg.SplitByPlatform {
+		// each platform is built and output separately, below
+	} else if cfg.StreamOutput != "" {
+		// streamed to a downstream consumer rather than the image output
+		buildctlArgs = append(buildctlArgs, streamOutputArgs(cfg)...)
+	} else if _, err := os.Stat(finalTargetDir); err == nil {
 		imagePath := filepath.Join(finalTargetDir, "image.tar")
 		imagePaths = append(imagePaths, imagePath)
 
 		buildctlArgs = append(buildctlArgs,
-			"--output", "type="+outputType+",dest="+imagePath,
+			"--output", outputArg(cfg, imagePath),
 		)
 	}
 
+	if !cfg.WarmOnly {
+		outputArgs, err := outputSpecArgs(cfg.Outputs, outputsDir, imagePaths...)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "outputs")
+		}
+
+		buildctlArgs = append(buildctlArgs, outputArgs...)
+	}
+
 	if cfg.Target != "" {
 		buildctlArgs = append(buildctlArgs,
 			"--opt", "target="+cfg.Target,
 		)
 	}
 
-	if cfg.AddHosts != "" {
+	buildctlArgs = append(buildctlArgs, traceArgs(cfg, outputsDir)...)
+
+	if cfg.AddHosts != "" {
+		buildctlArgs = append(buildctlArgs,
+			"--opt", "add-hosts="+cfg.AddHosts,
+		)
+	}
+
+	if cfg.BuildkitSSH != "" {
+		buildctlArgs = append(buildctlArgs,
+			"--ssh", cfg.BuildkitSSH,
+		)
+	}
+
+	if cfg.SplitByPlatform {
+		_, err := os.Stat(finalTargetDir)
+		hasOutput := err == nil && !cfg.WarmOnly
+
+		for _, platform := range splitPlatforms(cfg.ImagePlatform) {
+			platformArgs := make([]string, len(buildctlArgs))
+			copy(platformArgs, buildctlArgs)
+
+			platformArgs = append(platformArgs, "--opt", "platform="+platform)
+
+			if hasOutput {
+				imagePath := platformImagePath(finalTargetDir, platform)
+				imagePaths = append(imagePaths, imagePath)
+
+				platformArgs = append(platformArgs,
+					"--output", outputArg(cfg, imagePath),
+				)
+			}
+
+			builds = append(builds, platformArgs)
+			targets = append(targets, "")
+			platforms = append(platforms, platform)
+		}
+	} else {
+		if req.Config.ImagePlatform != "" {
+			buildctlArgs = append(buildctlArgs,
+				"--opt", "platform="+req.Config.ImagePlatform,
+			)
+		}
+
+		builds = append(builds, buildctlArgs)
+		targets = append(targets, "")
+		platforms = append(platforms, "")
+	}
+
+	var inputs string
+	if cfg.SkipIfUnchanged && !cfg.WarmOnly {
+		if _, err := os.Stat(cacheDir); err != nil {
+			logrus.Warn("skipping unchanged builds requires the cache output")
+		} else {
+			inputs, err = inputsHash(cfg, outputsDir, imagePaths)
+			if err != nil {
+				return Response{}, errors.Wrap(err, "hash inputs")
+			}
+
+			reused, err := reusePreviousImages(cacheDir, inputs, imagePaths)
+			if err != nil {
+				return Response{}, err
+			}
+
+			if reused {
+				logrus.Info("inputs unchanged; reusing previous image")
+				builds = nil
+			}
+		}
+	}
+
+	var command []string
+	warnings := &warningCollector{}
+	cache := &cacheCollector{}
+	stageTimings := &stageTimingCollector{}
+	started := time.Now()
+
+	for i, args := range builds {
+		if i > 0 {
+			fmt.Fprintln(os.Stderr)
+		}
+
+		targetName := targets[i]
+		if cfg.WarmOnly {
+			logrus.Info("warming cache")
+		} else if platforms[i] != "" {
+			logrus.Infof("building image for platform '%s'", platforms[i])
+		} else if targetName == "" {
+			logrus.Info("building image")
+		} else {
+			logrus.Infof("building target '%s'", targetName)
+		}
+
+		if _, err := os.Stat(filepath.Join(cacheDir, "index.json")); err == nil {
+			args = append(args,
+				"--import-cache", "type=local,src="+cacheDir,
+			)
+		}
+
+		credsEnv, err := refreshCreds(cfg, dockerConfigDir)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "refresh creds")
+		}
+
+		withCreds := buildkitd.withEnv(credsEnv)
+
+		command = append([]string{"buildctl"}, redactArgs(cfg, args)...)
+
+		logrus.Debugf("running %s", strings.Join(command, " "))
+
+		cache.Next()
+		stageTimings.Next()
+
+		out := io.MultiWriter(os.Stdout, warnings, cache, stageTimings)
+		if cfg.ContextTransferTimeout > 0 || cfg.ExportTimeout > 0 {
+			err = buildWithTimeouts(ctx, withCreds, cfg, out, args...)
+		} else {
+			err = withCreds.buildctl(ctx, out, args...)
+		}
+		if err != nil {
+			return Response{}, errors.Wrap(err, "build")
+		}
+	}
+
+	buildDuration := time.Since(started)
+
+	if cfg.MaxLayers > 0 && len(builds) > 0 {
+		for _, imagePath := range imagePaths {
+			err = limitLayers(imagePath, cfg.MaxLayers)
+			if err != nil {
+				return Response{}, errors.Wrap(err, "merge layers")
+			}
+		}
+	}
+
+	if (cfg.EntrypointOverride != nil || cfg.CmdOverride != nil) && len(builds) > 0 {
+		for _, imagePath := range imagePaths {
+			// additional targets are separate images
+			if filepath.Dir(imagePath) != finalTargetDir {
+				continue
+			}
+
+			err = overrideImageConfig(imagePath, cfg.EntrypointOverride, cfg.CmdOverride)
+			if err != nil {
+				return Response{}, errors.Wrap(err, "override image config")
+			}
+		}
+	}
+
+	// after anything else rewriting the image tarballs
+	if cfg.DeterministicExport && len(builds) > 0 {
+		for _, imagePath := range imagePaths {
+			err = normalizeImageTarball(imagePath)
+			if err != nil {
+				return Response{}, errors.Wrap(err, "normalize image tarball")
+			}
+		}
+	}
+
+	if inputs != "" && len(builds) > 0 {
+		err = storePreviousImages(cacheDir, inputs, imagePaths)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "store images for next build")
+		}
+	}
+
+	if cfg.PruneAfter != "" {
+		prune(ctx, buildkitd, cfg.PruneAfter)
+	}
+
+	err = checkWarnings(cfg, warnings.Warnings())
+	if err != nil {
+		return Response{}, errors.Wrap(err, "build")
+	}
+
+	if cfg.OutputType == "oci" {
+		err = loadOciImages(imagePaths, req)
+		if err != nil {
+			return Response{}, err
+		}
+	} else {
+		err = loadImages(imagePaths, req)
+		if err != nil {
+			return Response{}, err
+		}
+	}
+
+	if tag != "" && !cfg.WarmOnly {
+		if _, err := os.Stat(finalTargetDir); err == nil {
+			err = writeTag(filepath.Join(finalTargetDir, "tag"), tag)
+			if err != nil {
+				return Response{}, err
+			}
+		}
+	}
+
+	if cfg.MaxImageSize != "" {
+		for _, imagePath := range imagePaths {
+			err = checkImageSize(imagePath, cfg.OutputType, cfg.MaxImageSize)
+			if err != nil {
+				return Response{}, err
+			}
+		}
+	}
+
+	if cfg.LayerReport && cfg.OutputType == "docker" && !cfg.WarmOnly {
+		for _, imagePath := range imagePaths {
+			err = writeLayerReport(imagePath)
+			if err != nil {
+				logrus.Warn("failed to write layer report:", err)
+			}
+		}
+	}
+
+	// the provenance is read from the attestation manifest in the OCI layout
+	// unpacked alongside the image
+	exportedLayout := cfg.OutputType == "oci" && contains(imagePaths, filepath.Join(finalTargetDir, "image.tar"))
+	if wantsProvenance(cfg) && exportedLayout && len(builds) > 0 {
+		layoutDir := filepath.Join(finalTargetDir, "image")
+
+		err = extractProvenance(layoutDir, filepath.Join(finalTargetDir, "provenance.json"))
+		if err != nil {
+			return Response{}, errors.Wrap(err, "extract provenance")
+		}
+
+		if cfg.SLSAProvenanceFile != "" {
+			err = extractSLSAPredicate(layoutDir, slsaProvenancePath(cfg, outputsDir))
+			if err != nil {
+				return Response{}, errors.Wrap(err, "extract SLSA provenance")
+			}
+		}
+	} else if cfg.SLSAProvenanceFile != "" && len(builds) > 0 && !cfg.WarmOnly {
+		return Response{}, errors.New("no provenance was generated to write the SLSA provenance from; it requires the image output")
+	} else if wantsProvenance(cfg) && cfg.OutputType == "docker" && len(builds) > 0 && !cfg.WarmOnly {
+		logrus.Warn("not writing provenance.json, which requires output type 'oci'")
+	}
+
+	if cfg.AttestationsDir != "" && contains(imagePaths, filepath.Join(finalTargetDir, "image.tar")) {
+		logrus.Info("extracting attestations")
+
+		extracted, err := extractAttestations(filepath.Join(finalTargetDir, "image"), attestationsDir(cfg, outputsDir))
+		if err != nil {
+			return Response{}, errors.Wrap(err, "extract attestations")
+		}
+
+		if extracted == 0 && len(cfg.Attestations) > 0 {
+			// buildkit older than v0.11 ignores the attest: opts
+			return Response{}, errors.New("no attestations were exported though some were requested; attestations require buildkit v0.11+")
+		} else if extracted == 0 {
+			logrus.Warn("no attestations to extract; request some with ATTESTATIONS")
+		}
+	}
+
+	if cfg.MetricsFile != "" {
+		err = writeMetrics(cfg.MetricsFile, buildMetrics{
+			Duration:      buildDuration,
+			CacheHitRatio: cache.HitRatio(),
+			ImageSizes:    imageSizes(imagePaths),
+		})
+		if err != nil {
+			return Response{}, errors.Wrap(err, "write metrics")
+		}
+	}
+
+	if cfg.ScanCommand != "" && !cfg.WarmOnly {
+		imagePath := filepath.Join(finalTargetDir, "image.tar")
+		if _, err := os.Stat(imagePath); err != nil {
+			return Response{}, errors.Wrap(err, "scanning requires the image output")
+		}
+
+		err = scanImage(cfg.ScanCommand, imagePath)
+		if err != nil {
+			return Response{}, err
+		}
+	}
+
+	if cfg.FailOnLeakedSecrets && !cfg.WarmOnly {
+		secrets, err := secretValues(cfg)
+		if err != nil {
+			return Response{}, err
+		}
+
+		for _, imagePath := range imagePaths {
+			err = checkSecretLeaks(imagePath, secrets)
+			if err != nil {
+				return Response{}, err
+			}
+		}
+	}
+
+	if cfg.LoadIntoDaemon && !cfg.WarmOnly {
+		imagePath := filepath.Join(finalTargetDir, "image.tar")
+		if _, err := os.Stat(imagePath); err != nil {
+			return Response{}, errors.Wrap(err, "loading into the docker daemon requires the image output")
+		}
+
+		err = loadIntoDaemon(imagePath)
+		if err != nil {
+			return Response{}, err
+		}
+	}
+
+	if cfg.SmokeTest != "" && !cfg.WarmOnly {
+		imagePath := filepath.Join(finalTargetDir, "image.tar")
+		if _, err := os.Stat(imagePath); err != nil {
+			return Response{}, errors.Wrap(err, "smoke testing requires the image output")
+		}
+
+		err = smokeTest(imagePath, cfg.SmokeTest, cfg.LoadIntoDaemon)
+		if err != nil {
+			return Response{}, err
+		}
+	}
+
+	if len(cfg.ExtractFiles) > 0 && !cfg.WarmOnly {
+		imagePath := filepath.Join(finalTargetDir, "image.tar")
+		if _, err := os.Stat(imagePath); err != nil {
+			return Response{}, errors.Wrap(err, "extract files requires the image output")
+		}
+
+		logrus.Info("extracting files")
+
+		err = extractImageFiles(filepath.Join(outputsDir, "files"), imagePath, cfg.ExtractFiles)
+		if err != nil {
+			return Response{}, errors.Wrap(err, "extract files")
+		}
+	}
+
+	var exportedCacheDigest string
+	if cacheExported && len(builds) > 0 {
+		digest, err := cacheDigest(cacheDir)
+		if err != nil {
+			if cfg.SignCache {
+				return Response{}, errors.Wrap(err, "sign cache")
+			}
+
+			logrus.Warn("exported cache may not have been written; failed to read its digest:", err)
+		} else {
+			exportedCacheDigest = digest.String()
+
+			if cfg.SignCache {
+				err = signCache(cacheDir, digest, cfg.CacheSigningKey)
+				if err != nil {
+					return Response{}, err
+				}
+			}
+		}
+	}
+
+	return Response{
+		Outputs:       responseOutputs(cfg, imagePaths, cacheExported),
+		Command:       command,
+		Warnings:      warnings.Warnings(),
+		CacheDigest:   exportedCacheDigest,
+		StageTimings:  stageTimings.Timings(),
+		ContextDigest: ctxDigest,
+	}, nil
+}
+
+// defaultContextName is the name buildkit's frontends expect the local context
+// to have, unless told otherwise.
+const defaultContextName = "context"
+
+// commonBuildArgs returns the buildctl args which are the same for building
+// every target.
+func commonBuildArgs(cfg Config) []string {
+	dockerfileDir := filepath.Dir(cfg.DockerfilePath)
+	dockerfileName := filepath.Base(cfg.DockerfilePath)
+
+	frontend := "dockerfile.v0"
+	if cfg.GatewayImage != "" {
+		frontend = "gateway.v0"
+	}
+
+	buildctlArgs := []string{
+		"build",
+		"--progress", "plain",
+		"--frontend", frontend,
+		"--local", cfg.ContextName + "=" + cfg.ContextDir,
+		"--local", "dockerfile=" + dockerfileDir,
+		"--opt", "filename=" + dockerfileName,
+	}
+
+	if cfg.GatewayImage != "" {
+		buildctlArgs = append(buildctlArgs,
+			"--opt", "source="+cfg.GatewayImage,
+		)
+	}
+
+	if cfg.ContextName != defaultContextName {
+		// tell the frontend where to find the renamed context
+		buildctlArgs = append(buildctlArgs,
+			"--opt", "contextkey="+cfg.ContextName,
+		)
+	}
+
+	for _, arg := range cfg.Labels {
 		buildctlArgs = append(buildctlArgs,
-			"--opt", "add-hosts="+cfg.AddHosts,
+			"--opt", "label:"+arg,
 		)
 	}
 
-	if cfg.BuildkitSSH != "" {
+	for _, arg := range cfg.BuildArgs {
 		buildctlArgs = append(buildctlArgs,
-			"--ssh", cfg.BuildkitSSH,
+			"--opt", "build-arg:"+arg,
 		)
 	}
 
-	if req.Config.ImagePlatform != "" {
+	if cfg.CacheMountNS != "" {
+		// understood by the dockerfile frontend, prefixing the ids of all
+		// cache mounts
 		buildctlArgs = append(buildctlArgs,
-			"--opt", "platform="+req.Config.ImagePlatform,
+			"--opt", "build-arg:BUILDKIT_CACHE_MOUNT_NS="+cfg.CacheMountNS,
 		)
 	}
 
-	builds = append(builds, buildctlArgs)
-	targets = append(targets, "")
+	secretIDs := make([]string, 0, len(cfg.BuildkitSecrets))
+	for id := range cfg.BuildkitSecrets {
+		secretIDs = append(secretIDs, id)
+	}
 
-	for i, args := range builds {
-		if i > 0 {
-			fmt.Fprintln(os.Stderr)
-		}
+	sort.Strings(secretIDs)
 
-		targetName := targets[i]
-		if targetName == "" {
-			logrus.Info("building image")
-		} else {
-			logrus.Infof("building target '%s'", targetName)
-		}
+	for _, id := range secretIDs {
+		buildctlArgs = append(buildctlArgs,
+			"--secret", "id="+id+",src="+cfg.BuildkitSecrets[id],
+		)
+	}
 
-		if _, err := os.Stat(filepath.Join(cacheDir, "index.json")); err == nil {
-			args = append(args,
-				"--import-cache", "type=local,src="+cacheDir,
-			)
-		}
+	envSecretIDs := make([]string, 0, len(cfg.SecretsEnv))
+	for id := range cfg.SecretsEnv {
+		envSecretIDs = append(envSecretIDs, id)
+	}
 
-		logrus.Debugf("running buildctl %s", strings.Join(args, " "))
+	sort.Strings(envSecretIDs)
 
-		err = buildctl(buildkitd.Addr, os.Stdout, args...)
-		if err != nil {
-			return Response{}, errors.Wrap(err, "build")
-		}
+	for _, id := range envSecretIDs {
+		// buildctl reads the value from its own env, so it's never on disk
+		buildctlArgs = append(buildctlArgs,
+			"--secret", "id="+id+",env="+cfg.SecretsEnv[id],
+		)
 	}
 
-	if req.Config.OutputOCI {
-		err = loadOciImages(imagePaths, req)
-		if err != nil {
-			return Response{}, err
-		}
-	} else {
-		err = loadImages(imagePaths, req)
-		if err != nil {
-			return Response{}, err
-		}
+	for _, attestation := range cfg.Attestations {
+		buildctlArgs = append(buildctlArgs,
+			"--opt", attestation,
+		)
 	}
 
-	return res, nil
+	buildctlArgs = append(buildctlArgs, entitlementFlags("--allow", cfg.Entitlements)...)
+
+	return buildctlArgs
 }
 
 func loadImages(imagePaths []string, req Request) error {
@@ -237,11 +836,18 @@ func loadImages(imagePaths []string, req Request) error {
 			return errors.Wrap(err, "get image manifest")
 		}
 
-		err = writeDigest(outputDir, m.Config.Digest)
+		err = writeDigest(digestPath(imagePath), m.Config.Digest)
 		if err != nil {
 			return err
 		}
 
+		if req.Config.TagWithDigest {
+			err = writeDigestTag(digestTagPath(imagePath), m.Config.Digest)
+			if err != nil {
+				return err
+			}
+		}
+
 		if req.Config.UnpackRootfs {
 			err = unpackRootfs(outputDir, image, req.Config)
 			if err != nil {
@@ -282,20 +888,23 @@ func loadOciImages(imagePaths []string, req Request) error {
 
 		manifest := m.Manifests[0]
 
-		outputDir := filepath.Dir(imagePath)
-
-		err = writeDigest(outputDir, manifest.Digest)
+		err = writeDigest(digestPath(imagePath), manifest.Digest)
 		if err != nil {
 			return err
 		}
+
+		if req.Config.TagWithDigest {
+			err = writeDigestTag(digestTagPath(imagePath), manifest.Digest)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-func writeDigest(dest string, digest v1.Hash) error {
-	digestPath := filepath.Join(dest, "digest")
-
+func writeDigest(digestPath string, digest v1.Hash) error {
 	err := ioutil.WriteFile(digestPath, []byte(digest.String()), 0644)
 	if err != nil {
 		return errors.Wrap(err, "write digest file")
@@ -304,6 +913,21 @@ func writeDigest(dest string, digest v1.Hash) error {
 	return nil
 }
 
+// digestTag returns a tag for immutably referring to the image by its digest,
+// e.g. sha256-abc123 for sha256:abc123, since ':' is not allowed in tags.
+func digestTag(digest v1.Hash) string {
+	return digest.Algorithm + "-" + digest.Hex
+}
+
+func writeDigestTag(digestTagPath string, digest v1.Hash) error {
+	err := ioutil.WriteFile(digestTagPath, []byte(digestTag(digest)), 0644)
+	if err != nil {
+		return errors.Wrap(err, "write digest tag file")
+	}
+
+	return nil
+}
+
 func unpackRootfs(dest string, image v1.Image, cfg Config) error {
 	rootfsDir := filepath.Join(dest, "rootfs")
 	metadataPath := filepath.Join(dest, "metadata.json")
@@ -355,8 +979,304 @@ func sanitize(cfg *Config) error {
 		cfg.ContextDir = "."
 	}
 
+	if cfg.ContextName == "" {
+		cfg.ContextName = defaultContextName
+	}
+
 	if cfg.DockerfilePath == "" {
-		cfg.DockerfilePath = filepath.Join(cfg.ContextDir, "Dockerfile")
+		if cfg.GatewayImage != "" {
+			// a custom frontend may not need a Dockerfile at all
+			cfg.DockerfilePath = filepath.Join(cfg.ContextDir, dockerfileNames[0])
+		} else {
+			dockerfilePath, err := findDockerfile(cfg.ContextDir)
+			if err != nil {
+				return err
+			}
+
+			cfg.DockerfilePath = dockerfilePath
+		}
+	}
+
+	if cfg.OutputTypeFile != "" {
+		outputType, err := ioutil.ReadFile(cfg.OutputTypeFile)
+		if err != nil {
+			return errors.Wrap(err, "read output type file")
+		}
+
+		cfg.OutputType = strings.TrimSpace(string(outputType))
+	}
+
+	if cfg.OutputType == "" {
+		cfg.OutputType = "docker"
+		if cfg.OutputOCI {
+			cfg.OutputType = "oci"
+		}
+	}
+
+	switch cfg.OutputType {
+	case "docker", "oci":
+	case "image":
+		if cfg.ImageName == "" {
+			return errors.New("image name must be set for output type 'image'")
+		}
+
+		imageName, err := normalizeImageName(cfg.ImageName)
+		if err != nil {
+			return err
+		}
+
+		cfg.ImageName = imageName
+
+		if cfg.LatestTag {
+			_, err := name.NewTag(cfg.ImageName)
+			if err != nil {
+				return errors.Wrap(err, "image name")
+			}
+		}
+	default:
+		return errors.Errorf("unknown output type '%s'", cfg.OutputType)
+	}
+
+	if cfg.SkipIfExists {
+		if cfg.ImageName == "" {
+			return errors.New("skipping existing images requires an image name")
+		}
+
+		imageName, err := normalizeImageName(cfg.ImageName)
+		if err != nil {
+			return err
+		}
+
+		cfg.ImageName = imageName
+	}
+
+	if cfg.LatestTag && cfg.OutputType != "image" {
+		return errors.Errorf("tagging as latest is not supported for output type '%s'", cfg.OutputType)
+	}
+
+	if cfg.MinFreeSpace != "" {
+		_, err := parseSize(cfg.MinFreeSpace)
+		if err != nil {
+			return errors.Wrap(err, "min free space")
+		}
+	}
+
+	if cfg.MaxImageSize != "" {
+		_, err := parseSize(cfg.MaxImageSize)
+		if err != nil {
+			return errors.Wrap(err, "max image size")
+		}
+
+		if cfg.OutputType == "image" || cfg.StreamOutput != "" {
+			return errors.New("checking the image size requires the image output")
+		}
+	}
+
+	if cfg.PruneAfter != "" {
+		_, err := pruneArgs(cfg.PruneAfter)
+		if err != nil {
+			return errors.Wrap(err, "prune after")
+		}
+	}
+
+	switch cfg.CacheCompression {
+	case "", "gzip", "zstd":
+	default:
+		return errors.Errorf("unknown cache compression '%s'", cfg.CacheCompression)
+	}
+
+	err := validateCacheCompressionLevel(cfg.CacheCompression, cfg.CacheCompressionLevel)
+	if err != nil {
+		return err
+	}
+
+	if cfg.SkipIfUnchanged && cfg.OutputType == "image" {
+		return errors.New("skipping unchanged builds is not supported for output type 'image'")
+	}
+
+	if cfg.ScanCommand != "" && cfg.OutputType == "image" {
+		return errors.New("scanning is not supported for output type 'image'")
+	}
+
+	for _, platform := range splitPlatforms(cfg.ImagePlatform) {
+		err := validatePlatform(platform)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.SplitByPlatform {
+		if cfg.ImagePlatform == "" {
+			return errors.New("splitting by platform requires image platforms to be set")
+		}
+
+		if cfg.OutputType != "docker" {
+			return errors.Errorf("splitting by platform is not supported for output type '%s'", cfg.OutputType)
+		}
+
+		if cfg.UnpackRootfs || len(cfg.Outputs) > 0 || cfg.ScanCommand != "" || len(cfg.ExtractFiles) > 0 || cfg.LoadIntoDaemon {
+			return errors.New("splitting by platform is not supported with unpacking the rootfs, additional outputs, scanning, extracting files, or loading into the docker daemon")
+		}
+	}
+
+	if cfg.StreamOutput != "" {
+		if cfg.StreamOutput == "-" {
+			// buildctl's stdout is the build log
+			return errors.New("streaming the image to stdout is not supported; give the path of a named pipe")
+		}
+
+		if cfg.OutputType == "image" {
+			return errors.New("streaming the image is not supported for output type 'image'")
+		}
+
+		if cfg.SplitByPlatform || cfg.UnpackRootfs || cfg.ScanCommand != "" || len(cfg.ExtractFiles) > 0 ||
+			cfg.LoadIntoDaemon || cfg.FailOnLeakedSecrets || cfg.SkipIfUnchanged || cfg.AttestationsDir != "" {
+			return errors.New("streaming the image is not supported with splitting by platform, unpacking the rootfs, scanning, extracting files, loading into the docker daemon, checking for leaked secrets, skipping unchanged builds, or extracting attestations")
+		}
+	}
+
+	if cfg.FailOnLeakedSecrets && cfg.OutputType != "docker" {
+		return errors.Errorf("checking for leaked secrets is not supported for output type '%s'", cfg.OutputType)
+	}
+
+	if cfg.LoadIntoDaemon && cfg.OutputType != "docker" {
+		return errors.Errorf("loading into the docker daemon is not supported for output type '%s'", cfg.OutputType)
+	}
+
+	if cfg.SmokeTest != "" && (cfg.OutputType != "docker" || cfg.SplitByPlatform || cfg.StreamOutput != "") {
+		return errors.New("smoke testing requires the image output with output type 'docker'")
+	}
+
+	if cfg.TagTemplate != "" {
+		_, err := parseTagTemplate(cfg.TagTemplate)
+		if err != nil {
+			return err
+		}
+
+		if cfg.TagBranchEnv == "" {
+			cfg.TagBranchEnv = defaultTagBranchEnv
+		}
+	}
+
+	err = validateTerminalWidth(cfg.TerminalWidth)
+	if err != nil {
+		return err
+	}
+
+	if cfg.MaxLayers < 0 {
+		return errors.Errorf("max layers must be at least 1, not %d", cfg.MaxLayers)
+	}
+
+	if cfg.MaxLayers > 0 && (cfg.OutputType != "docker" || cfg.StreamOutput != "") {
+		return errors.New("limiting the number of layers requires the image output with output type 'docker'")
+	}
+
+	if cfg.DeterministicExport && (cfg.OutputType == "image" || cfg.StreamOutput != "") {
+		return errors.New("deterministic exports require the image output")
+	}
+
+	err = validateResponseFormat(cfg.ResponseFormat)
+	if err != nil {
+		return err
+	}
+
+	if cfg.WebhookURL != "" {
+		webhookURL, err := url.Parse(cfg.WebhookURL)
+		if err != nil {
+			return errors.Wrap(withoutURL(err), "webhook url")
+		}
+
+		if webhookURL.Scheme != "http" && webhookURL.Scheme != "https" {
+			return errors.Errorf("webhook url must be http or https, not '%s'", webhookURL.Scheme)
+		}
+	}
+
+	if cfg.Lint {
+		if cfg.HadolintPath == "" {
+			cfg.HadolintPath = defaultHadolintPath
+		}
+
+		if cfg.LintSeverity == "" {
+			cfg.LintSeverity = defaultLintSeverity
+		}
+
+		err := validateLintSeverity(cfg.LintSeverity)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.SignCache && cfg.CacheSigningKey == "" {
+		return errors.New("signing the cache requires a cache signing key")
+	}
+
+	if cfg.SignCache && cfg.WarmOnly {
+		return errors.New("signing the cache is not supported with warm-only, which doesn't export it")
+	}
+
+	if cfg.VerifyBaseImages && cfg.CosignKey == "" {
+		return errors.New("verifying base images requires a cosign key")
+	}
+
+	if cfg.VerifyBaseImages && cfg.GatewayImage != "" {
+		return errors.New("verifying base images is not supported with a gateway image")
+	}
+
+	if (cfg.EntrypointOverride != nil || cfg.CmdOverride != nil) && (cfg.OutputType != "docker" || cfg.StreamOutput != "") {
+		return errors.New("overriding the entrypoint or cmd requires the image output with output type 'docker'")
+	}
+
+	if len(cfg.ExtractFiles) > 0 && cfg.OutputType != "docker" {
+		return errors.Errorf("extracting files is not supported for output type '%s'", cfg.OutputType)
+	}
+
+	for id, env := range cfg.SecretsEnv {
+		if _, found := cfg.BuildkitSecrets[id]; found {
+			return errors.Errorf("secret '%s' is given both as a file and an env var", id)
+		}
+
+		if os.Getenv(env) == "" {
+			return errors.Errorf("env var '%s' for secret '%s' is not set", env, id)
+		}
+	}
+
+	if cfg.AttestationsDir != "" && cfg.OutputType != "oci" {
+		return errors.Errorf("extracting attestations is not supported for output type '%s'", cfg.OutputType)
+	}
+
+	if cfg.ForceRoot && cfg.ForceRootless {
+		return errors.New("buildkitd cannot be forced to run both as root and rootless")
+	}
+
+	if cfg.ForceRoot && (cfg.RootlessUID != 0 || cfg.RootlessGID != 0) {
+		return errors.New("forcing buildkitd to run as root is not supported with a rootless user")
+	}
+
+	if cfg.SLSAProvenanceFile != "" {
+		if !wantsProvenance(*cfg) {
+			return errors.New("writing the SLSA provenance requires a provenance attestation to be requested")
+		}
+
+		if cfg.SplitByPlatform {
+			return errors.New("writing the SLSA provenance is not supported with splitting by platform")
+		}
+
+		if cfg.OutputType != "oci" {
+			return errors.Errorf("writing the SLSA provenance is not supported for output type '%s'", cfg.OutputType)
+		}
+	}
+
+	if cfg.GatewayImage != "" {
+		_, err := name.ParseReference(cfg.GatewayImage)
+		if err != nil {
+			return errors.Wrap(err, "gateway image")
+		}
+	}
+
+	for _, attestation := range cfg.Attestations {
+		if !strings.HasPrefix(attestation, "attest:") {
+			return errors.Errorf("attestation '%s' must be of the form attest:<type>=<params>", attestation)
+		}
 	}
 
 	if cfg.TargetFile != "" {
@@ -400,15 +1320,102 @@ func sanitize(cfg *Config) error {
 		}
 	}
 
+	if len(cfg.AllowedBuildArgs) > 0 {
+		cfg.BuildArgs = allowedBuildArgs(cfg.BuildArgs, cfg.AllowedBuildArgs)
+	}
+
+	if cfg.PackageProxy != "" {
+		err = addPackageProxy(cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	// after filtering the allowed build args, so that it isn't dropped
+	if cfg.DeterministicExport && !hasBuildArg(cfg.BuildArgs, sourceDateEpochArg) {
+		cfg.BuildArgs = append(cfg.BuildArgs, sourceDateEpochArg+"=0")
+	}
+
+	validateEntitlements(cfg.Entitlements)
+
 	return nil
 }
 
+// hasBuildArg returns whether the key=value build args include the given key.
+func hasBuildArg(buildArgs []string, key string) bool {
+	for _, arg := range buildArgs {
+		if strings.SplitN(arg, "=", 2)[0] == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowedBuildArgs returns the key=value build args whose keys are allowed,
+// warning about any others.
+func allowedBuildArgs(buildArgs []string, allowed []string) []string {
+	kept := []string{}
+	for _, arg := range buildArgs {
+		key := strings.SplitN(arg, "=", 2)[0]
+		if !contains(allowed, key) {
+			logrus.Warnf("dropping build arg '%s', which is not allowed", key)
+			continue
+		}
+
+		kept = append(kept, arg)
+	}
+
+	return kept
+}
+
+// dockerfileNames are the names looked for in the context when no Dockerfile
+// is given, in order of preference. Containerfile is the name used by Podman.
+var dockerfileNames = []string{"Dockerfile", "dockerfile", "Containerfile"}
+
+// findDockerfile returns the path of the first of the dockerfileNames found in
+// the context dir.
+func findDockerfile(contextDir string) (string, error) {
+	for _, name := range dockerfileNames {
+		path := filepath.Join(contextDir, name)
+
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+
+	return "", errors.Errorf("no %s found in context '%s'", strings.Join(dockerfileNames, ", "), contextDir)
+}
+
 func buildctl(addr string, out io.Writer, args ...string) error {
-	return run(out, "buildctl", append([]string{"--addr=" + addr}, args...)...)
+	return buildctlContext(context.Background(), addr, nil, out, args...)
+}
+
+func buildctlContext(ctx context.Context, addr string, env []string, out io.Writer, args ...string) error {
+	return runEnvContext(ctx, out, env, "buildctl", append([]string{"--addr=" + addr}, args...)...)
 }
 
 func run(out io.Writer, path string, args ...string) error {
-	cmd := exec.Command(path, args...)
+	return runContext(context.Background(), out, path, args...)
+}
+
+func runContext(ctx context.Context, out io.Writer, path string, args ...string) error {
+	return runEnvContext(ctx, out, nil, path, args...)
+}
+
+// runEnvContext runs the command with the given env on top of the process's
+// own.
+func runEnvContext(ctx context.Context, out io.Writer, env []string, path string, args ...string) error {
+	cmd := exec.CommandContext(ctx, path, args...)
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	// give the process a chance to stop cleanly rather than killing it
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
 	cmd.Stdout = out
 	cmd.Stderr = out
 	cmd.Stdin = os.Stdin
@@ -0,0 +1,283 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type BuildArgsSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *BuildArgsSuite) TestCommonBuildArgs() {
+	args := commonBuildArgs(Config{
+		ContextDir:     "some-context",
+		DockerfilePath: "some-context/build/Dockerfile",
+		Labels:         []string{"some_label=some_value"},
+		BuildArgs:      []string{"some_arg=some_value"},
+		BuildkitSecrets: map[string]string{
+			"second": "/secrets/second",
+			"first":  "/secrets/first",
+		},
+		ContextName:  "context",
+		Entitlements: []string{"network.host"},
+	})
+
+	s.Equal([]string{
+		"build",
+		"--progress", "plain",
+		"--frontend", "dockerfile.v0",
+		"--local", "context=some-context",
+		"--local", "dockerfile=some-context/build",
+		"--opt", "filename=Dockerfile",
+		"--opt", "label:some_label=some_value",
+		"--opt", "build-arg:some_arg=some_value",
+		"--secret", "id=first,src=/secrets/first",
+		"--secret", "id=second,src=/secrets/second",
+		"--allow", "network.host",
+	}, args)
+}
+
+func (s *BuildArgsSuite) TestCacheMountNS() {
+	args := commonBuildArgs(Config{
+		ContextDir:     ".",
+		DockerfilePath: "Dockerfile",
+		CacheMountNS:   "my-project",
+	})
+
+	s.Subset(args, []string{"build-arg:BUILDKIT_CACHE_MOUNT_NS=my-project"})
+	s.Equal("--opt", args[indexOf(args, "build-arg:BUILDKIT_CACHE_MOUNT_NS=my-project")-1])
+}
+
+func (s *BuildArgsSuite) TestNoCacheMountNS() {
+	args := commonBuildArgs(Config{
+		ContextDir:     ".",
+		DockerfilePath: "Dockerfile",
+	})
+
+	for _, arg := range args {
+		s.NotContains(arg, "BUILDKIT_CACHE_MOUNT_NS")
+	}
+}
+
+func (s *BuildArgsSuite) TestAttestations() {
+	args := commonBuildArgs(Config{
+		ContextDir:     ".",
+		DockerfilePath: "Dockerfile",
+		Attestations: []string{
+			"attest:sbom=generator=docker/buildkit-syft-scanner",
+			"attest:provenance=mode=max,builder-id=ci",
+		},
+	})
+
+	i := indexOf(args, "attest:sbom=generator=docker/buildkit-syft-scanner")
+	s.NotEqual(-1, i)
+	s.Equal([]string{
+		"--opt", "attest:sbom=generator=docker/buildkit-syft-scanner",
+		"--opt", "attest:provenance=mode=max,builder-id=ci",
+	}, args[i-1:i+3])
+}
+
+func (s *BuildArgsSuite) TestInvalidAttestation() {
+	cfg := Config{Attestations: []string{"sbom=generator=some/scanner"}}
+	s.Error(sanitize(&cfg))
+}
+
+func (s *BuildArgsSuite) TestContextName() {
+	args := commonBuildArgs(Config{
+		ContextDir:     "some-context",
+		DockerfilePath: "some-context/Dockerfile",
+		ContextName:    "src",
+	})
+
+	s.Equal([]string{
+		"build",
+		"--progress", "plain",
+		"--frontend", "dockerfile.v0",
+		"--local", "src=some-context",
+		"--local", "dockerfile=some-context",
+		"--opt", "filename=Dockerfile",
+		"--opt", "contextkey=src",
+	}, args)
+}
+
+func (s *BuildArgsSuite) TestDefaultContextName() {
+	cfg := Config{}
+	s.NoError(sanitize(&cfg))
+	s.Equal("context", cfg.ContextName)
+
+	args := commonBuildArgs(cfg)
+	s.Subset(args, []string{"context=."})
+	for _, arg := range args {
+		s.NotContains(arg, "contextkey")
+	}
+}
+
+func (s *BuildArgsSuite) TestGatewayImage() {
+	args := commonBuildArgs(Config{
+		ContextDir:     ".",
+		DockerfilePath: "Dockerfile",
+		ContextName:    "context",
+		GatewayImage:   "docker/dockerfile:1-labs",
+	})
+
+	s.Equal([]string{
+		"build",
+		"--progress", "plain",
+		"--frontend", "gateway.v0",
+		"--local", "context=.",
+		"--local", "dockerfile=.",
+		"--opt", "filename=Dockerfile",
+		"--opt", "source=docker/dockerfile:1-labs",
+	}, args)
+}
+
+func (s *BuildArgsSuite) TestInvalidGatewayImage() {
+	cfg := Config{GatewayImage: "not a valid:ref"}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{GatewayImage: "docker/dockerfile:1-labs"}
+	s.NoError(sanitize(&cfg))
+}
+
+func (s *BuildArgsSuite) TestDockerfileDiscovery() {
+	dir := s.T().TempDir()
+
+	cfg := Config{ContextDir: dir}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "no Dockerfile, dockerfile, Containerfile found")
+
+	// a directory is not mistaken for the Dockerfile
+	s.NoError(os.Mkdir(filepath.Join(dir, "dockerfile"), 0755))
+
+	s.NoError(ioutil.WriteFile(filepath.Join(dir, "Containerfile"), []byte("FROM busybox\n"), 0644))
+	cfg = Config{ContextDir: dir}
+	s.NoError(sanitize(&cfg))
+	s.Equal(filepath.Join(dir, "Containerfile"), cfg.DockerfilePath)
+
+	s.NoError(ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM busybox\n"), 0644))
+	cfg = Config{ContextDir: dir}
+	s.NoError(sanitize(&cfg))
+	s.Equal(filepath.Join(dir, "Dockerfile"), cfg.DockerfilePath)
+
+	// an explicit Dockerfile is left alone
+	cfg = Config{ContextDir: dir, DockerfilePath: "some/Dockerfile"}
+	s.NoError(sanitize(&cfg))
+	s.Equal("some/Dockerfile", cfg.DockerfilePath)
+}
+
+func (s *BuildArgsSuite) TestDockerfileDiscoveryLowercase() {
+	dir := s.T().TempDir()
+
+	s.NoError(ioutil.WriteFile(filepath.Join(dir, "dockerfile"), []byte("FROM busybox\n"), 0644))
+	s.NoError(ioutil.WriteFile(filepath.Join(dir, "Containerfile"), []byte("FROM busybox\n"), 0644))
+
+	cfg := Config{ContextDir: dir}
+	s.NoError(sanitize(&cfg))
+	s.Equal(filepath.Join(dir, "dockerfile"), cfg.DockerfilePath)
+}
+
+func (s *BuildArgsSuite) TestDockerfileDiscoveryGateway() {
+	cfg := Config{ContextDir: s.T().TempDir(), GatewayImage: "docker/dockerfile:1-labs"}
+	s.NoError(sanitize(&cfg))
+	s.Equal(filepath.Join(cfg.ContextDir, "Dockerfile"), cfg.DockerfilePath)
+}
+
+func (s *BuildArgsSuite) TestAllowedBuildArgs() {
+	cfg := Config{
+		BuildArgs:        []string{"VERSION=1.2.3", "UNRELATED=oops", "COMMIT=abc123", "VERSION_SUFFIX=-rc"},
+		AllowedBuildArgs: []string{"VERSION", "COMMIT"},
+	}
+	s.NoError(sanitize(&cfg))
+	s.Equal([]string{"VERSION=1.2.3", "COMMIT=abc123"}, cfg.BuildArgs)
+
+	args := commonBuildArgs(cfg)
+	s.Contains(args, "build-arg:VERSION=1.2.3")
+	s.NotContains(args, "build-arg:UNRELATED=oops")
+}
+
+func (s *BuildArgsSuite) TestAllowedBuildArgsFile() {
+	buildArgsFile := filepath.Join(s.T().TempDir(), "build-args")
+	s.NoError(ioutil.WriteFile(buildArgsFile, []byte("VERSION=1.2.3\nUNRELATED=oops\n"), 0644))
+
+	cfg := Config{
+		BuildArgsFile:    buildArgsFile,
+		AllowedBuildArgs: []string{"VERSION"},
+	}
+	s.NoError(sanitize(&cfg))
+	s.Equal([]string{"VERSION=1.2.3"}, cfg.BuildArgs)
+}
+
+func (s *BuildArgsSuite) TestNoAllowedBuildArgs() {
+	cfg := Config{BuildArgs: []string{"VERSION=1.2.3", "UNRELATED=oops"}}
+	s.NoError(sanitize(&cfg))
+	s.Equal([]string{"VERSION=1.2.3", "UNRELATED=oops"}, cfg.BuildArgs)
+}
+
+func (s *BuildArgsSuite) TestSecretsEnv() {
+	args := commonBuildArgs(Config{
+		ContextDir:     ".",
+		DockerfilePath: "Dockerfile",
+		ContextName:    "context",
+		BuildkitSecrets: map[string]string{
+			"config": "/secrets/config",
+		},
+		SecretsEnv: map[string]string{
+			"token": "GITHUB_TOKEN",
+			"npmrc": "NPMRC",
+		},
+	})
+
+	s.Equal([]string{
+		"--secret", "id=config,src=/secrets/config",
+		"--secret", "id=npmrc,env=NPMRC",
+		"--secret", "id=token,env=GITHUB_TOKEN",
+	}, args[len(args)-6:])
+}
+
+func (s *BuildArgsSuite) TestSecretsEnvSanitize() {
+	s.T().Setenv("SOME_TOKEN", "hunter2")
+	s.T().Setenv("EMPTY_TOKEN", "")
+
+	cfg := Config{SecretsEnv: map[string]string{"token": "SOME_TOKEN"}}
+	s.NoError(sanitize(&cfg))
+
+	cfg = Config{SecretsEnv: map[string]string{"token": "EMPTY_TOKEN"}}
+	err := sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "env var 'EMPTY_TOKEN' for secret 'token' is not set")
+
+	cfg = Config{SecretsEnv: map[string]string{"token": "MISSING_TOKEN_FOR_TEST"}}
+	s.Error(sanitize(&cfg))
+
+	cfg = Config{
+		BuildkitSecrets: map[string]string{"token": "/secrets/token"},
+		SecretsEnv:      map[string]string{"token": "SOME_TOKEN"},
+	}
+	err = sanitize(&cfg)
+	s.Error(err)
+	s.Contains(err.Error(), "both")
+}
+
+func indexOf(list []string, str string) int {
+	for i, s := range list {
+		if s == str {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func TestBuildArgs(t *testing.T) {
+	suite.Run(t, &BuildArgsSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -1,12 +1,14 @@
 package task_test
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
 	"testing"
@@ -99,6 +101,55 @@ func (s *TaskSuite) TestDigestFile() {
 	s.Equal(string(digest), manifest.Config.Digest.String())
 }
 
+func (s *TaskSuite) TestDeterministicExport() {
+	s.req.Config.ContextDir = "testdata/deterministic"
+	s.req.Config.DeterministicExport = true
+
+	_, err := s.build()
+	s.NoError(err)
+
+	first, err := ioutil.ReadFile(s.imagePath("image.tar"))
+	s.NoError(err)
+
+	firstDigest := sha256.Sum256(first)
+
+	// so that the RUN is not cached, and writes its file at a later time
+	err = exec.Command("buildctl", "--addr", s.buildkitd.Addr, "prune", "--all").Run()
+	s.NoError(err)
+
+	err = os.Remove(s.imagePath("image.tar"))
+	s.NoError(err)
+
+	_, err = s.build()
+	s.NoError(err)
+
+	second, err := ioutil.ReadFile(s.imagePath("image.tar"))
+	s.NoError(err)
+
+	s.Equal(firstDigest, sha256.Sum256(second))
+}
+
+func (s *TaskSuite) TestProvenance() {
+	s.req.Config.ContextDir = "testdata/basic"
+	s.req.Config.OutputType = "oci"
+	s.req.Config.Attestations = []string{"attest:provenance=mode=min"}
+	s.req.Config.SLSAProvenanceFile = "image/slsa.json"
+
+	_, err := s.build()
+	s.NoError(err)
+
+	payload, err := ioutil.ReadFile(s.imagePath("provenance.json"))
+	s.NoError(err)
+
+	var statement struct {
+		PredicateType string `json:"predicateType"`
+	}
+	s.NoError(json.Unmarshal(payload, &statement))
+	s.Contains(statement.PredicateType, "https://slsa.dev/provenance/")
+
+	s.FileExists(s.imagePath("slsa.json"))
+}
+
 func (s *TaskSuite) TestDockerfilePath() {
 	s.req.Config.ContextDir = "testdata/dockerfile-path"
 	s.req.Config.DockerfilePath = "testdata/dockerfile-path/hello.Dockerfile"
@@ -206,6 +257,37 @@ func (s *TaskSuite) TestLabelsFile() {
 	s.True(reflect.DeepEqual(expectedLabels, configFile.Config.Labels))
 }
 
+func (s *TaskSuite) TestLabelsFromBuildArgs() {
+	s.req.Config.ContextDir = "testdata/labels"
+	s.req.Config.BuildArgs = []string{"VERSION=1.2.3", "VCS_REF=abc123"}
+	s.req.Config.Labels = []string{"some_label=some_value"}
+	s.req.Config.LabelsFromBuildArgs = []string{"VERSION", "VCS_REF=org.opencontainers.image.revision"}
+
+	_, err := s.build()
+	s.NoError(err)
+
+	image, err := tarball.ImageFromPath(s.imagePath("image.tar"), nil)
+	s.NoError(err)
+
+	configFile, err := image.ConfigFile()
+	s.NoError(err)
+
+	s.Equal(map[string]string{
+		"some_label":                        "some_value",
+		"VERSION":                           "1.2.3",
+		"org.opencontainers.image.revision": "abc123",
+	}, configFile.Config.Labels)
+}
+
+func (s *TaskSuite) TestLabelsFromBuildArgsNotSet() {
+	s.req.Config.ContextDir = "testdata/labels"
+	s.req.Config.LabelsFromBuildArgs = []string{"VERSION"}
+
+	_, err := s.build()
+	s.Error(err)
+	s.Contains(err.Error(), "VERSION")
+}
+
 func (s *TaskSuite) TestLabelsStaticAndFileAndLayer() {
 	s.req.Config.ContextDir = "testdata/labels"
 	s.req.Config.DockerfilePath = "testdata/labels/label_layer.dockerfile"
@@ -285,7 +367,7 @@ func (s *TaskSuite) TestRegistryMirrors() {
 	s.NoError(err)
 
 	s.req.Config.ContextDir = "testdata/mirror"
-	s.req.Config.RegistryMirrors = []string{mirrorURL.Host}
+	s.req.Config.RegistryMirrors = []task.MirrorSpec{{Host: mirrorURL.Host}}
 
 	rootDir, err := ioutil.TempDir("", "mirrored-buildkitd")
 	s.NoError(err)
@@ -595,6 +677,34 @@ func (s *TaskSuite) TestImagePlatform() {
 	s.Equal("arm64", configFile.Architecture)
 }
 
+func (s *TaskSuite) TestImagePlatformVariant() {
+	s.req.Config.ContextDir = "testdata/basic"
+	s.req.Config.ImagePlatform = "linux/arm/v7"
+
+	res, err := s.build()
+	s.NoError(err)
+	s.Contains(res.Command, "platform=linux/arm/v7")
+
+	image, err := tarball.ImageFromPath(s.imagePath("image.tar"), nil)
+	s.NoError(err)
+
+	configFile, err := image.ConfigFile()
+	s.NoError(err)
+
+	s.Equal("linux", configFile.OS)
+	s.Equal("arm", configFile.Architecture)
+	s.Equal("v7", configFile.Variant)
+}
+
+func (s *TaskSuite) TestImagePlatformInvalidVariant() {
+	s.req.Config.ContextDir = "testdata/basic"
+	s.req.Config.ImagePlatform = "linux/arm64/v7"
+
+	_, err := s.build()
+	s.Error(err)
+	s.Contains(err.Error(), "has no variant 'v7'")
+}
+
 func (s *TaskSuite) TestOciImage() {
 	s.req.Config.ContextDir = "testdata/multi-arch"
 	s.req.Config.ImagePlatform = "linux/arm64,linux/amd64"
@@ -625,6 +735,27 @@ func (s *TaskSuite) TestOciImage() {
 	s.True(reflect.DeepEqual(expectedArch, actualArch))
 }
 
+func (s *TaskSuite) TestWarmOnly() {
+	s.req.Config.ContextDir = "testdata/basic"
+	s.req.Config.WarmOnly = true
+
+	err := os.Mkdir(s.outputPath("cache"), 0755)
+	s.NoError(err)
+
+	res, err := s.build()
+	s.NoError(err)
+	s.Empty(res.Outputs)
+
+	_, err = os.Stat(s.imagePath("image.tar"))
+	s.True(os.IsNotExist(err))
+
+	_, err = os.Stat(s.imagePath("digest"))
+	s.True(os.IsNotExist(err))
+
+	_, err = os.Stat(s.outputPath("cache", "index.json"))
+	s.True(os.IsNotExist(err))
+}
+
 func (s *TaskSuite) build() (task.Response, error) {
 	return task.Build(s.buildkitd, s.outputsDir, s.req)
 }
@@ -0,0 +1,42 @@
+package task
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+	"github.com/u-root/u-root/pkg/termios"
+)
+
+// ResizeTerminal limits the columns of the terminal on fd to the given width;
+// Concourse sets a super high value and buildctl happily fills the whole
+// screen with whitespace. A width of 0 leaves the terminal untouched, as does
+// fd not being a terminal.
+func ResizeTerminal(fd uintptr, width int) error {
+	if width == 0 {
+		return nil
+	}
+
+	err := validateTerminalWidth(width)
+	if err != nil {
+		return err
+	}
+
+	ws, err := termios.GetWinSize(fd)
+	if err != nil {
+		return nil
+	}
+
+	ws.Col = uint16(width)
+
+	return termios.SetWinSize(fd, ws)
+}
+
+// validateTerminalWidth checks that the width fits the terminal's column
+// count, rather than wrapping around.
+func validateTerminalWidth(width int) error {
+	if width < 0 || width > math.MaxUint16 {
+		return errors.Errorf("terminal width must be between 0 and %d, not %d", math.MaxUint16, width)
+	}
+
+	return nil
+}
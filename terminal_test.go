@@ -0,0 +1,128 @@
+package task
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/u-root/u-root/pkg/termios"
+	"github.com/vrischmann/envconfig"
+)
+
+type TerminalSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	pty *os.File
+}
+
+func (s *TerminalSuite) SetupTest() {
+	var err error
+	s.pty, err = os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		s.T().Skip("no pty available:", err)
+	}
+
+	ws, err := termios.GetWinSize(s.pty.Fd())
+	s.NoError(err)
+
+	ws.Col = 1000
+	s.NoError(termios.SetWinSize(s.pty.Fd(), ws))
+}
+
+func (s *TerminalSuite) TearDownTest() {
+	if s.pty != nil {
+		s.pty.Close()
+	}
+}
+
+func (s *TerminalSuite) columns() uint16 {
+	ws, err := termios.GetWinSize(s.pty.Fd())
+	s.NoError(err)
+	return ws.Col
+}
+
+func (s *TerminalSuite) configuredWidth() int {
+	var cfg Config
+	s.NoError(envconfig.Init(&cfg))
+	return cfg.TerminalWidth
+}
+
+func (s *TerminalSuite) TestDefault() {
+	width := s.configuredWidth()
+	s.Equal(100, width)
+
+	s.NoError(ResizeTerminal(s.pty.Fd(), width))
+	s.Equal(uint16(100), s.columns())
+}
+
+func (s *TerminalSuite) TestRequestDefault() {
+	req, err := ReadRequest(strings.NewReader(`{"config":{"context":"some-context"}}`))
+	s.NoError(err)
+	s.Equal(100, req.Config.TerminalWidth)
+
+	s.NoError(ResizeTerminal(s.pty.Fd(), req.Config.TerminalWidth))
+	s.Equal(uint16(100), s.columns())
+}
+
+func (s *TerminalSuite) TestRequestCustom() {
+	req, err := ReadRequest(strings.NewReader(`{"config":{"terminal_width":240}}`))
+	s.NoError(err)
+	s.Equal(240, req.Config.TerminalWidth)
+}
+
+func (s *TerminalSuite) TestRequestDisabled() {
+	req, err := ReadRequest(strings.NewReader(`{"config":{"terminal_width":0}}`))
+	s.NoError(err)
+	s.Equal(0, req.Config.TerminalWidth)
+
+	s.NoError(ResizeTerminal(s.pty.Fd(), req.Config.TerminalWidth))
+	s.Equal(uint16(1000), s.columns())
+}
+
+func (s *TerminalSuite) TestCustom() {
+	s.T().Setenv("TERMINAL_WIDTH", "240")
+
+	width := s.configuredWidth()
+	s.Equal(240, width)
+
+	s.NoError(ResizeTerminal(s.pty.Fd(), width))
+	s.Equal(uint16(240), s.columns())
+}
+
+func (s *TerminalSuite) TestDisabled() {
+	s.T().Setenv("TERMINAL_WIDTH", "0")
+
+	width := s.configuredWidth()
+	s.Equal(0, width)
+
+	s.NoError(ResizeTerminal(s.pty.Fd(), width))
+	s.Equal(uint16(1000), s.columns())
+}
+
+func (s *TerminalSuite) TestOutOfRange() {
+	for _, width := range []int{-1, 65536} {
+		s.Error(ResizeTerminal(s.pty.Fd(), width))
+		s.Equal(uint16(1000), s.columns())
+
+		cfg := Config{TerminalWidth: width}
+		s.Error(sanitize(&cfg))
+	}
+}
+
+func (s *TerminalSuite) TestNotATerminal() {
+	devNull, err := os.Open(os.DevNull)
+	s.NoError(err)
+
+	defer devNull.Close()
+
+	s.NoError(ResizeTerminal(devNull.Fd(), 100))
+}
+
+func TestTerminal(t *testing.T) {
+	suite.Run(t, &TerminalSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,123 @@
+package task
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const transferPollInterval = time.Second
+
+// buildctl's plain progress output reports the transfer of local sources as
+// it goes, marking the last update once complete:
+//
+//	#2 transferring context: 2.34MB 1.2s
+//	#2 transferring context: 10.52MB 2.3s done
+var transferLine = regexp.MustCompile(`^#\d+ transferring (\S+): `)
+
+// transferMonitor is an io.Writer which watches buildctl output for a local
+// source transfer (e.g. the context) which has stopped making progress.
+type transferMonitor struct {
+	timeout time.Duration
+
+	// called once the transfer is considered stalled
+	stall func()
+
+	mu           sync.Mutex
+	partial      []byte
+	active       map[string]bool
+	lastProgress time.Time
+	stalled      string
+}
+
+func newTransferMonitor(timeout time.Duration, stall func()) *transferMonitor {
+	return &transferMonitor{
+		timeout: timeout,
+		stall:   stall,
+		active:  map[string]bool{},
+	}
+}
+
+func (monitor *transferMonitor) Write(p []byte) (int, error) {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	monitor.partial = scanLines(monitor.partial, p, monitor.scan)
+
+	return len(p), nil
+}
+
+func (monitor *transferMonitor) scan(line string) {
+	match := transferLine.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+
+	monitor.lastProgress = time.Now()
+
+	if strings.HasSuffix(line, " done") {
+		delete(monitor.active, match[1])
+	} else {
+		monitor.active[match[1]] = true
+	}
+}
+
+// check marks the transfer as stalled, calling stall, if one is in progress
+// and has not been updated within the timeout as of now.
+func (monitor *transferMonitor) check(now time.Time) {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	if monitor.stalled != "" || len(monitor.active) == 0 {
+		return
+	}
+
+	if now.Sub(monitor.lastProgress) < monitor.timeout {
+		return
+	}
+
+	for source := range monitor.active {
+		monitor.stalled = source
+		break
+	}
+
+	monitor.stall()
+}
+
+// Stalled returns the name of the source whose transfer stalled, if any.
+func (monitor *transferMonitor) Stalled() string {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	return monitor.stalled
+}
+
+// watch checks for a stalled transfer periodically until the returned func is
+// called.
+func (monitor *transferMonitor) watch() func() {
+	return pollUntilStopped(monitor.check)
+}
+
+// pollUntilStopped calls check with the current time periodically until the
+// returned func is called.
+func pollUntilStopped(check func(time.Time)) func() {
+	done := make(chan struct{})
+	ticker := time.NewTicker(transferPollInterval)
+
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				check(now)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
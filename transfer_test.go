@@ -0,0 +1,88 @@
+package task
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TransferSuite struct {
+	suite.Suite
+	*require.Assertions
+
+	monitor *transferMonitor
+	stalls  int
+}
+
+func (s *TransferSuite) SetupTest() {
+	s.stalls = 0
+	s.monitor = newTransferMonitor(time.Minute, func() { s.stalls++ })
+}
+
+func (s *TransferSuite) write(output string) {
+	_, err := fmt.Fprint(s.monitor, output)
+	s.NoError(err)
+}
+
+func (s *TransferSuite) TestStalled() {
+	s.write(`#1 [internal] load build definition from Dockerfile
+#1 transferring dockerfile: 112B done
+#1 DONE 0.0s
+
+#2 [internal] load build context
+#2 transferring context: 2.34MB 1.2s
+#2 transferring context: 10.52MB 2.3s
+`)
+
+	s.monitor.check(time.Now().Add(30 * time.Second))
+	s.Empty(s.monitor.Stalled())
+	s.Equal(0, s.stalls)
+
+	s.monitor.check(time.Now().Add(2 * time.Minute))
+	s.Equal("context", s.monitor.Stalled())
+	s.Equal(1, s.stalls)
+
+	// only stalls once
+	s.monitor.check(time.Now().Add(3 * time.Minute))
+	s.Equal(1, s.stalls)
+}
+
+func (s *TransferSuite) TestCompleted() {
+	s.write(`#2 [internal] load build context
+#2 transferring context: 2.34MB 1.2s
+#2 transferring context: 10.52MB 2.3s done
+#2 DONE 2.4s
+
+#3 [1/2] RUN sleep 600
+`)
+
+	s.monitor.check(time.Now().Add(time.Hour))
+	s.Empty(s.monitor.Stalled())
+	s.Equal(0, s.stalls)
+}
+
+func (s *TransferSuite) TestNoTransfer() {
+	s.write("#1 [internal] load metadata for docker.io/library/busybox:latest\n")
+
+	s.monitor.check(time.Now().Add(time.Hour))
+	s.Empty(s.monitor.Stalled())
+}
+
+func (s *TransferSuite) TestProgressResetsTimeout() {
+	s.write("#2 transferring context: 2.34MB 1.2s\n")
+
+	time.Sleep(10 * time.Millisecond)
+	s.write("#2 transferring context: 4.1MB 61.2s\n")
+
+	s.monitor.check(s.monitor.lastProgress.Add(59 * time.Second))
+	s.Empty(s.monitor.Stalled())
+}
+
+func TestTransfer(t *testing.T) {
+	suite.Run(t, &TransferSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -1,5 +1,7 @@
 package task
 
+import "time"
+
 // Request is the request payload sent from Concourse to execute the task.
 //
 // This is currently not really exercised by Concourse; it's a mock-up of what
@@ -7,6 +9,15 @@ package task
 type Request struct {
 	ResponsePath string `json:"response_path"`
 	Config       Config `json:"config"`
+
+	// Multiple images to build concurrently instead of Config, each writing
+	// to the outputs subdirectory with its Name. Config still configures the
+	// shared buildkitd. Configs which would change the same files, e.g. by
+	// injecting files into a shared context, are built one at a time.
+	Configs []Config `json:"configs,omitempty"`
+
+	// How many Configs to build at once.
+	Parallelism int `json:"parallelism,omitempty"`
 }
 
 // Response is sent back to Concourse by writing this structure to the
@@ -34,6 +45,33 @@ type Request struct {
 //   caches: [cache]
 type Response struct {
 	Outputs []string `json:"outputs"`
+
+	// The buildctl command run to build the final target, with secrets
+	// redacted.
+	Command []string `json:"command"`
+
+	// The frontend warnings raised by the build, e.g. Dockerfile lint checks,
+	// even if it succeeded.
+	Warnings []string `json:"warnings"`
+
+	// The digest of the exported cache's manifest, if the cache was exported.
+	CacheDigest string `json:"cache_digest"`
+
+	// The time taken by each of the Dockerfile's stages, e.g. "builder":
+	// "12.3s", from buildctl's progress output.
+	StageTimings map[string]string `json:"stage_timings"`
+
+	// Whether the build was skipped, as the image already exists (see
+	// SkipIfExists).
+	Skipped bool `json:"skipped"`
+
+	// The digest of the files in the context sent to buildkit, i.e. honoring
+	// the .dockerignore, for detecting when the build's input changed.
+	ContextDigest string `json:"context_digest"`
+
+	// The response of each of the request's Configs which was built, by name,
+	// when building several (see BuildAll).
+	Builds map[string]Response `json:"builds,omitempty"`
 }
 
 // Config contains the configuration for the task.
@@ -46,24 +84,206 @@ type Response struct {
 type Config struct {
 	Debug bool `json:"debug" envconfig:"optional"`
 
+	// Name of the config when one of a request's Configs.
+	Name string `json:"name,omitempty" envconfig:"-"`
+
+	// Path to a YAML file of config to use for any fields not set in the
+	// request, using the same keys.
+	ParamsFile string `json:"params_file" envconfig:"optional"`
+
+	// Columns to limit the terminal to, or 0 to leave it untouched.
+	TerminalWidth int `json:"terminal_width" envconfig:"default=100"`
+
+	// Log the fully resolved config, with secrets redacted, before building.
+	PrintConfig bool `json:"print_config" envconfig:"optional"`
+
 	ContextDir     string `json:"context"              envconfig:"CONTEXT,optional"`
 	DockerfilePath string `json:"dockerfile,omitempty" envconfig:"DOCKERFILE,optional"`
 	BuildkitSSH    string `json:"buildkit_ssh"         envconfig:"optional"`
 
+	// Expand '# include <path>' directives in the Dockerfile before building.
+	ExpandIncludes bool `json:"expand_includes" envconfig:"optional"`
+
+	// Files to copy into the context before building, mapping each
+	// destination path within the context to its source path. The context is
+	// restored afterwards.
+	//
+	// envconfig does not support maps, so cmd/build parses $INJECT_FILES.
+	InjectFiles map[string]string `json:"inject_files" envconfig:"-"`
+
+	// Fixed path to symlink the context dir to, and pass to buildkit in its
+	// place, so that it doesn't change between runs.
+	StableContextPath string `json:"stable_context_path" envconfig:"optional"`
+
+	// Report a digest of the context in the response. This reads the whole
+	// context, so it is off by default.
+	ReportContextDigest bool `json:"report_context_digest" envconfig:"optional"`
+
+	// Image of a custom gateway frontend to build with, instead of buildkit's
+	// built-in Dockerfile frontend.
+	GatewayImage string `json:"gateway_image" envconfig:"optional"`
+
+	// Name of the local context passed to buildkit, for frontends which
+	// expect a specific name. Defaults to "context".
+	ContextName string `json:"context_name" envconfig:"optional"`
+
+	// Name of a loaded AppArmor profile for buildkitd to apply to builds.
+	AppArmorProfile string `json:"apparmor_profile" envconfig:"APPARMOR_PROFILE,optional"`
+
+	// Namespace for buildkitd's containerd worker to keep its images in,
+	// instead of buildkit's default 'buildkit'.
+	ContainerdNamespace string `json:"containerd_namespace" envconfig:"optional"`
+
+	// The buildkitd worker to build with, 'oci' or 'containerd', instead of
+	// buildkitd's default.
+	Worker string `json:"worker" envconfig:"optional"`
+
+	// OCI runtime for buildkitd's oci worker to run containers with, e.g. crun
+	// instead of runc, as a path or a binary in the PATH.
+	RuntimeBinary string `json:"runtime_binary" envconfig:"optional"`
+
+	// Build from an overlay of the context, so that injected files and any
+	// other writes can't modify the input itself.
+	ReadOnlyContext bool `json:"read_only_context" envconfig:"optional"`
+
+	// Minimum free space, e.g. 10GB, required on the buildkitd root and the
+	// outputs before building.
+	MinFreeSpace string `json:"min_free_space" envconfig:"optional"`
+
+	// Fail the build if the image's layers add up to more than this size,
+	// e.g. 500MB.
+	MaxImageSize string `json:"max_image_size" envconfig:"optional"`
+
+	// Write a report of the image's layers and their sizes alongside the
+	// image tarball, for docker output only.
+	LayerReport bool `json:"layer_report" envconfig:"optional"`
+
+	// User and group to run rootless buildkitd as, e.g. to match a subuid
+	// range, defaulting to the current ones.
+	RootlessUID int `json:"rootless_uid" envconfig:"optional"`
+	RootlessGID int `json:"rootless_gid" envconfig:"optional"`
+
+	// Run buildkitd directly, or always via rootlesskit, rather than deciding
+	// by whether the task runs as root, e.g. when uid 0 is mapped to an
+	// unprivileged user.
+	ForceRoot     bool `json:"force_root"     envconfig:"optional"`
+	ForceRootless bool `json:"force_rootless" envconfig:"optional"`
+
+	// XDG dirs for buildkitd to keep its state in when rootless, instead of
+	// those in the task's env (or their defaults under HOME).
+	XDGDataHome   string `json:"xdg_data_home"   envconfig:"optional"`
+	XDGConfigHome string `json:"xdg_config_home" envconfig:"optional"`
+	XDGRuntimeDir string `json:"xdg_runtime_dir" envconfig:"optional"`
+
+	// Number of times to restart buildkitd if it crashes during startup.
+	BuildkitStartRetries int `json:"buildkit_start_retries" envconfig:"optional"`
+
+	// host:port for buildkitd to serve its pprof and other debug endpoints on.
+	BuildkitDebugAddr string `json:"buildkit_debug_addr" envconfig:"optional"`
+
+	// Address of an existing buildkitd to build against instead of spawning
+	// one, e.g. tcp://buildkitd:1234.
+	BuildkitAddr string `json:"buildkit_addr" envconfig:"BUILDKIT_HOST,optional"`
+
+	// Path to a file containing the BuildkitAddr, as published by a `build
+	// daemon` running in the same container.
+	BuildkitHostFile string `json:"buildkit_host_file" envconfig:"optional"`
+
+	// Keep the spawned buildkitd running, publishing its address to the
+	// BuildkitHostFile, until the task is stopped, instead of building. Set
+	// by running `build daemon`.
+	KeepDaemon bool `json:"keep_daemon" envconfig:"optional"`
+
+	// TLS configuration for a remote buildkitd listening on TCP.
+	BuildkitCACert     string `json:"buildkit_ca_cert"     envconfig:"optional"`
+	BuildkitCert       string `json:"buildkit_cert"        envconfig:"optional"`
+	BuildkitKey        string `json:"buildkit_key"         envconfig:"optional"`
+	BuildkitServerName string `json:"buildkit_server_name" envconfig:"optional"`
+
 	Target            string   `json:"target"      envconfig:"optional"`
 	TargetFile        string   `json:"target_file" envconfig:"optional"`
 	AdditionalTargets []string `json:"additional_targets" envconfig:"ADDITIONAL_TARGETS,optional"`
 
+	// Only list the Dockerfile's named stages, rather than building.
+	ListTargets bool `json:"list_targets" envconfig:"optional"`
+
 	BuildArgs     []string `json:"build_args"      envconfig:"optional"`
 	BuildArgsFile string   `json:"build_args_file" envconfig:"optional"`
 
-	RegistryMirrors []string `json:"registry_mirrors" envconfig:"REGISTRY_MIRRORS,optional"`
+	// Keys of the only build args to pass to the build, if set. Any others,
+	// e.g. unrelated BUILD_ARG_* vars in a shared pipeline, are dropped.
+	AllowedBuildArgs []string `json:"allowed_build_args" envconfig:"optional"`
+
+	// Keys of build args whose values are masked wherever the config or
+	// buildctl command is logged. They are still passed to the build as-is.
+	SecretBuildArgs []string `json:"secret_build_args" envconfig:"optional"`
+
+	// Registry mirrors to use for docker.io, each with the credentials to
+	// pull through it, if any.
+	RegistryMirrors []MirrorSpec `json:"registry_mirrors" envconfig:"REGISTRY_MIRRORS,optional"`
+
+	// CA certs to trust for pulling from registries, each as
+	// <registry>=<path to PEM file>.
+	RegistryCACerts []string `json:"registry_ca_certs" envconfig:"optional"`
 
 	Labels     []string `json:"labels"      envconfig:"optional"`
 	LabelsFile string   `json:"labels_file" envconfig:"optional"`
 
+	// Build args whose values to also label the image with, each as <arg>, for
+	// a label of the same name, or <arg>=<label>.
+	LabelsFromBuildArgs []string `json:"labels_from_build_args" envconfig:"optional"`
+
+	// Label the image with whether the context, if a git repository, has
+	// uncommitted changes.
+	AutoLabelDirty bool `json:"auto_label_dirty" envconfig:"optional"`
+
+	// Name of a build arg to set to the sha of the context's git HEAD, e.g.
+	// VCS_REF, unless given explicitly.
+	GitRefBuildArg string `json:"git_ref_build_arg" envconfig:"optional"`
+
 	BuildkitSecrets map[string]string `json:"buildkit_secrets" envconfig:"optional"`
 
+	// Secrets to read from env vars, by id, rather than from files, so that
+	// they're never written to disk.
+	SecretsEnv map[string]string `json:"secrets_env" envconfig:"-"`
+
+	// Fail the build if any secret's value appears in the built image's config
+	// or history.
+	FailOnLeakedSecrets bool `json:"fail_on_leaked_secrets" envconfig:"optional"`
+
+	// Path to a JSON file mapping registry hosts to RegistryCreds. It is
+	// re-read before each build so that short-lived tokens minted by a prior
+	// step are current.
+	CredsRefreshFile string `json:"creds_refresh_file" envconfig:"optional"`
+
+	// Namespace for the ids of cache mounts (RUN --mount=type=cache), so that
+	// builds of different projects sharing a buildkitd don't share them.
+	CacheMountNS string `json:"cache_mount_ns" envconfig:"optional"`
+
+	// URL of an HTTP proxy, e.g. a caching one like apt-cacher-ng, for package
+	// installs during RUN to go through. Passed to the build as the proxy
+	// build args, along with PACKAGE_PROXY and PACKAGE_CACHE_ID.
+	PackageProxy string `json:"package_proxy" envconfig:"optional"`
+
+	// Compression for the exported cache: 'gzip' (buildkit's default) or
+	// 'zstd'.
+	CacheCompression string `json:"cache_compression" envconfig:"optional"`
+
+	// Level for the CacheCompression, 1-9 for 'gzip' and 1-22 for 'zstd',
+	// trading CPU for a smaller cache. 0 leaves it to buildkit.
+	CacheCompressionLevel int `json:"cache_compression_level" envconfig:"optional"`
+
+	// Sign the manifest of the exported cache with cosign, with the
+	// CacheSigningKey, so that it can be verified before being imported.
+	SignCache bool `json:"sign_cache" envconfig:"optional"`
+
+	// Path to the cosign private key, or a KMS URI, to sign the cache with.
+	CacheSigningKey string `json:"cache_signing_key" envconfig:"optional"`
+
+	// Prune buildkit's cache after building, keeping either records used
+	// within a duration (e.g. '24h') or at most a size (e.g. '10GB').
+	PruneAfter string `json:"prune_after" envconfig:"optional"`
+
 	// Unpack the OCI image into Concourse's rootfs/ + metadata.json image scheme.
 	//
 	// Theoretically this would go away if/when we standardize on OCI.
@@ -71,6 +291,95 @@ type Config struct {
 
 	OutputOCI bool `json:"output_oci" envconfig:"optional"`
 
+	// The format to output the image in: 'docker' (the default), 'oci' (the
+	// default when OutputOCI is set), or 'image' to store it in the worker's
+	// image store (e.g. a shared containerd) as ImageName instead of writing
+	// a tarball.
+	OutputType     string `json:"output_type"      envconfig:"optional"`
+	OutputTypeFile string `json:"output_type_file" envconfig:"optional"`
+	ImageName      string `json:"image_name"       envconfig:"optional"`
+
+	// Path to stream the image tarball to, e.g. a named pipe read by another
+	// process, instead of writing it to the image output.
+	StreamOutput string `json:"stream_output" envconfig:"optional"`
+
+	// Skip the build if the ImageName already exists in its registry, e.g. to
+	// avoid rebuilding immutable tags.
+	SkipIfExists bool `json:"skip_if_exists" envconfig:"optional"`
+
+	// Also store the image as the ImageName's repository's 'latest' tag.
+	LatestTag bool `json:"latest_tag" envconfig:"optional"`
+
+	// Write a digest-tag file alongside the digest, containing a tag derived
+	// from it (e.g. sha256-<hex>) for immutably referring to the image.
+	TagWithDigest bool `json:"tag_with_digest" envconfig:"optional"`
+
+	// Go template for a tag to write to the image output's tag file, e.g.
+	// '{{.Branch}}-{{.ShortSHA}}'. See tagTemplateData for the fields.
+	TagTemplate string `json:"tag_template" envconfig:"optional"`
+
+	// Env var to take the tag template's branch from when the context has no
+	// branch checked out, e.g. a detached HEAD. Defaults to BRANCH.
+	TagBranchEnv string `json:"tag_branch_env" envconfig:"optional"`
+
+	// Load the image into the docker daemon on the mounted socket after
+	// building, for the 'docker' output type.
+	LoadIntoDaemon bool `json:"load_into_daemon" envconfig:"optional"`
+
+	// Verify the signatures of the Dockerfile's base images with cosign before
+	// building, failing the build if any aren't signed with the CosignKey.
+	VerifyBaseImages bool `json:"verify_base_images" envconfig:"optional"`
+
+	// Path to the cosign public key, or a KMS URI, to verify base images with.
+	CosignKey string `json:"cosign_key" envconfig:"optional"`
+
+	// Lint the Dockerfile with hadolint before building, failing the build on
+	// any findings of LintSeverity or higher.
+	Lint bool `json:"lint" envconfig:"optional"`
+
+	// Lowest severity of lint finding which fails the build: style, info,
+	// warning, or error (the default).
+	LintSeverity string `json:"lint_severity" envconfig:"optional"`
+
+	// Path to the hadolint binary, and to its config file, if any.
+	HadolintPath   string `json:"hadolint_path"   envconfig:"optional"`
+	HadolintConfig string `json:"hadolint_config" envconfig:"optional"`
+
+	// Command to run with sh in a throwaway container from the built image,
+	// via the docker daemon, failing the build if it fails.
+	SmokeTest string `json:"smoke_test" envconfig:"optional"`
+
+	// Merge the image's smallest adjacent layers after building until it has
+	// at most this many, e.g. for registries which limit the layer count.
+	MaxLayers int `json:"max_layers" envconfig:"optional"`
+
+	// Normalize the image tarballs after building (sorted entries, owned by
+	// root, fixed modification times), so that identical builds produce
+	// byte-identical tarballs.
+	DeterministicExport bool `json:"deterministic_export" envconfig:"optional"`
+
+	// Entrypoint and/or cmd to set in the final image's config after building,
+	// replacing those from the Dockerfile.
+	EntrypointOverride []string `json:"entrypoint_override" envconfig:"optional"`
+	CmdOverride        []string `json:"cmd_override"        envconfig:"optional"`
+
+	// Additional outputs for the final target, written in the same build,
+	// e.g. to produce both a docker tarball and an OCI layout.
+	Outputs []OutputSpec `json:"outputs" envconfig:"optional"`
+
+	// Only run the build to warm buildkit's content store (e.g. from the
+	// cache), without producing any outputs. Set by running `build warm`.
+	WarmOnly bool `json:"warm_only" envconfig:"optional"`
+
+	// Command to scan the built image with, e.g. for vulnerabilities. '{image}'
+	// is replaced with the path to the image tarball. The build fails if the
+	// command exits non-zero.
+	ScanCommand string `json:"scan_command" envconfig:"optional"`
+
+	// Paths to copy out of the built image's filesystem into the 'files'
+	// output, e.g. a compiled binary.
+	ExtractFiles []string `json:"extract_files" envconfig:"optional"`
+
 	// Images to pre-load in order to avoid fetching at build time. Mapping from
 	// build arg name to OCI image tarball path.
 	//
@@ -80,7 +389,80 @@ type Config struct {
 
 	AddHosts string `json:"add_hosts" envconfig:"BUILDKIT_ADD_HOSTS,optional"`
 
+	// Attestations to attach to the image, each passed verbatim as a buildctl
+	// --opt, e.g. attest:sbom=generator=some/scanner.
+	Attestations []string `json:"attestations" envconfig:"optional"`
+
+	// Directory to extract the image's attestations to, relative to the
+	// outputs dir unless absolute. Requires the 'oci' output type.
+	AttestationsDir string `json:"attestations_dir" envconfig:"optional"`
+
+	// Path to write just the SLSA predicate of the build's provenance to,
+	// relative to the outputs dir unless absolute. Requires a provenance
+	// attestation to be requested in Attestations.
+	SLSAProvenanceFile string `json:"slsa_provenance_file" envconfig:"optional"`
+
+	// Skip the build and reuse the previous image if the context, Dockerfile,
+	// and build args are unchanged since the last build, as recorded in the
+	// cache.
+	SkipIfUnchanged bool `json:"skip_if_unchanged" envconfig:"optional"`
+
+	// Fail the build if transferring the context (or any other local source)
+	// to buildkitd makes no progress for this long.
+	ContextTransferTimeout time.Duration `json:"context_transfer_timeout" envconfig:"optional"`
+
+	// Fail the build if exporting the image (or the cache) takes longer than
+	// this, once everything has been built.
+	ExportTimeout time.Duration `json:"export_timeout" envconfig:"optional"`
+
+	// Path to write a trace of the final target's build to, relative to the
+	// outputs dir unless absolute.
+	TraceFile string `json:"trace_file" envconfig:"optional"`
+
+	// Path to write Prometheus textfile metrics about the build to.
+	MetricsFile string `json:"metrics_file" envconfig:"optional"`
+
+	// Format to write the response to the ResponsePath in: 'json' (the
+	// default) or 'yaml'.
+	ResponseFormat string `json:"response_format" envconfig:"optional"`
+
+	// URL to POST a JSON summary of the build to once it completes, whether
+	// or not it succeeded. Failing to notify it doesn't fail the build.
+	WebhookURL string `json:"webhook_url" envconfig:"optional"`
+
+	// Secret to sign the webhook's payload with, as an HMAC-SHA256 in the
+	// X-Signature-256 header.
+	WebhookSecret string `json:"webhook_secret" envconfig:"optional"`
+
+	// Entitlements to grant the build, e.g. network.host or security.insecure.
+	// Each is allowed by both buildkitd and buildctl.
+	Entitlements []string `json:"entitlements" envconfig:"optional"`
+
 	ImagePlatform string `json:"image_platform" envconfig:"optional"`
+
+	// Build each of the comma-separated ImagePlatform platforms separately,
+	// writing an image tarball for each rather than a manifest list.
+	SplitByPlatform bool `json:"split_by_platform" envconfig:"optional"`
+
+	// Path to a file to flock while buildkitd runs, serializing builds which
+	// share state such as a persistent buildkit root. Waiting for the lock
+	// gives up after LockTimeout, if set. Only the request's Config sets these.
+	LockFile    string        `json:"lock_file"    envconfig:"optional"`
+	LockTimeout time.Duration `json:"lock_timeout" envconfig:"optional"`
+
+	// Fail the build if the frontend reports any warnings, e.g. for deprecated
+	// Dockerfile syntax.
+	FailOnWarnings bool `json:"fail_on_warnings" envconfig:"optional"`
+}
+
+// OutputSpec configures an additional output for the build. Relative
+// destinations are resolved against the build's outputs dir, i.e. the task's
+// working directory, or the config's subdirectory of it when one of a
+// request's Configs.
+type OutputSpec struct {
+	// One of 'docker', 'oci', 'tar', or 'local'.
+	Type string `json:"type"`
+	Dest string `json:"dest"`
 }
 
 // ImageMetadata is the schema written to manifest.json when producing the
@@ -0,0 +1,68 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// buildctl's plain progress output reports frontend warnings (e.g. Dockerfile
+// deprecations) against the vertex that produced them:
+//
+//	#1 WARN: LegacyKeyValueFormat: "ENV key=value" should be used instead of legacy "ENV key value" format (line 3)
+var warningLine = regexp.MustCompile(`^#\d+ WARN: (.+)$`)
+
+// warningCollector is an io.Writer which picks out the warnings from buildctl
+// output written to it.
+type warningCollector struct {
+	partial  []byte
+	warnings []string
+}
+
+func (collector *warningCollector) Write(p []byte) (int, error) {
+	collector.partial = scanLines(collector.partial, p, collector.scan)
+	return len(p), nil
+}
+
+// Warnings returns the warnings seen so far, including one on a trailing
+// unterminated line.
+func (collector *warningCollector) Warnings() []string {
+	if len(collector.partial) > 0 {
+		collector.scan(string(collector.partial))
+		collector.partial = nil
+	}
+
+	return collector.warnings
+}
+
+func (collector *warningCollector) scan(line string) {
+	match := warningLine.FindStringSubmatch(strings.TrimRight(line, "\r"))
+	if match != nil {
+		collector.warnings = append(collector.warnings, match[1])
+	}
+}
+
+// scanLines appends p to the partial line buffered so far, calling scan with
+// each line completed, and returns what remains of the partial line.
+func scanLines(partial []byte, p []byte, scan func(string)) []byte {
+	partial = append(partial, p...)
+
+	for {
+		i := bytes.IndexByte(partial, '\n')
+		if i == -1 {
+			return partial
+		}
+
+		scan(strings.TrimRight(string(partial[:i]), "\r"))
+		partial = partial[i+1:]
+	}
+}
+
+func checkWarnings(cfg Config, warnings []string) error {
+	if !cfg.FailOnWarnings || len(warnings) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("build produced %d warning(s):\n%s", len(warnings), strings.Join(warnings, "\n"))
+}
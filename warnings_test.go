@@ -0,0 +1,85 @@
+package task
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+const cannedOutput = `#1 [internal] load build definition from Dockerfile
+#1 transferring dockerfile: 112B done
+#1 DONE 0.0s
+
+#1 WARN: LegacyKeyValueFormat: "ENV key=value" should be used instead of legacy "ENV key value" format (line 3)
+
+#2 [internal] load metadata for docker.io/library/busybox:latest
+#2 DONE 0.5s
+
+#3 [1/1] RUN echo WARN: not a warning
+#3 0.155 WARN: not a warning
+#3 DONE 0.2s
+#3 WARN: FromAsCasing: 'as' and 'FROM' keywords' casing do not match (line 1)`
+
+type WarningsSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *WarningsSuite) TestCollect() {
+	collector := &warningCollector{}
+
+	// write in uneven chunks to exercise line buffering
+	output := []byte(cannedOutput)
+	for len(output) > 0 {
+		n := 7
+		if n > len(output) {
+			n = len(output)
+		}
+
+		_, err := collector.Write(output[:n])
+		s.NoError(err)
+
+		output = output[n:]
+	}
+
+	s.Equal([]string{
+		`LegacyKeyValueFormat: "ENV key=value" should be used instead of legacy "ENV key value" format (line 3)`,
+		`FromAsCasing: 'as' and 'FROM' keywords' casing do not match (line 1)`,
+	}, collector.Warnings())
+}
+
+func (s *WarningsSuite) TestNoWarnings() {
+	collector := &warningCollector{}
+
+	_, err := fmt.Fprintln(collector, "#1 [internal] load build definition from Dockerfile")
+	s.NoError(err)
+
+	s.Empty(collector.Warnings())
+}
+
+func (s *WarningsSuite) TestCheckWarnings() {
+	collector := &warningCollector{}
+	_, err := fmt.Fprint(collector, cannedOutput)
+	s.NoError(err)
+
+	warnings := collector.Warnings()
+
+	err = checkWarnings(Config{}, warnings)
+	s.NoError(err)
+
+	err = checkWarnings(Config{FailOnWarnings: true}, warnings)
+	s.Error(err)
+	s.Contains(err.Error(), "2 warning(s)")
+	s.Contains(err.Error(), "LegacyKeyValueFormat")
+
+	err = checkWarnings(Config{FailOnWarnings: true}, nil)
+	s.NoError(err)
+}
+
+func TestWarnings(t *testing.T) {
+	suite.Run(t, &WarningsSuite{
+		Assertions: require.New(t),
+	})
+}
@@ -0,0 +1,157 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// webhookTimeout bounds how long notifying the webhook may take, so that an
+// unresponsive endpoint doesn't hold up the task.
+const webhookTimeout = 10 * time.Second
+
+// webhookSignatureHeader carries the HMAC-SHA256 of the payload, signed with
+// the WebhookSecret, as sha256=<hex>.
+const webhookSignatureHeader = "X-Signature-256"
+
+// webhookPayload is the summary of a build POSTed to the WebhookURL.
+type webhookPayload struct {
+	Repository string   `json:"repository,omitempty"`
+	Tags       []string `json:"tags"`
+	Digest     string   `json:"digest,omitempty"`
+	Status     string   `json:"status"`
+	Error      string   `json:"error,omitempty"`
+	Duration   string   `json:"duration"`
+}
+
+// buildWithWebhook runs the build, then notifies the WebhookURL, if set, of
+// how it went. Failing to notify only logs a warning, so that it never fails
+// (or masks the failure of) the build.
+func buildWithWebhook(ctx context.Context, cfg Config, outputsDir string, build func() (Response, error)) (Response, error) {
+	started := time.Now()
+
+	res, err := build()
+
+	if cfg.WebhookURL != "" {
+		payload := newWebhookPayload(cfg, outputsDir, err, time.Since(started))
+
+		notifyErr := notifyWebhook(ctx, cfg.WebhookURL, cfg.WebhookSecret, payload)
+		if notifyErr != nil {
+			logrus.Warn("failed to notify webhook:", notifyErr)
+		}
+	}
+
+	return res, err
+}
+
+// newWebhookPayload summarizes the build: the image's repository and tags
+// from the ImageName and image output, and its digest, if it was written.
+func newWebhookPayload(cfg Config, outputsDir string, buildErr error, duration time.Duration) webhookPayload {
+	payload := webhookPayload{
+		Tags:     []string{},
+		Status:   "succeeded",
+		Duration: duration.Round(time.Millisecond).String(),
+	}
+
+	if buildErr != nil {
+		payload.Status = "failed"
+		payload.Error = buildErr.Error()
+	}
+
+	if cfg.ImageName != "" {
+		ref, err := name.ParseReference(cfg.ImageName)
+		if err == nil {
+			payload.Repository = ref.Context().Name()
+
+			if tag, ok := ref.(name.Tag); ok {
+				payload.Tags = append(payload.Tags, tag.TagStr())
+			}
+		}
+	}
+
+	imageDir := filepath.Join(outputsDir, "image")
+
+	for _, file := range []string{"tag", "digest-tag"} {
+		tag, err := ioutil.ReadFile(filepath.Join(imageDir, file))
+		if err == nil && strings.TrimSpace(string(tag)) != "" {
+			payload.Tags = append(payload.Tags, strings.TrimSpace(string(tag)))
+		}
+	}
+
+	digest, err := ioutil.ReadFile(filepath.Join(imageDir, "digest"))
+	if err == nil {
+		payload.Digest = strings.TrimSpace(string(digest))
+	}
+
+	return payload
+}
+
+// webhookSignature returns the value of the webhookSignatureHeader for the
+// body.
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyWebhook POSTs the payload to the URL as JSON, signed with the secret
+// if given. Errors only name the URL's host, as the rest of it may hold a
+// token.
+func notifyWebhook(ctx context.Context, webhookURL string, secret string, payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "marshal payload")
+	}
+
+	// still notify of a build that was interrupted
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(withoutURL(err), "create request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if secret != "" {
+		req.Header.Set(webhookSignatureHeader, webhookSignature(secret, body))
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(withoutURL(err), "post to %s://%s", req.URL.Scheme, req.URL.Host)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("unexpected status %s", res.Status)
+	}
+
+	return nil
+}
+
+// withoutURL unwraps a *url.Error to its cause, dropping the full URL it
+// would otherwise include in its message.
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+
+	return err
+}